@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var alertInterval = flag.Duration("alert-interval", 15*time.Second, "How often to evaluate the alert_rules in -config")
+
+// maxAlertRules bounds alert_rules, which are each evaluated against every
+// series every -alert-interval.
+const maxAlertRules = 100
+
+// alertRule sets sensors_alert{name} to 1 while a series of metric (from
+// device, if given, by device label or raw id) has been above or below a
+// threshold for at least For.
+type alertRule struct {
+	Name   string   `json:"name"`
+	Metric string   `json:"metric"`
+	Device string   `json:"device"`
+	Above  *float64 `json:"above"`
+	Below  *float64 `json:"below"`
+	For    duration `json:"for"`
+
+	// When the condition started holding, if it does.
+	since time.Time
+}
+
+var alertGauge = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "sensors",
+	Name:      "alert",
+	Help:      "1 while an alert_rules condition has held for its duration, by rule name",
+}, []string{"name"})
+
+func checkAlertRules(rules []*alertRule) error {
+	if len(rules) > maxAlertRules {
+		return fmt.Errorf("alert_rules: at most %d rules, not %d", maxAlertRules, len(rules))
+	}
+	names := map[string]bool{}
+	for _, r := range rules {
+		switch {
+		case r.Name == "":
+			return fmt.Errorf("alert_rules: rule without a name")
+		case names[r.Name]:
+			return fmt.Errorf("alert_rules: %q is defined twice", r.Name)
+		case r.Metric == "":
+			return fmt.Errorf("alert_rules[%q]: no metric", r.Name)
+		case (r.Above == nil) == (r.Below == nil):
+			return fmt.Errorf("alert_rules[%q]: needs one of above or below", r.Name)
+		case r.For < 0:
+			return fmt.Errorf("alert_rules[%q]: negative for", r.Name)
+		}
+		names[r.Name] = true
+	}
+	return nil
+}
+
+// matches reports whether a series currently meets the rule's condition.
+// seriesMu must be held.
+func (r *alertRule) matches(s *series) bool {
+	if s.metric != r.Metric || r.Device != "" && r.Device != s.labels["device"] && r.Device != s.labels["id"] {
+		return false
+	}
+	if r.Above != nil {
+		return s.value > *r.Above
+	}
+	return s.value < *r.Below
+}
+
+// evaluate updates the rule's gauge for the series as of now.  seriesMu
+// must be held.
+func (r *alertRule) evaluate(now time.Time) {
+	holds := false
+	for _, s := range allSeries {
+		if r.matches(s) {
+			holds = true
+			break
+		}
+	}
+	firing := 0.
+	switch {
+	case !holds:
+		r.since = time.Time{}
+	case r.since.IsZero():
+		r.since = now
+		fallthrough
+	default:
+		if now.Sub(r.since) >= time.Duration(r.For) {
+			firing = 1
+		}
+	}
+	alertGauge.WithLabelValues(r.Name).Set(firing)
+}
+
+// evaluateAlerts evaluates the alert rules, and the thresholds, every
+// interval.  A condition only has to hold at each evaluation, so For is in
+// effect rounded up to a multiple of the interval.  During maintenance no
+// alert fires, and conditions must hold for For again afterwards.
+func evaluateAlerts(rules []*alertRule, interval time.Duration) {
+	for _, r := range rules {
+		alertGauge.WithLabelValues(r.Name).Set(0)
+	}
+	for range tick(interval) {
+		seriesMu.Lock()
+		now := clk.Now()
+		maintenance := inMaintenance(now)
+		for _, r := range rules {
+			if maintenance {
+				r.since = time.Time{}
+				alertGauge.WithLabelValues(r.Name).Set(0)
+				continue
+			}
+			r.evaluate(now)
+		}
+		evaluateThresholds(now, maintenance)
+		seriesMu.Unlock()
+	}
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	auditFile        = flag.String("audit-file", "", "If set, append a JSON line to this file for every accepted sample, for an audit trail apart from the log")
+	auditMaxBytes    = flag.Int64("audit-max-bytes", 64<<20, "Size past which -audit-file is renamed aside, with the time appended, and a new one started; 0 never rotates")
+	auditFsync       = flag.Bool("audit-fsync", false, "fsync -audit-file after every record, so none are lost in a crash or power cut, at some cost in speed")
+	auditRejected    = flag.Bool("audit-rejected", false, "Also record rejected samples in -audit-file, with their reason")
+	auditExitOnError = flag.Bool("audit-exit-on-error", false, "Exit, rather than carry on collecting, if a record can't be written to -audit-file")
+)
+
+var auditErrors = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "audit_errors_total",
+	Help:      "Records that couldn't be written to -audit-file",
+})
+
+// auditRecord is a line of -audit-file.  Rejected samples have a reason,
+// and a value only if it got that far.
+type auditRecord struct {
+	Time     time.Time `json:"time"`
+	Received time.Time `json:"received"`
+	Metric   string    `json:"metric,omitempty"`
+	ID       string    `json:"id,omitempty"`
+	Device   string    `json:"device"`
+	Model    string    `json:"model,omitempty"`
+	Value    *float64  `json:"value,omitempty"`
+	Unit     string    `json:"unit,omitempty"`
+	Rejected string    `json:"rejected,omitempty"`
+}
+
+var (
+	// auditing is whether -audit-file has been opened, for checking
+	// without auditMu.
+	auditing atomic.Bool
+
+	auditMu sync.Mutex
+	// audit is the open -audit-file, and auditSize its size.
+	audit     *os.File
+	auditSize int64
+)
+
+// openAudit opens -audit-file for appending.
+func openAudit() error {
+	f, err := os.OpenFile(*auditFile, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return err
+	}
+	fi, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return err
+	}
+	audit, auditSize = f, fi.Size()
+	auditing.Store(true)
+	return nil
+}
+
+// auditSample records an accepted sample of a series, taken at at.
+func auditSample(metric string, labels prometheus.Labels, v float64, at time.Time) {
+	if !auditing.Load() {
+		return
+	}
+	writeAudit(auditRecord{
+		Time: at, Received: clk.Now(), Metric: metric,
+		ID: labels["id"], Device: labels["device"], Model: labels["model"],
+		Value: &v, Unit: metricUnit(metric),
+	})
+}
+
+// auditRejection records a sample of device's rejected for reason.
+func auditRejection(device, reason string) {
+	if !auditing.Load() || !*auditRejected {
+		return
+	}
+	now := clk.Now()
+	writeAudit(auditRecord{Time: now, Received: now, Device: device, Rejected: reason})
+}
+
+// metricUnit returns the unit a metric's name ends in, such as celsius.
+func metricUnit(metric string) string {
+	metric = strings.TrimSuffix(metric, "_total")
+	return metric[strings.LastIndexByte(metric, '_')+1:]
+}
+
+// writeAudit appends r to -audit-file, rotating it first if it's full.
+// Failures are logged every time, as records are meant not to go missing.
+func writeAudit(r auditRecord) {
+	line, err := json.Marshal(r)
+	if err == nil {
+		auditMu.Lock()
+		err = appendAudit(append(line, '\n'))
+		auditMu.Unlock()
+	}
+	if err != nil {
+		auditErrors.Inc()
+		if *auditExitOnError {
+			log.Fatalf("ERROR: can't write to audit file %s, exiting: %v", *auditFile, err)
+		}
+		log.Printf("ERROR: audit record lost, can't write to %s: %v", *auditFile, err)
+	}
+}
+
+// appendAudit writes line to -audit-file.  auditMu must be held.
+func appendAudit(line []byte) error {
+	if *auditMaxBytes > 0 && auditSize > 0 && auditSize+int64(len(line)) > *auditMaxBytes {
+		if err := rotateAudit(); err != nil {
+			return err
+		}
+	}
+	n, err := audit.Write(line)
+	auditSize += int64(n)
+	if err != nil {
+		return err
+	}
+	if *auditFsync {
+		return audit.Sync()
+	}
+	return nil
+}
+
+// rotateAudit renames -audit-file aside, with the time appended, and
+// starts a new one.  Old files are kept, as deleting them isn't the
+// collector's call.  auditMu must be held.
+func rotateAudit() error {
+	if err := audit.Close(); err != nil {
+		log.Printf("ERROR: closing audit file %s: %v", *auditFile, err)
+	}
+	aside := *auditFile + "." + clk.Now().UTC().Format("20060102T150405.000000000Z")
+	if err := os.Rename(*auditFile, aside); err != nil {
+		// Carry on appending to the full file rather than lose records,
+		// trying again with the next.
+		throttledLogf("audit rotation", "ERROR: can't rotate audit file %s, still appending to it: %v", *auditFile, err)
+	}
+	return openAudit()
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bufio"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// useAuditFile audits to a new file for the rest of t.
+func useAuditFile(t *testing.T, maxBytes string) string {
+	path := filepath.Join(t.TempDir(), "audit.jsonl")
+	setFlag(t, "audit-file", path)
+	setFlag(t, "audit-max-bytes", maxBytes)
+	if err := openAudit(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() {
+		auditMu.Lock()
+		audit.Close()
+		audit, auditSize = nil, 0
+		auditMu.Unlock()
+		auditing.Store(false)
+	})
+	return path
+}
+
+// lineCount returns how many lines the file at path has.
+func lineCount(t *testing.T, path string) int {
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	n := 0
+	for s := bufio.NewScanner(f); s.Scan(); {
+		n++
+	}
+	return n
+}
+
+func TestAuditRotation(t *testing.T) {
+	for _, tt := range []struct {
+		name       string
+		blockAside bool // so that renaming fails
+		current    int  // records wanted in the file
+		aside      int  // and in the one renamed aside
+	}{
+		{"rotated", false, 1, 2},
+		{"rename failed", true, 3, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := newFakeClock()
+			setClock(t, c)
+			// Each record is some 200 bytes, so two fit.
+			path := useAuditFile(t, "450")
+			aside := path + "." + c.Now().UTC().Format("20060102T150405.000000000Z")
+			if tt.blockAside {
+				if err := os.MkdirAll(filepath.Join(aside, "x"), 0755); err != nil {
+					t.Fatal(err)
+				}
+			}
+			errors := counterValue(auditErrors)
+			labels := map[string]string{"id": "28ff0a1b2c3d", "device": "ds18b20-00ff0a1b2c3d", "model": "ds18b20"}
+			for i := 0; i < 3; i++ {
+				auditSample("temperature_degrees_celsius", labels, 21.5, c.Now().Add(time.Duration(i)*time.Second))
+			}
+			if got := counterValue(auditErrors) - errors; got != 0 {
+				t.Errorf("%v records lost", got)
+			}
+			if got := lineCount(t, path); got != tt.current {
+				t.Errorf("%d records in the audit file; want %d", got, tt.current)
+			}
+			if !tt.blockAside {
+				if got := lineCount(t, aside); got != tt.aside {
+					t.Errorf("%d records in the file renamed aside; want %d", got, tt.aside)
+				}
+			}
+		})
+	}
+}
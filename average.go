@@ -0,0 +1,66 @@
+package main
+
+import (
+	"flag"
+	"math"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var averageWindow = flag.Duration("average-window", 0, "If set, export the mean of each series' samples over this window rather than the latest sample")
+var averageWindowStats = flag.Bool("average-window-stats", false, "With -average-window, also export each window's min, max and sample count")
+
+var (
+	windowLabels       = []string{"metric", "id", "device", "model"}
+	windowMinGauges    = newSensorGaugeVec(prometheus.GaugeOpts{Namespace: "sensors", Name: "window_min", Help: "Minimum sample of a series in the last -average-window"}, windowLabels)
+	windowMaxGauges    = newSensorGaugeVec(prometheus.GaugeOpts{Namespace: "sensors", Name: "window_max", Help: "Maximum sample of a series in the last -average-window"}, windowLabels)
+	windowSampleGauges = newSensorGaugeVec(prometheus.GaugeOpts{Namespace: "sensors", Name: "window_samples", Help: "Samples of a series averaged in the last -average-window"}, windowLabels)
+)
+
+// accumulate adds a sample to the series' current averaging window.
+func (s *series) accumulate(v float64) {
+	if s.n == 0 {
+		s.min, s.max = math.Inf(1), math.Inf(-1)
+	}
+	s.sum += v
+	s.min = math.Min(s.min, v)
+	s.max = math.Max(s.max, v)
+	s.n++
+}
+
+// forgetWindow deletes s's window stats along with it.
+func (s *series) forgetWindow() {
+	if !*averageWindowStats {
+		return
+	}
+	l := s.extremeLabels()
+	windowMinGauges.Delete(l)
+	windowMaxGauges.Delete(l)
+	windowSampleGauges.Delete(l)
+}
+
+// flushWindows exports each series' window every -average-window and
+// starts a new one.  Series with no samples in a window keep their last
+// exported mean.
+func flushWindows() {
+	for range tick(*averageWindow) {
+		seriesMu.Lock()
+		for _, s := range allSeries {
+			if s.n == 0 {
+				continue
+			}
+			sink.SetGauge(s.metric, s.labels, s.sum/float64(s.n))
+			if *averageWindowStats {
+				l := prometheus.Labels{"metric": s.metric}
+				for k, v := range s.labels {
+					l[k] = v
+				}
+				windowMinGauges.With(l).Set(s.min)
+				windowMaxGauges.With(l).Set(s.max)
+				windowSampleGauges.With(l).Set(float64(s.n))
+			}
+			s.sum, s.n = 0, 0
+		}
+		seriesMu.Unlock()
+	}
+}
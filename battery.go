@@ -0,0 +1,37 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var batteryLowVolts = flag.Float64("battery-low-volts", 3.3, "Battery voltage below which sensors_battery_low is set; per-model overrides go in -config")
+
+var (
+	batteryGauges = newSensorGaugeVec(prometheus.GaugeOpts{
+		Namespace: "sensors",
+		Name:      "battery_volts",
+		Help:      "Battery voltage reported by a wireless sensor node, in volts",
+	}, sensorLabels)
+	batteryLowGauges = newSensorGaugeVec(prometheus.GaugeOpts{
+		Namespace: "sensors",
+		Name:      "battery_low",
+		Help:      "1 if a sensor node's battery voltage is below its low threshold, else 0",
+	}, sensorLabels)
+)
+
+// recordBatteryLow derives the low-battery flag from a voltage sample; a
+// dying node's other readings go bad before it stops reporting.
+func recordBatteryLow(labels prometheus.Labels, model string, volts float64) {
+	threshold := *batteryLowVolts
+	if t, ok := cfg.BatteryLowVolts[strings.ToLower(model)]; ok {
+		threshold = t
+	}
+	low := 0.
+	if thresholdFlag("battery_low", labels, volts, threshold, true) {
+		low = 1.
+	}
+	batteryLowGauges.With(labels).Set(low)
+}
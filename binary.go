@@ -0,0 +1,113 @@
+package main
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"io"
+	"log"
+	"math"
+	"runtime/debug"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// frameSize is the size of a -framing=binary frame: a type byte, an 8-byte
+// device ID and a big-endian IEEE 754 single-precision value.
+const frameSize = 1 + 8 + 4
+
+// frameKinds are the sample kinds of binary frame types, which are routed
+// as the same kinds of generic line are.
+var frameKinds = map[byte]string{
+	0x01: "temp", // in celsius
+	0x02: "humidity",
+	0x03: "lux",
+	0x04: "co2",
+	0x05: "vbat",
+	0x06: "kwh",
+}
+
+// oneWireModels are the DS18x20 models by 1-Wire family code, the first
+// byte of their IDs.
+var oneWireModels = map[byte]string{
+	0x10: "DS18S20",
+	0x22: "DS1822",
+	0x28: "DS18B20",
+}
+
+var frameResyncBytes = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "binary_frame_resync_bytes_total",
+	Help:      "Bytes skipped with -framing=binary for not starting a frame of a known type",
+})
+
+// scanFrames is a bufio.SplitFunc for fixed-size binary frames.  Nothing
+// marks where a frame starts, so after a dropped or extra byte it resyncs
+// by skipping to the next byte that is a known frame type.  That may be
+// inside a frame, but a misaligned frame soon puts some other byte at the
+// start, and so skipping goes on until the frames line up again.
+func scanFrames(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	skip := 0
+	for skip < len(data) && frameKinds[data[skip]] == "" {
+		skip++
+	}
+	if skip > 0 {
+		frameResyncBytes.Add(float64(skip))
+		return skip, nil, nil
+	}
+	if len(data) >= frameSize {
+		return frameSize, data[:frameSize], nil
+	}
+	if atEOF && len(data) > 0 {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	return 0, nil, nil
+}
+
+// decodeFrame returns the kind, device ID (in hex) and value of a binary
+// frame, or false if it's of an unknown type.
+func decodeFrame(frame []byte) (kind, ID string, v float32, ok bool) {
+	if kind, ok = frameKinds[frame[0]]; !ok {
+		return "", "", 0, false
+	}
+	return kind, hex.EncodeToString(frame[1:9]), math.Float32frombits(binary.BigEndian.Uint32(frame[9:])), true
+}
+
+// processFrame records the sample in a binary frame, returning false if
+// it wasn't recognizable as one.  Temperatures of DS18x20s, by their IDs'
+// family codes, are recorded as DS18x20 lines' are, and anything else as
+// generic lines are, of model "binary".
+func processFrame(frame []byte, c *connection) bool {
+	kind, ID, v, ok := decodeFrame(frame)
+	if !ok {
+		unmatchedLines.Inc()
+		return false
+	}
+	value := strconv.FormatFloat(float64(v), 'g', -1, 32)
+	if model, ok := oneWireModels[frame[1]]; ok && kind == "temp" {
+		if o, ok := noteSample("", ID, model, c); ok {
+			recordDS18x20(kind, ID, model, value, "celsius", o)
+		}
+		return true
+	}
+	if kind == "temp" {
+		value += "C"
+	}
+	if o, ok := noteSample("", ID, "binary", c); ok {
+		recordGeneric(kind, "binary", ID, value, o)
+	}
+	return true
+}
+
+// processFrameSafely is processFrame, but drops the frame rather than the
+// whole collector if handling it panics.
+func processFrameSafely(frame []byte, c *connection) (matched bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Panic processing frame %x from %s: %v\n%s", frame, c.src.endpoint, r, debug.Stack())
+			panicsRecovered.Inc()
+			matched = false
+		}
+	}()
+	return processFrame(frame, c)
+}
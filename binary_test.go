@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+)
+
+// frame encodes a binary frame of type typ, for device ID (in hex).
+func frame(typ byte, ID string, v float32) []byte {
+	b := []byte{typ}
+	id, err := hex.DecodeString(ID)
+	if err != nil || len(id) != 8 {
+		panic("bad frame device ID " + ID)
+	}
+	b = append(b, id...)
+	return binary.BigEndian.AppendUint32(b, math.Float32bits(v))
+}
+
+func TestScanFrames(t *testing.T) {
+	a, b := frame(0x01, "28ff0a1b2c3d4e5f", 21.5), frame(0x02, "0102030405060708", 40)
+	c := frame(0x02, "ffffffffffffffff", 40)
+	for _, tt := range []struct {
+		name string
+		in   []byte
+		want [][]byte
+		err  error
+	}{
+		{"none", nil, nil, nil},
+		{"one", a, [][]byte{a}, nil},
+		{"two", append(append([]byte{}, a...), b...), [][]byte{a, b}, nil},
+		{"truncated", append(append([]byte{}, a...), b[:5]...), [][]byte{a}, io.ErrUnexpectedEOF},
+		{"leading garbage", append([]byte{0xff, 0x00}, a...), [][]byte{a}, nil},
+		// Losing a byte of a joins it to the next frame's type byte; c
+		// then has no byte that could start a frame, so the frames line
+		// up again at the a after it.
+		{"dropped byte", cat(a[:5], a[6:], c, a), [][]byte{cat(a[:5], a[6:], c[:1]), a}, nil},
+		{"all garbage", []byte{0xff, 0x00, 0x7f}, nil, nil},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			s := bufio.NewScanner(bytes.NewReader(tt.in))
+			s.Split(scanFrames)
+			var got [][]byte
+			for s.Scan() {
+				got = append(got, append([]byte{}, s.Bytes()...))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got frames %x; want %x", got, tt.want)
+			}
+			if err := s.Err(); !errors.Is(err, tt.err) {
+				t.Errorf("got error %v; want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestProcessFrame(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		frame  []byte
+		vec    *sensorGaugeVec
+		device string
+		want   float64
+		ok     bool
+	}{
+		{"ds18b20", frame(0x01, "28ff0a1b2c3d4e5f", 21.5), temperatureGauges, formatDevice("28ff0a1b2c3d4e5f", "DS18B20"), 21.5, true},
+		{"ds18s20", frame(0x01, "10ff0a1b2c3d4e5f", -10.25), temperatureGauges, formatDevice("10ff0a1b2c3d4e5f", "DS18S20"), -10.25, true},
+		{"other temp", frame(0x01, "aaff0a1b2c3d4e5f", 22.5), temperatureGauges, formatDevice("aaff0a1b2c3d4e5f", "binary"), 22.5, true},
+		{"humidity", frame(0x02, "0102030405060708", 40.25), humidityGauges, formatDevice("0102030405060708", "binary"), 40.25, true},
+		{"co2", frame(0x04, "0102030405060709", 415), co2Gauges, formatDevice("0102030405060709", "binary"), 415, true},
+		{"out of range", frame(0x04, "010203040506070a", 5), co2Gauges, formatDevice("010203040506070a", "binary"), 0, true},
+		{"unknown type", frame(0x7f, "010203040506070b", 1), temperatureGauges, formatDevice("010203040506070b", "binary"), 0, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Cleanup(func() { forgetDevice(tt.device) })
+			unmatched := counterValue(unmatchedLines)
+			if got := processFrame(tt.frame, testConnection(t)); got != tt.ok {
+				t.Fatalf("processFrame(%x) = %v; want %v", tt.frame, got, tt.ok)
+			}
+			if got := counterValue(unmatchedLines) - unmatched; (got == 0) != tt.ok {
+				t.Errorf("processFrame(%x) counted %v unmatched", tt.frame, got)
+			}
+			v, ok := gaugeValue(tt.vec, tt.device)
+			if want := tt.want != 0; ok != want || v != tt.want {
+				t.Errorf("processFrame(%x) gave %v, %v; want %v", tt.frame, v, ok, tt.want)
+			}
+		})
+	}
+}
+
+// frameTypes are the binary frame types by kind.
+var frameTypes = func() map[string]byte {
+	m := map[string]byte{}
+	for typ, kind := range frameKinds {
+		m[kind] = typ
+	}
+	return m
+}()
+
+func TestFrameRoundTrip(t *testing.T) {
+	for _, tt := range []struct {
+		kind, ID string
+		v        float32
+	}{
+		{"temp", "28ff0a1b2c3d4e5f", 21.5},
+		{"temp", "10ff0a1b2c3d4e5f", -55.125},
+		{"humidity", "0102030405060708", 99.9},
+		{"lux", "ffffffffffffffff", 120000},
+		{"co2", "0000000000000000", 415},
+		{"vbat", "0a0b0c0d0e0f1011", 3.3},
+		{"kwh", "1122334455667788", float32(math.Inf(1))},
+	} {
+		f := frame(frameTypes[tt.kind], tt.ID, tt.v)
+		kind, ID, v, ok := decodeFrame(f)
+		if !ok || kind != tt.kind || ID != tt.ID || v != tt.v {
+			t.Errorf("decodeFrame(%x) = %q, %q, %v, %v; want %q, %q, %v, true", f, kind, ID, v, ok, tt.kind, tt.ID, tt.v)
+		}
+	}
+}
+
+func FuzzDecodeFrame(f *testing.F) {
+	f.Add(frame(0x01, "28ff0a1b2c3d4e5f", 21.5))
+	f.Add(frame(0x7f, "0102030405060708", 1))
+	f.Fuzz(func(t *testing.T, in []byte) {
+		if len(in) != frameSize {
+			return
+		}
+		kind, ID, v, ok := decodeFrame(in)
+		if !ok {
+			if _, known := frameKinds[in[0]]; known {
+				t.Fatalf("decodeFrame(%x) rejected a frame of known type", in)
+			}
+			return
+		}
+		// Compare the bits, so NaN values round-trip too.
+		b := append([]byte{frameTypes[kind]}, mustDecodeHex(t, ID)...)
+		b = binary.BigEndian.AppendUint32(b, math.Float32bits(v))
+		if !bytes.Equal(b, in) {
+			t.Fatalf("decodeFrame(%x) = %q, %q, %v, which encodes as %x", in, kind, ID, v, b)
+		}
+	})
+}
+
+func FuzzScanFrames(f *testing.F) {
+	a, b := frame(0x01, "28ff0a1b2c3d4e5f", 21.5), frame(0x02, "0102030405060708", 40)
+	f.Add(append(append([]byte{}, a...), b...))
+	f.Add(append(append([]byte{0xff}, a[3:]...), b...))
+	f.Fuzz(func(t *testing.T, in []byte) {
+		s := bufio.NewScanner(bytes.NewReader(in))
+		s.Split(scanFrames)
+		n := 0
+		for s.Scan() {
+			tok := s.Bytes()
+			if len(tok) != frameSize {
+				t.Fatalf("got a %d-byte frame %x", len(tok), tok)
+			}
+			if _, _, _, ok := decodeFrame(tok); !ok {
+				t.Fatalf("got frame %x of unknown type", tok)
+			}
+			n += len(tok)
+		}
+		if n > len(in) {
+			t.Fatalf("got %d bytes of frames from %d bytes", n, len(in))
+		}
+		if err := s.Err(); err != nil && !errors.Is(err, io.ErrUnexpectedEOF) {
+			t.Fatalf("got error %v", err)
+		}
+	})
+}
+
+// cat concatenates bs.
+func cat(bs ...[]byte) []byte {
+	return bytes.Join(bs, nil)
+}
+
+func mustDecodeHex(t *testing.T, s string) []byte {
+	b, err := hex.DecodeString(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// bucketSpec gives a histogram's bucket upper bounds, either listed or as
+// Count buckets from Start, each Width wider (linear) or Factor times
+// (exponential) the one before.
+type bucketSpec struct {
+	Buckets []float64 `json:"buckets"`
+	Start   float64   `json:"start"`
+	Width   float64   `json:"width"`
+	Factor  float64   `json:"factor"`
+	Count   int       `json:"count"`
+}
+
+func (b bucketSpec) bounds() ([]float64, error) {
+	switch {
+	case len(b.Buckets) > 0:
+		if b.Count != 0 || b.Width != 0 || b.Factor != 0 {
+			return nil, fmt.Errorf("buckets can't be combined with count, width or factor")
+		}
+		for i := 1; i < len(b.Buckets); i++ {
+			if b.Buckets[i] <= b.Buckets[i-1] {
+				return nil, fmt.Errorf("buckets must be increasing, but %v follows %v", b.Buckets[i], b.Buckets[i-1])
+			}
+		}
+		return b.Buckets, nil
+	case b.Count < 1:
+		return nil, fmt.Errorf("need buckets, or a count of at least 1")
+	case b.Width != 0 && b.Factor != 0:
+		return nil, fmt.Errorf("width and factor are exclusive")
+	case b.Width > 0:
+		return prometheus.LinearBuckets(b.Start, b.Width, b.Count), nil
+	case b.Factor > 1:
+		if b.Start <= 0 {
+			return nil, fmt.Errorf("exponential buckets need a positive start, not %v", b.Start)
+		}
+		return prometheus.ExponentialBuckets(b.Start, b.Factor, b.Count), nil
+	default:
+		return nil, fmt.Errorf("need a positive width or a factor greater than 1")
+	}
+}
+
+// histograms rebuilds each histogram, by name without the sensors_ prefix,
+// with the given buckets.  They have to be replaced before registration.
+var histograms = map[string]func(buckets []float64){
+	"dial_duration_seconds":     func(b []float64) { dialDuration = newDialDuration(b) },
+	"inter_sample_seconds":      func(b []float64) { interSampleSeconds = newInterSampleSeconds(b) },
+	"rounding_residual_celsius": func(b []float64) { roundingResidual = newRoundingResidual(b) },
+	"samples_per_connection":    func(b []float64) { samplesPerConnection = newSamplesPerConnection(b) },
+}
+
+// checkHistogramBuckets checks the histogram_buckets config.
+func checkHistogramBuckets(specs map[string]bucketSpec) error {
+	for name, spec := range specs {
+		if histograms[name] == nil {
+			return fmt.Errorf("histogram_buckets[%q]: no such histogram", name)
+		}
+		if _, err := spec.bounds(); err != nil {
+			return fmt.Errorf("histogram_buckets[%q]: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// applyHistogramBuckets replaces the configured histograms' default
+// buckets.  The specs must have been checked.
+func applyHistogramBuckets(specs map[string]bucketSpec) {
+	for name, spec := range specs {
+		b, _ := spec.bounds()
+		histograms[name](b)
+	}
+}
@@ -0,0 +1,43 @@
+package main
+
+import (
+	"flag"
+	"runtime"
+	"runtime/debug"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var instanceName = flag.String("instance-name", "", "Name of this collector instance, prefixed to log lines and exported in sensors_build_info")
+
+var buildInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "sensors",
+	Name:      "build_info",
+	Help:      "Always 1; labelled with the collector's version, Go version and -instance-name",
+}, []string{"version", "goversion", "instance"})
+
+// startTimestamp is when the collector started, for uptime panels that
+// can't rely on the process collector being registered.
+var startTimestamp = prometheus.NewGauge(prometheus.GaugeOpts{
+	Namespace: "sensors",
+	Name:      "start_timestamp_seconds",
+	Help:      "Unix time the collector started",
+})
+
+// configuredEndpoint is set for each source, for inventory of which
+// collector reads which gateway.  Endpoints aren't secret and are exported
+// as configured.
+var configuredEndpoint = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "sensors",
+	Name:      "configured_endpoint",
+	Help:      "Always 1; labelled with each endpoint the collector is configured to read",
+}, []string{"endpoint"})
+
+func setBuildInfo() {
+	version := "unknown"
+	if bi, ok := debug.ReadBuildInfo(); ok {
+		version = bi.Main.Version
+	}
+	buildInfo.WithLabelValues(version, runtime.Version(), *instanceName).Set(1)
+	startTimestamp.Set(float64(startTime.UnixNano()) / 1e9)
+}
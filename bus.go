@@ -0,0 +1,64 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var busWindow = flag.Duration("bus-window", 0, "If set, compare the device IDs each source reports in every window this long with those of the window before, logging and counting changes to its membership; it should be a few times the slowest sensor's reporting interval")
+
+var busMembershipChanges = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "bus_membership_changes_total",
+	Help:      "Times the set of device IDs a source reports changed from one -bus-window to the next, by endpoint",
+}, []string{"endpoint"})
+
+// noteBusMember adds a device ID to c's current -bus-window, first
+// closing the window if it's over.  A window is only ever compared once
+// it's complete, so one cut short by a reconnect is dropped, and the next
+// connection starts a window of its own.
+func (c *connection) noteBusMember(ID string, now time.Time) {
+	if c.busIDs == nil || now.Sub(c.busStart) >= *busWindow {
+		if c.busIDs != nil {
+			c.src.closeBusWindow(c.busIDs)
+		}
+		c.busIDs, c.busStart = map[string]bool{}, now
+	}
+	c.busIDs[ID] = true
+}
+
+// closeBusWindow compares a complete window's IDs with the bus's
+// membership as of the window before, which they then become.  Only the
+// goroutine reading s calls it.
+func (s *source) closeBusWindow(IDs map[string]bool) {
+	if s.busMembers != nil {
+		added, removed := setChanges(s.busMembers, IDs)
+		if len(added) > 0 || len(removed) > 0 {
+			log.Printf("Devices on %s changed: added %v, removed %v", s.endpoint, added, removed)
+			busMembershipChanges.WithLabelValues(s.endpoint).Inc()
+		}
+	}
+	s.busMembers = IDs
+}
+
+// setChanges returns the members of to not in from, and those of from not
+// in to, sorted.
+func setChanges(from, to map[string]bool) (added, removed []string) {
+	for ID := range to {
+		if !from[ID] {
+			added = append(added, ID)
+		}
+	}
+	for ID := range from {
+		if !to[ID] {
+			removed = append(removed, ID)
+		}
+	}
+	sort.Strings(added)
+	sort.Strings(removed)
+	return added, removed
+}
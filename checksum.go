@@ -0,0 +1,124 @@
+package main
+
+import (
+	"flag"
+	"hash/crc32"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var lineChecksum = flag.String("line-checksum", "none", "Checksum each line carries: none; nmea for $payload*XX lines; or crc16-ccitt, crc16-modbus or crc32 for a hex CRC field per -checksum-field")
+var checksumField = flag.String("checksum-field", "last", "Where a line's CRC field is, with a CRC -line-checksum: first or last")
+
+var checksumErrors = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "checksum_errors_total",
+	Help:      "Lines dropped for a missing or incorrect checksum",
+})
+
+// verifyChecksum checks and strips a line's checksum, per -line-checksum,
+// returning the payload or false if the line should be dropped.  Blank
+// lines pass through.
+func verifyChecksum(t string) (string, bool) {
+	if *lineChecksum == "none" || strings.TrimSpace(t) == "" {
+		return t, true
+	}
+	if *lineChecksum == "nmea" {
+		return verifyNMEA(t)
+	}
+	return verifyCRC(t, crcs[*lineChecksum])
+}
+
+func verifyNMEA(t string) (string, bool) {
+	// $payload*XX, where XX is the hex XOR of the payload's bytes.  Some
+	// talkers use ! for the start, and some leave it off.
+	t = strings.TrimSpace(t)
+	t = strings.TrimLeft(t, "$!")
+	star := strings.LastIndexByte(t, '*')
+	if star < 0 || len(t)-star != 3 {
+		return "", false
+	}
+	want, err := strconv.ParseUint(t[star+1:], 16, 8)
+	if err != nil {
+		return "", false
+	}
+	var sum byte
+	for i := 0; i < star; i++ {
+		sum ^= t[i]
+	}
+	if sum != byte(want) {
+		return "", false
+	}
+	return t[:star], true
+}
+
+// crc is a CRC algorithm, with the hex digits its field has.
+type crc struct {
+	digits int
+	sum    func([]byte) uint32
+}
+
+var crcs = map[string]crc{
+	// CRC-16/CCITT-FALSE: polynomial 0x1021, initially 0xffff.
+	"crc16-ccitt": {4, func(b []byte) uint32 {
+		c := uint16(0xffff)
+		for _, x := range b {
+			c ^= uint16(x) << 8
+			for i := 0; i < 8; i++ {
+				if c&0x8000 != 0 {
+					c = c<<1 ^ 0x1021
+				} else {
+					c <<= 1
+				}
+			}
+		}
+		return uint32(c)
+	}},
+	// CRC-16/MODBUS: polynomial 0x8005 reflected, initially 0xffff.
+	"crc16-modbus": {4, func(b []byte) uint32 {
+		c := uint16(0xffff)
+		for _, x := range b {
+			c ^= uint16(x)
+			for i := 0; i < 8; i++ {
+				if c&1 != 0 {
+					c = c>>1 ^ 0xa001
+				} else {
+					c >>= 1
+				}
+			}
+		}
+		return uint32(c)
+	}},
+	"crc32": {8, crc32.ChecksumIEEE},
+}
+
+// verifyCRC checks a line whose first or last whitespace-separated field,
+// per -checksum-field, is the hex CRC of the rest of the line, with the
+// whitespace between them left out.
+func verifyCRC(t string, c crc) (string, bool) {
+	t = strings.TrimSpace(t)
+	var field, payload string
+	if *checksumField == "first" {
+		i := strings.IndexAny(t, " \t")
+		if i < 0 {
+			return "", false
+		}
+		field, payload = t[:i], strings.TrimLeft(t[i:], " \t")
+	} else {
+		i := strings.LastIndexAny(t, " \t")
+		if i < 0 {
+			return "", false
+		}
+		payload, field = strings.TrimRight(t[:i], " \t"), t[i+1:]
+	}
+	if len(field) != c.digits {
+		return "", false
+	}
+	want, err := strconv.ParseUint(field, 16, 32)
+	if err != nil || c.sum([]byte(payload)) != uint32(want) {
+		return "", false
+	}
+	return payload, true
+}
@@ -0,0 +1,81 @@
+package main
+
+import "testing"
+
+func TestVerifyNMEA(t *testing.T) {
+	setFlag(t, "line-checksum", "nmea")
+	const payload = "100 temp 28ff0a1b2c3d DS18B20 21.5"
+	for _, tt := range []struct {
+		line string
+		want string
+		ok   bool
+	}{
+		{"$" + payload + "*75", payload, true},
+		{"!" + payload + "*75", payload, true},
+		{payload + "*75", payload, true},
+		{"$" + payload + "*75\r", payload, true},
+		{"$" + payload + "*76", "", false},
+		{"$" + payload + "*7", "", false},
+		{"$" + payload + "*zz", "", false},
+		{"$" + payload, "", false},
+		{"$A*41", "A", true},
+		{"$*00", "", true},
+		{"", "", true},
+	} {
+		got, ok := verifyChecksum(tt.line)
+		if got != tt.want || ok != tt.ok {
+			t.Errorf("verifyChecksum(%q) = %q, %v; want %q, %v", tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestCRCCheckValues(t *testing.T) {
+	for _, tt := range []struct {
+		name string
+		want uint32
+	}{
+		{"crc16-ccitt", 0x29b1},
+		{"crc16-modbus", 0x4b37},
+		{"crc32", 0xcbf43926},
+	} {
+		if got := crcs[tt.name].sum([]byte("123456789")); got != tt.want {
+			t.Errorf("%s(123456789) = %#x; want %#x", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyCRC(t *testing.T) {
+	const payload = "123456789"
+	for _, tt := range []struct {
+		checksum, field string
+		line            string
+		ok              bool
+	}{
+		{"crc16-ccitt", "last", payload + " 29B1", true},
+		{"crc16-ccitt", "last", payload + "\t29b1\r", true},
+		{"crc16-ccitt", "last", payload + " 29B2", false},
+		{"crc16-ccitt", "last", "123456780 29B1", false},
+		{"crc16-ccitt", "last", payload + " 029B1", false},
+		{"crc16-ccitt", "first", "29B1 " + payload, true},
+		{"crc16-ccitt", "first", payload + " 29B1", false},
+		{"crc16-modbus", "last", payload + " 4B37", true},
+		{"crc16-modbus", "first", "4B37  " + payload, true},
+		{"crc16-modbus", "last", payload + " 29B1", false},
+		{"crc32", "last", payload + " CBF43926", true},
+		{"crc32", "first", "cbf43926 " + payload, true},
+		{"crc32", "last", payload + " CBF4392G", false},
+		{"crc32", "last", payload + " 29B1", false},
+		{"crc32", "last", "CBF43926", false},
+		{"crc32", "first", "CBF43926", false},
+	} {
+		setFlag(t, "line-checksum", tt.checksum)
+		setFlag(t, "checksum-field", tt.field)
+		want := ""
+		if tt.ok {
+			want = payload
+		}
+		if got, ok := verifyChecksum(tt.line); got != want || ok != tt.ok {
+			t.Errorf("%s, %s: verifyChecksum(%q) = %q, %v; want %q, %v", tt.checksum, tt.field, tt.line, got, ok, want, tt.ok)
+		}
+	}
+}
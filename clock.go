@@ -0,0 +1,38 @@
+package main
+
+import "time"
+
+// clock is the collector's source of time, so that time-dependent
+// behaviour (expiry, backoff, windows, rates) can be driven by something
+// other than the wall clock.
+type clock interface {
+	Now() time.Time
+	Sleep(d time.Duration)
+	// After is time.After.
+	After(d time.Duration) <-chan time.Time
+	// NewTicker returns a channel that ticks every d, and a func that
+	// stops it.
+	NewTicker(d time.Duration) (<-chan time.Time, func())
+}
+
+// clk is the clock everything reads.
+var clk clock = wallClock{}
+
+// wallClock is the real clock.
+type wallClock struct{}
+
+func (wallClock) Now() time.Time        { return time.Now() }
+func (wallClock) Sleep(d time.Duration) { time.Sleep(d) }
+
+func (wallClock) After(d time.Duration) <-chan time.Time { return time.After(d) }
+
+func (wallClock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	t := time.NewTicker(d)
+	return t.C, t.Stop
+}
+
+// tick is time.Tick on clk, for tickers that run forever.
+func tick(d time.Duration) <-chan time.Time {
+	c, _ := clk.NewTicker(d)
+	return c
+}
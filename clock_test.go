@@ -0,0 +1,82 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a clock that only moves when set or advanced.  Sleeping on
+// it, or waiting on After, advances it instead of waiting, and is recorded
+// so tests can check how long the code meant to wait.  Its tickers never
+// tick.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	sleeps []time.Duration
+	afters []time.Duration
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+// setClock makes c the clock for the rest of t.
+func setClock(t testing.TB, c clock) {
+	old := clk
+	clk = c
+	t.Cleanup(func() { clk = old })
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Set sets the time to t.
+func (c *fakeClock) Set(t time.Time) {
+	c.mu.Lock()
+	c.now = t
+	c.mu.Unlock()
+}
+
+// Advance moves the time on by d.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func (c *fakeClock) Sleep(d time.Duration) {
+	c.mu.Lock()
+	c.sleeps = append(c.sleeps, d)
+	c.now = c.now.Add(d)
+	c.mu.Unlock()
+}
+
+func (c *fakeClock) After(d time.Duration) <-chan time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.afters = append(c.afters, d)
+	c.now = c.now.Add(d)
+	ch := make(chan time.Time, 1)
+	ch <- c.now
+	return ch
+}
+
+func (c *fakeClock) NewTicker(d time.Duration) (<-chan time.Time, func()) {
+	return make(chan time.Time), func() {}
+}
+
+// waits returns the non-zero durations slept and waited on After so far.
+func (c *fakeClock) waits() (sleeps, afters []time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for _, d := range c.sleeps {
+		if d != 0 {
+			sleeps = append(sleeps, d)
+		}
+	}
+	return sleeps, append(afters, c.afters...)
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var clockJumpThreshold = flag.Duration("clock-jump-threshold", time.Second, "How far the wall clock may step against the monotonic clock between checks, each second, before it's taken as a jump; 0 disables detection")
+
+var clockJumps = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "clock_jumps_total",
+	Help:      "Steps of the host's wall clock against its monotonic clock of over -clock-jump-threshold, by direction",
+}, []string{"direction"})
+
+var (
+	clockJumpMu sync.Mutex
+	// lastClockJump is when the latest jump was noticed, by clk.
+	lastClockJump time.Time
+)
+
+// watchClock compares how far the wall clock and the monotonic clock have
+// each moved every second, noting a jump when they disagree by more than
+// -clock-jump-threshold.  Durations the collector measures between its
+// own readings of the clock are monotonic, so immune to the wall clock
+// being stepped, but the monotonic clock stands still while the host is
+// suspended or a VM paused, which shows up here as a forward jump.
+// Slewing by NTP is far too slow to count.
+func watchClock() {
+	clockJumps.WithLabelValues("forward")
+	clockJumps.WithLabelValues("backward")
+	prev := clk.Now()
+	for range tick(time.Second) {
+		now := clk.Now()
+		step := now.Round(0).Sub(prev.Round(0)) - now.Sub(prev)
+		prev = now
+		direction := "forward"
+		if step < 0 {
+			step, direction = -step, "backward"
+		}
+		if step <= *clockJumpThreshold {
+			continue
+		}
+		log.Printf("The clock jumped %s by %v; not measuring rates or intervals across it", direction, step.Round(time.Millisecond))
+		clockJumps.WithLabelValues(direction).Inc()
+		clockJumpMu.Lock()
+		lastClockJump = now
+		clockJumpMu.Unlock()
+	}
+}
+
+// clockJumpedSince reports whether a clock jump has been noticed since t,
+// so that a rate or interval measured from t to now can't be trusted.
+func clockJumpedSince(t time.Time) bool {
+	clockJumpMu.Lock()
+	defer clockJumpMu.Unlock()
+	return !lastClockJump.IsZero() && lastClockJump.After(t)
+}
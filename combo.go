@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aqua/wrt54gl-sensor-collector/sensor"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// comboHead matches the fields before the values of a combo sensor line,
+// "<ts> <id> <model> <value>...", whose values are routed by position per
+// combo_models.
+var comboHead = sensor.NewFieldPattern(sensor.TimestampField, `\w+`, `\w+`)
+
+var comboFieldErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "combo_field_errors_total",
+	Help:      "Fields of combo sensor lines that were missing, unparseable or surplus, by model and position (from 1)",
+}, []string{"model", "position", "reason"})
+
+func checkComboModels(models map[string][]string) error {
+	for model, kinds := range models {
+		if len(kinds) == 0 {
+			return fmt.Errorf("combo_models[%q]: no kinds", model)
+		}
+	}
+	return nil
+}
+
+// comboKinds returns the kinds of a combo model's values, by position, or
+// nil if the model isn't one.
+func comboKinds(model string) []string {
+	return cfg.ComboModels[strings.ToLower(model)]
+}
+
+// parseCombo records each value of a combo sensor line as a sample of the
+// kind in its position.  A line with fewer values than kinds still has
+// those it has recorded, and each missing, bad or surplus value is counted.
+func parseCombo(f []string, c *connection) bool {
+	if len(f) < len(comboHead) || !comboHead.Match(f[:len(comboHead)], isTimestampField) {
+		return false
+	}
+	kinds := comboKinds(f[2])
+	if kinds == nil {
+		return false
+	}
+	ts, ID, model := f[0], f[1], f[2]
+	values := f[len(comboHead):]
+	o, ok := noteSample(ts, ID, model, c)
+	if !ok {
+		return true
+	}
+	lower := strings.ToLower(model)
+	for i, kind := range kinds {
+		position := strconv.Itoa(i + 1)
+		switch {
+		case kind == "":
+			// A column to ignore.
+		case i >= len(values):
+			comboFieldErrors.WithLabelValues(lower, position, "missing").Inc()
+		default:
+			if _, _, err := parseValue(values[i]); err != nil {
+				// recordGeneric would check this, but isn't reached.
+				if device := o.device(ID, model); deviceAllowed(ID, device) {
+					comboFieldErrors.WithLabelValues(lower, position, "bad_value").Inc()
+					badValue(device, values[i], err)
+				}
+				continue
+			}
+			recordGeneric(kind, model, ID, values[i], o)
+		}
+	}
+	for i := len(kinds); i < len(values); i++ {
+		comboFieldErrors.WithLabelValues(lower, strconv.Itoa(i+1), "surplus").Inc()
+	}
+	return true
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestComboLines(t *testing.T) {
+	setConfig(t, config{ComboModels: map[string][]string{"combo": {"temp", "humidity", "", "co2"}}})
+	type errs map[string]float64 // by position and reason
+	for i, tt := range []struct {
+		name  string
+		line  string
+		temp  string // values wanted, or "" for none
+		hum   string
+		co2   string
+		errs  errs
+		match bool
+	}{
+		{"full", "100 %s COMBO 21.5 40 x 415", "21.5", "40", "415", nil, true},
+		{"truncated", "100 %s COMBO 21.5 40", "21.5", "40", "", errs{"4 missing": 1}, true},
+		{"ignored missing", "100 %s COMBO 21.5", "21.5", "", "", errs{"2 missing": 1, "4 missing": 1}, true},
+		{"bad value", "100 %s COMBO 21.5 wet x 415", "21.5", "", "415", errs{"2 bad_value": 1}, true},
+		{"surplus", "100 %s COMBO 21.5 40 x 415 1 2", "21.5", "40", "415", errs{"5 surplus": 1, "6 surplus": 1}, true},
+		{"not combo", "100 %s other 21.5 40 x 415", "", "", "", nil, false},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			ID := "7" + strconv.Itoa(i)
+			model := strings.Fields(tt.line)[2]
+			device := formatDevice(ID, model)
+			t.Cleanup(func() { forgetDevice(device) })
+			before := map[string]float64{}
+			for _, key := range []string{"2 missing", "4 missing", "2 bad_value", "5 surplus", "6 surplus"} {
+				position, reason, _ := strings.Cut(key, " ")
+				before[key] = counterValue(comboFieldErrors.WithLabelValues("combo", position, reason))
+			}
+			line := strings.Replace(tt.line, "%s", ID, 1)
+			if got := processLine(line, testConnection(t)); got != tt.match {
+				t.Fatalf("processLine(%q) = %v; want %v", line, got, tt.match)
+			}
+			for _, g := range []struct {
+				vec  *sensorGaugeVec
+				want string
+			}{{temperatureGauges, tt.temp}, {humidityGauges, tt.hum}, {co2Gauges, tt.co2}} {
+				v, ok := gaugeValue(g.vec, device)
+				if want, _ := strconv.ParseFloat(g.want, 64); ok != (g.want != "") || v != want {
+					t.Errorf("%q gave %v, %v; want %q", line, v, ok, g.want)
+				}
+			}
+			for key, was := range before {
+				position, reason, _ := strings.Cut(key, " ")
+				got := counterValue(comboFieldErrors.WithLabelValues("combo", position, reason)) - was
+				if got != tt.errs[key] {
+					t.Errorf("%q counted %v %s errors; want %v", line, got, key, tt.errs[key])
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,362 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"net/http"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// config holds settings too structured for flags, loaded from the JSON file
+// named by -config.
+type config struct {
+	// Routes maps the sensor kind token of generic sample lines to the
+	// metric it is exported as.  Entries override the built-in routes of
+	// the same kind.
+	Routes []route `json:"routes"`
+	// BatteryLowVolts overrides -battery-low-volts by (lower-case) model.
+	BatteryLowVolts map[string]float64 `json:"battery_low_volts"`
+	// FlagHysteresis is, by flag metric name (without the sensors_
+	// prefix), how far past its threshold a value must recover to clear
+	// the flag.
+	FlagHysteresis map[string]float64 `json:"flag_hysteresis"`
+	// MetricsPaths serves extra views of the metrics, each limited to the
+	// metric names matching one of a list of regexps, keyed by HTTP path.
+	MetricsPaths map[string][]string `json:"metrics_paths"`
+	// DeviceTTLs and ModelTTLs override -stale-ttl for particular devices
+	// (by device label or raw id) and models (lower-case).
+	DeviceTTLs map[string]duration `json:"device_ttls"`
+	ModelTTLs  map[string]duration `json:"model_ttls"`
+	// ModelWarmups is how long after a device of each (lower-case) model is
+	// first heard from to ignore its samples.
+	ModelWarmups map[string]duration `json:"model_warmups"`
+	// Transforms scale and offset generic sample values.
+	Transforms []transform `json:"transforms"`
+	// SourceParsers limits the line formats tried on each source, keyed by
+	// endpoint, to the named parsers, tried in the order given.
+	SourceParsers map[string][]string `json:"source_parsers"`
+	// SourcePipelines gives, keyed by endpoint, the stages each source's
+	// samples go through, in order, leaving out the rest, and Pipeline
+	// those of other sources; by default every stage, in stages' order.
+	SourcePipelines map[string][]string `json:"source_pipelines"`
+	Pipeline        []string            `json:"pipeline"`
+	// SourceLineFilters, keyed by endpoint, limits the lines processed from
+	// each source to those matching.
+	SourceLineFilters map[string]lineFilter `json:"source_line_filters"`
+	// ModelUnits gives the unit each (lower-case) model reports
+	// temperatures in, celsius, fahrenheit or kelvin, and DefaultUnit that of
+	// models that aren't listed.
+	ModelUnits  map[string]string `json:"model_units"`
+	DefaultUnit string            `json:"default_unit"`
+	// ModelTemperatureDecimals overrides -temperature-decimals by
+	// (lower-case) model.
+	ModelTemperatureDecimals map[string]int `json:"model_temperature_decimals"`
+	// MetricUnitSystems overrides -unit-system by metric name (without the
+	// sensors_ prefix).
+	MetricUnitSystems map[string]string `json:"metric_unit_systems"`
+	// SourceFahrenheitModels lists, by endpoint, the humidity sensor models
+	// whose temperatures are in fahrenheit, replacing the default of just
+	// the DHT22, for sources whose firmware has been fixed.
+	SourceFahrenheitModels map[string][]string `json:"source_fahrenheit_models"`
+	// DeviceDecimation and ModelDecimation thin out samples from fast
+	// sensors, keyed like DeviceTTLs and ModelTTLs.
+	DeviceDecimation map[string]decimation `json:"device_decimation"`
+	ModelDecimation  map[string]decimation `json:"model_decimation"`
+	// ReadErrorValues overrides defaultReadErrorValues by (lower-case)
+	// model.
+	ReadErrorValues map[string][]float64 `json:"read_error_values"`
+	// HistogramBuckets overrides the buckets of histograms by name
+	// (without the sensors_ prefix).
+	HistogramBuckets map[string]bucketSpec `json:"histogram_buckets"`
+	// AlertRules define sensors_alert gauges set from thresholds on the
+	// latest samples.
+	AlertRules []*alertRule `json:"alert_rules"`
+	// ModelThresholds and DefaultThresholds, by (lower-case) model and
+	// then metric, or by metric, set sensors_threshold_crossed for devices
+	// without thresholds of their own in -discovery-file.
+	ModelThresholds   map[string]map[string]threshold `json:"model_thresholds"`
+	DefaultThresholds map[string]threshold            `json:"default_thresholds"`
+	// SensorGroups lists, by group name, devices (by device label or raw
+	// id) measuring the same temperature, for sensors_group_spread.
+	SensorGroups map[string][]string `json:"sensor_groups"`
+	// DeviceMedian and ModelMedian export the median of each series'
+	// latest samples, this many, rather than the latest; keyed like
+	// DeviceTTLs and ModelTTLs.
+	DeviceMedian map[string]int `json:"device_median"`
+	ModelMedian  map[string]int `json:"model_median"`
+	// ModelSmoothing smooths each (lower-case) model's samples, after
+	// any median filter, overriding -smoothing-method.
+	ModelSmoothing map[string]smoothing `json:"model_smoothing"`
+	// ModelMaxRates rejects samples from each (lower-case) model that
+	// change faster than this much per second, by metric name (without the
+	// sensors_ prefix).
+	ModelMaxRates map[string]map[string]float64 `json:"model_max_rates"`
+	// ComboModels lists, by (lower-case) model, the kinds of the values of
+	// its combo sensor lines, by position; "" skips a value.
+	ComboModels map[string][]string `json:"combo_models"`
+	// MaintenanceWindows are times during which series expiry and alerts
+	// are suspended, as with POST /maintenance.
+	MaintenanceWindows []maintenanceWindow `json:"maintenance_windows"`
+	// LabelSanitization rewrites exported id, device and model labels.
+	LabelSanitization labelSanitization `json:"label_sanitization"`
+}
+
+// transform is a conversion applied to samples of one kind from one
+// model: by default a linear correction, scale*x + offset, or one of the
+// thermistor conversions in thermistor.go.
+type transform struct {
+	Model    string  `json:"model"`
+	Kind     string  `json:"kind"`
+	Function string  `json:"function"`
+	Scale    float64 `json:"scale"`
+	Offset   float64 `json:"offset"`
+	// Steinhart-Hart coefficients.
+	A float64 `json:"a"`
+	B float64 `json:"b"`
+	C float64 `json:"c"`
+	// Beta, and resistance R0 at temperature T0 (°C, default 25), of an NTC
+	// thermistor.
+	Beta float64  `json:"beta"`
+	R0   float64  `json:"r0"`
+	T0   *float64 `json:"t0"`
+}
+
+// transformValue applies the configured transform for a model and kind to
+// v, if there is one.
+func transformValue(model, kind string, v float64) float64 {
+	for _, t := range cfg.Transforms {
+		if strings.EqualFold(t.Model, model) && strings.EqualFold(t.Kind, kind) {
+			return t.apply(v)
+		}
+	}
+	return v
+}
+
+// duration is a time.Duration that unmarshals from strings like "5m".
+type duration time.Duration
+
+func (d *duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err != nil {
+		return err
+	}
+	v, err := time.ParseDuration(s)
+	*d = duration(v)
+	return err
+}
+
+func (d duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+var cfg config
+
+func loadConfig(path string) (config, error) {
+	var c config
+	if path == "" {
+		return c, nil
+	}
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return c, err
+	}
+	if b, err = expandConfigEnv(b); err != nil {
+		return c, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	if err := json.Unmarshal(b, &c); err != nil {
+		return c, fmt.Errorf("parsing %s: %v", path, err)
+	}
+	if err := checkHistogramBuckets(c.HistogramBuckets); err != nil {
+		return c, err
+	}
+	if err := checkAlertRules(c.AlertRules); err != nil {
+		return c, err
+	}
+	for model, ts := range c.ModelThresholds {
+		if err := checkThresholds(fmt.Sprintf("model_thresholds[%q]", model), ts); err != nil {
+			return c, err
+		}
+	}
+	if err := checkThresholds("default_thresholds", c.DefaultThresholds); err != nil {
+		return c, err
+	}
+	if err := checkComboModels(c.ComboModels); err != nil {
+		return c, err
+	}
+	if err := checkMaintenanceWindows(c.MaintenanceWindows); err != nil {
+		return c, err
+	}
+	if err := checkMaxRates(c.ModelMaxRates); err != nil {
+		return c, err
+	}
+	if err := c.LabelSanitization.check(); err != nil {
+		return c, fmt.Errorf("label_sanitization: %v", err)
+	}
+	for name, medians := range map[string]map[string]int{"device_median": c.DeviceMedian, "model_median": c.ModelMedian} {
+		for key, n := range medians {
+			if n < 0 {
+				return c, fmt.Errorf("%s[%q]: negative sample count %d", name, key, n)
+			}
+		}
+	}
+	for model, sm := range c.ModelSmoothing {
+		if err := sm.check(); err != nil {
+			return c, fmt.Errorf("model_smoothing[%q]: %v", model, err)
+		}
+	}
+	for metric, margin := range c.FlagHysteresis {
+		if margin < 0 {
+			return c, fmt.Errorf("flag_hysteresis[%q]: negative margin %v", metric, margin)
+		}
+	}
+	for metric, system := range c.MetricUnitSystems {
+		if system != "metric" && system != "imperial" {
+			return c, fmt.Errorf("metric_unit_systems[%q]: must be metric or imperial, not %q", metric, system)
+		}
+	}
+	if err := checkUnit(c.DefaultUnit); err != nil {
+		return c, fmt.Errorf("default_unit: %v", err)
+	}
+	for model, unit := range c.ModelUnits {
+		if err := checkUnit(unit); err != nil {
+			return c, fmt.Errorf("model_units[%q]: %v", model, err)
+		}
+	}
+	for endpoint, names := range c.SourceParsers {
+		if _, err := parsersNamed(names); err != nil {
+			return c, fmt.Errorf("source_parsers[%q]: %v", endpoint, err)
+		}
+	}
+	if _, err := stagesNamed(c.Pipeline); err != nil {
+		return c, fmt.Errorf("pipeline: %v", err)
+	}
+	for endpoint, names := range c.SourcePipelines {
+		if _, err := stagesNamed(names); err != nil {
+			return c, fmt.Errorf("source_pipelines[%q]: %v", endpoint, err)
+		}
+	}
+	for endpoint, f := range c.SourceLineFilters {
+		if f.Regex != "" {
+			if f.re, err = regexp.Compile(f.Regex); err != nil {
+				return c, fmt.Errorf("source_line_filters[%q]: %v", endpoint, err)
+			}
+			c.SourceLineFilters[endpoint] = f
+		}
+	}
+	for _, t := range c.Transforms {
+		if err := t.check(); err != nil {
+			return c, fmt.Errorf("transform for %s %s: %v", t.Model, t.Kind, err)
+		}
+	}
+	return c, nil
+}
+
+var envRef = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(?::-([^}]*))?\}`)
+
+// expandEnv replaces ${VAR} in s with the value of the environment variable
+// VAR, which must be set, or with ${VAR:-default}, default if it isn't.
+func expandEnv(s string) (string, error) {
+	var err error
+	s = envRef.ReplaceAllStringFunc(s, func(ref string) string {
+		m := envRef.FindStringSubmatch(ref)
+		if v, ok := os.LookupEnv(m[1]); ok {
+			return v
+		}
+		if strings.Contains(ref, ":-") {
+			return m[2]
+		}
+		if err == nil {
+			err = fmt.Errorf("environment variable %s is not set", m[1])
+		}
+		return ref
+	})
+	return s, err
+}
+
+// expandConfigEnv applies expandEnv to every string value (not key) in a
+// JSON document.  Expanding the parsed values rather than the raw text
+// means a variable's value can't break the JSON.
+func expandConfigEnv(b []byte) ([]byte, error) {
+	var doc interface{}
+	if err := json.Unmarshal(b, &doc); err != nil {
+		return nil, err
+	}
+	var expand func(v interface{}) (interface{}, error)
+	expand = func(v interface{}) (interface{}, error) {
+		var err error
+		switch v := v.(type) {
+		case string:
+			return expandEnv(v)
+		case []interface{}:
+			for i := range v {
+				if v[i], err = expand(v[i]); err != nil {
+					return nil, err
+				}
+			}
+		case map[string]interface{}:
+			for k := range v {
+				if v[k], err = expand(v[k]); err != nil {
+					return nil, err
+				}
+			}
+		}
+		return v, nil
+	}
+	doc, err := expand(doc)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(doc)
+}
+
+// secretFlag matches the names of flags whose values /config redacts.
+var secretFlag = regexp.MustCompile(`(?i)password|secret|token|key|credential`)
+
+// redactURLs redacts the credentials in a flag value holding one or more
+// comma-separated URLs: the userinfo, such as user:pass@, and every query
+// value, such as InfluxDB v1's ?u=...&p=..., keeping the query keys to show
+// what was set.  Elements that aren't URLs with a host are left as they are.
+func redactURLs(v string) string {
+	elems := strings.Split(v, ",")
+	for i, e := range elems {
+		u, err := url.Parse(e)
+		if err != nil || u.Host == "" {
+			continue
+		}
+		if u.User != nil {
+			u.User = url.User("redacted")
+		}
+		if u.RawQuery != "" {
+			q := u.Query()
+			for k := range q {
+				q[k] = []string{"redacted"}
+			}
+			u.RawQuery = q.Encode()
+		}
+		elems[i] = u.String()
+	}
+	return strings.Join(elems, ",")
+}
+
+// serveConfig handles /config, describing the effective configuration: the
+// value of every flag, set or defaulted, and the -config file as loaded.
+func serveConfig(w http.ResponseWriter, r *http.Request) {
+	resp := struct {
+		Flags  map[string]string `json:"flags"`
+		Config config            `json:"config"`
+	}{Flags: map[string]string{}, Config: cfg}
+	flag.VisitAll(func(f *flag.Flag) {
+		v := f.Value.String()
+		if v != "" && secretFlag.MatchString(f.Name) {
+			v = "<redacted>"
+		}
+		resp.Flags[f.Name] = redactURLs(v)
+	})
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
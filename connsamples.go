@@ -0,0 +1,28 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var samplesPerConnection = newSamplesPerConnection(prometheus.ExponentialBuckets(1, 4, 10))
+
+func newSamplesPerConnection(buckets []float64) prometheus.Histogram {
+	return prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "sensors",
+		Name:      "samples_per_connection",
+		Help:      "Sample lines received in each connection, observed when it ends",
+		Buckets:   buckets,
+	})
+}
+
+// ended records how many samples c got before it ended.  A gateway that
+// hangs up after a fixed number shows as a spike in the histogram.
+func (c *connection) ended() {
+	samplesPerConnection.Observe(float64(c.samples))
+	if c.num == 1 || !*quietReconnects {
+		log.Printf("Connection %d to %s ended after %d samples in %v", c.num, c.src.endpoint, c.samples, clk.Now().Sub(c.start).Round(time.Second))
+	}
+}
@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var contentionWindow = flag.Duration("contention-window", time.Second, "Samples for one series this close together count as contended if they differ by -contention-min-delta; 0 disables")
+var contentionMinDelta = flag.Float64("contention-min-delta", 1, "How much, in the metric's units, two samples within -contention-window must differ to count as contended")
+
+var contendedWrites = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "contended_writes_total",
+	Help:      "Samples that arrived within -contention-window of the series' previous one, with a quite different value, suggesting two sensors share its labels",
+}, []string{"metric", "device"})
+
+// noteContention checks a new sample for s against its previous one, both
+// as they arrived rather than as decimated, filtered or smoothed.  Real
+// sensors don't jump by much in under a second, so a quick, big change
+// more likely means two sensors are writing the same series, as with two
+// DHT22s (which both become "dht22").  seriesMu must be held.
+func (s *series) noteContention(v float64, at time.Time) {
+	prev, prevAt := s.raw, s.rawAt
+	s.raw, s.rawAt = v, at
+	if *contentionWindow <= 0 || prevAt.IsZero() {
+		return
+	}
+	if at.Sub(prevAt) < *contentionWindow && math.Abs(v-prev) >= *contentionMinDelta {
+		contendedWrites.WithLabelValues(s.metric, s.labels["device"]).Inc()
+	}
+}
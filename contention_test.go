@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestContention(t *testing.T) {
+	for i, tt := range []struct {
+		name      string
+		smoothing string
+		cfg       config
+		gap       time.Duration
+		samples   []float64
+		want      float64
+	}{
+		{"jump", "none", config{}, 100 * time.Millisecond, []float64{20, 30, 30}, 1},
+		{"slow jump", "none", config{}, 2 * time.Second, []float64{20, 30, 30}, 0},
+		{"flapping", "none", config{}, 100 * time.Millisecond, []float64{20, 30, 20, 30}, 3},
+		// The smoothed value lags well behind the ramp, but each sample
+		// is close to the one before.
+		{"smoothed ramp", "ewma", config{}, 500 * time.Millisecond, []float64{20, 20.5, 21, 21.5, 22, 22.5}, 0},
+		// Only one of every ten samples is kept, but each is close to the
+		// one before.
+		{"decimated ramp", "none", config{ModelDecimation: map[string]decimation{"ds18b20": {Every: 10}}},
+			100 * time.Millisecond, []float64{20, 20.5, 21, 21.5, 22, 22.5, 23, 23.5, 24, 24.5, 25}, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, "smoothing-method", tt.smoothing)
+			setFlag(t, "smoothing-window", "9")
+			setConfig(t, tt.cfg)
+			c := newFakeClock()
+			setClock(t, c)
+			id := fmt.Sprintf("28ff0a1b2c8%d", i)
+			device := formatDevice(id, "DS18B20")
+			t.Cleanup(func() {
+				forgetDevice(device)
+				contendedWrites.DeleteLabelValues("temperature_degrees_celsius", device)
+			})
+			conn := testConnection(t)
+			for _, v := range tt.samples {
+				c.Advance(tt.gap)
+				line := fmt.Sprintf("100 temp %s DS18B20 %v C", id, v)
+				if !processLine(line, conn) {
+					t.Fatalf("processLine(%q) didn't match", line)
+				}
+			}
+			if got := counterValue(contendedWrites.WithLabelValues("temperature_degrees_celsius", device)); got != tt.want {
+				t.Errorf("contended writes = %v; want %v", got, tt.want)
+			}
+		})
+	}
+}
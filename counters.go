@@ -0,0 +1,123 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// sensorCounterVec exports the series of a counter route, for sensors
+// such as energy meters that report an ever-increasing total rather than a
+// reading.  The exported total starts at the first value received and
+// follows the sensor's, except that where the sensor's total goes down,
+// as a meter does when reset or replaced, counting carries on from where
+// it had got to rather than going down with it.
+//
+// Counter series are kept apart from allSeries: averaging, decimation,
+// medians and the like make no sense for them.  They do expire per
+// seriesTTL.
+type sensorCounterVec struct {
+	desc  *prometheus.Desc
+	names []string
+
+	mu     sync.Mutex
+	series map[string]*counterSeries // by seriesKey
+}
+
+type counterSeries struct {
+	labels prometheus.Labels // id, device, model
+	last   float64           // latest sample
+	total  float64
+	at     time.Time
+}
+
+var counterMeterResets = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "counter_resets_total",
+	Help:      "Times a counter sensor's total went down, taken as the sensor being reset, by metric",
+}, []string{"metric"})
+
+// counterVecs are the counter routes' vecs, by metric name, for expiry
+// and promSink.
+var counterVecs = map[string]*sensorCounterVec{}
+
+func newSensorCounterVec(name, help string) *sensorCounterVec {
+	names := sensorLabelNames(sensorLabels)
+	v := &sensorCounterVec{
+		desc:   prometheus.NewDesc(prometheus.BuildFQName("sensors", "", name), help, names, nil),
+		names:  names,
+		series: map[string]*counterSeries{},
+	}
+	counterVecs[name] = v
+	return v
+}
+
+// add records a sample of a counter series, telling the sink how much it
+// went up by.
+func (v *sensorCounterVec) add(metric string, labels prometheus.Labels, value float64) {
+	v.mu.Lock()
+	key := seriesKey(metric, labels)
+	s := v.series[key]
+	var delta float64
+	switch {
+	case s == nil:
+		s = &counterSeries{labels: labels}
+		v.series[key] = s
+		delta = value
+	case value < s.last:
+		// Reset: the sensor has counted value since.
+		counterMeterResets.WithLabelValues(metric).Inc()
+		delta = value
+	default:
+		delta = value - s.last
+	}
+	s.last, s.at = value, clk.Now()
+	v.mu.Unlock()
+	sink.IncCounter(metric, labels, delta)
+}
+
+// inc adds delta to the exported total of a counter series, for promSink.
+func (v *sensorCounterVec) inc(metric string, labels prometheus.Labels, delta float64) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	key := seriesKey(metric, labels)
+	// The series may have expired since add; it'll start afresh.
+	if s := v.series[key]; s != nil {
+		s.total += delta
+	}
+}
+
+// expire deletes the series not updated within their TTL, returning how
+// many.
+func (v *sensorCounterVec) expire(now time.Time) int {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	n := 0
+	for key, s := range v.series {
+		if ttl := seriesTTL(s.labels); ttl > 0 && now.Sub(s.at) > ttl {
+			delete(v.series, key)
+			n++
+		}
+	}
+	return n
+}
+
+func (v *sensorCounterVec) Describe(ch chan<- *prometheus.Desc) { ch <- v.desc }
+
+func (v *sensorCounterVec) Collect(ch chan<- prometheus.Metric) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+	now := clk.Now()
+	for _, s := range v.series {
+		if *maxExportAge > 0 && now.Sub(s.at) > *maxExportAge {
+			continue
+		}
+		l := exported(s.labels)
+		values := make([]string, len(v.names))
+		for i, name := range v.names {
+			values[i] = l[name]
+		}
+		ch <- prometheus.MustNewConstMetric(v.desc, prometheus.CounterValue, s.total, values...)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestCounterRoute(t *testing.T) {
+	v := counterVecs["energy_kwh_total"]
+	for i, tt := range []struct {
+		name    string
+		samples []string
+		want    float64
+		resets  float64
+	}{
+		{"first", []string{"100.5"}, 100.5, 0},
+		{"rising", []string{"100.5", "101.5", "101.5", "103"}, 103, 0},
+		{"reset", []string{"100.5", "101.5", "0.5", "2"}, 103.5, 1},
+		{"resets", []string{"10", "1", "0", "4"}, 15, 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			id := "9" + string(rune('0'+i))
+			t.Cleanup(func() {
+				v.mu.Lock()
+				defer v.mu.Unlock()
+				for key, s := range v.series {
+					if s.labels["id"] == id {
+						delete(v.series, key)
+					}
+				}
+			})
+			resets := counterValue(counterMeterResets)
+			conn := testConnection(t)
+			for _, s := range tt.samples {
+				processLine("100 kwh meter "+id+" "+s, conn)
+			}
+			var got float64
+			found := false
+			for _, m := range collect(v) {
+				if labelValue(m, "id") == id {
+					got, found = m.GetCounter().GetValue(), true
+				}
+			}
+			if !found || got != tt.want {
+				t.Errorf("after %v, total = %v, %v; want %v", tt.samples, got, found, tt.want)
+			}
+			if got := counterValue(counterMeterResets) - resets; got != tt.resets {
+				t.Errorf("after %v, %v resets counted; want %v", tt.samples, got, tt.resets)
+			}
+		})
+	}
+}
+
+func TestCounterRouteErrors(t *testing.T) {
+	t.Cleanup(func() {
+		routes = map[string]*route{}
+		buildRoutes(nil)
+	})
+	for _, tt := range []struct {
+		name   string
+		routes []route
+	}{
+		{"no _total", []route{{Kind: "gas", Metric: "gas_cubic_metres", Type: "counter"}}},
+		{"gauge metric", []route{{Kind: "heat", Metric: "heat_total"}, {Kind: "heat2", Metric: "heat_total", Type: "counter"}}},
+		{"counter as gauge", []route{{Kind: "power", Metric: "energy_kwh_total"}}},
+		{"type", []route{{Kind: "gas", Metric: "gas_total", Type: "histogram"}}},
+	} {
+		if _, err := buildRoutes(tt.routes); err == nil {
+			t.Errorf("%s: buildRoutes(%+v) succeeded", tt.name, tt.routes)
+		}
+	}
+}
+
+func TestUnknownKindLimit(t *testing.T) {
+	setFlag(t, "max-unknown-kinds", "2")
+	old := unknownKinds
+	unknownKinds = map[string]bool{}
+	t.Cleanup(func() { unknownKinds = old })
+	conn := testConnection(t)
+	for _, tt := range []struct {
+		kind  string
+		label string
+	}{
+		{"wind", "wind"},
+		{"Rain", "rain"},
+		{"wind", "wind"},
+		{"snow", "other"},
+		{"xq9", "other"},
+		{"rain", "rain"},
+	} {
+		c := unknownKindSamples.WithLabelValues(tt.label)
+		before := counterValue(c)
+		processLine("100 "+tt.kind+" node 7 1", conn)
+		if got := counterValue(c) - before; got != 1 {
+			t.Errorf("a %s sample counted %v under kind=%q; want 1", tt.kind, got, tt.label)
+		}
+	}
+	if len(unknownKinds) != 2 {
+		t.Errorf("%d kinds remembered; want 2", len(unknownKinds))
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var debugListen = flag.String("debug-listen", "", "If set, (host and) port on which to stream a human-readable log of every sample parsed, for troubleshooting")
+var debugMaxClients = flag.Int("debug-max-clients", 4, "Maximum number of simultaneous -debug-listen clients")
+
+var (
+	debugMu      sync.Mutex
+	debugClients = map[chan string]bool{}
+	// debugActive is len(debugClients), readable without the lock, so
+	// debugf costs next to nothing when nobody is watching.
+	debugActive atomic.Int32
+)
+
+// serveDebug accepts debug stream clients on addr.  Each gets every debugf
+// message from when it connects; one that can't keep up is disconnected
+// rather than slowing down collection.
+func serveDebug(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				log.Printf("Error accepting debug client on %s: %v", addr, err)
+				clk.Sleep(time.Second)
+				continue
+			}
+			debugMu.Lock()
+			if len(debugClients) >= *debugMaxClients {
+				debugMu.Unlock()
+				fmt.Fprintf(conn, "too many debug clients\n")
+				conn.Close()
+				continue
+			}
+			ch := make(chan string, 256)
+			debugClients[ch] = true
+			debugActive.Store(int32(len(debugClients)))
+			debugMu.Unlock()
+			go streamDebug(conn, ch)
+		}
+	}()
+	return nil
+}
+
+func streamDebug(conn net.Conn, ch chan string) {
+	defer conn.Close()
+	for msg := range ch {
+		if _, err := conn.Write([]byte(msg)); err != nil {
+			dropDebugClient(ch)
+			for range ch {
+				// Drain until closed.
+			}
+			return
+		}
+	}
+	fmt.Fprintf(conn, "too slow; disconnecting\n")
+}
+
+// dropDebugClient disconnects a client, if it hasn't been already.
+// debugMu must not be held.
+func dropDebugClient(ch chan string) {
+	debugMu.Lock()
+	defer debugMu.Unlock()
+	dropDebugClientLocked(ch)
+}
+
+func dropDebugClientLocked(ch chan string) {
+	if debugClients[ch] {
+		delete(debugClients, ch)
+		close(ch)
+		debugActive.Store(int32(len(debugClients)))
+	}
+}
+
+// debugf sends a timestamped line to every debug stream client.
+func debugf(format string, args ...interface{}) {
+	if debugActive.Load() == 0 {
+		return
+	}
+	msg := clk.Now().Format("15:04:05.000 ") + fmt.Sprintf(format, args...) + "\n"
+	debugMu.Lock()
+	defer debugMu.Unlock()
+	for ch := range debugClients {
+		select {
+		case ch <- msg:
+		default:
+			dropDebugClientLocked(ch)
+		}
+	}
+}
+
+// skipSample counts a sample dropped for reason.  Every rejection of a
+// sample from a known device comes through here (or, for decimation,
+// setGauge) so that sensors_rejected_total misses none.
+func skipSample(reason, device string) {
+	samplesSkipped.WithLabelValues(reason).Inc()
+	rejectedSamples.WithLabelValues(device, reason).Inc()
+	events.SampleRejected(device, reason)
+	auditRejection(device, reason)
+	debugf("rejected %s: %s", device, reason)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// decimation thins out a fast sensor's samples before export: keep one of
+// every Every samples, and/or at most one per Interval.
+type decimation struct {
+	Every    int      `json:"every"`
+	Interval duration `json:"interval"`
+}
+
+var decimatedSamples = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "decimated_samples_total",
+	Help:      "Samples dropped by per-device or per-model decimation",
+})
+
+// decimationFor returns the decimation configured for a series, with the
+// same precedence as seriesTTL.
+func decimationFor(labels prometheus.Labels) (decimation, bool) {
+	if d, ok := cfg.DeviceDecimation[labels["device"]]; ok {
+		return d, true
+	}
+	if d, ok := cfg.DeviceDecimation[labels["id"]]; ok {
+		return d, true
+	}
+	d, ok := cfg.ModelDecimation[labels["model"]]
+	return d, ok
+}
+
+// keep reports whether a sample arriving at now should update s, per its
+// decimation.  Kept samples are the latest of those since the last one
+// kept, so the exported value is never staler than it has to be.
+// seriesMu must be held.
+func (s *series) keep(now time.Time) bool {
+	d, ok := decimationFor(s.labels)
+	if !ok {
+		return true
+	}
+	s.skipped++
+	if s.skipped < d.Every {
+		return false
+	}
+	if !s.kept.IsZero() && now.Sub(s.kept) < time.Duration(d.Interval) {
+		return false
+	}
+	s.skipped, s.kept = 0, now
+	return true
+}
@@ -0,0 +1,22 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/hex"
+	"strings"
+)
+
+// decodeLine undoes any transport encoding applied to a received line, per
+// -input-encoding.  The result may itself hold several newline-separated
+// lines of sample text.
+func decodeLine(t string) (string, error) {
+	switch *inputEncoding {
+	case "base64":
+		b, err := base64.StdEncoding.DecodeString(strings.TrimSpace(t))
+		return string(b), err
+	case "hex":
+		b, err := hex.DecodeString(strings.TrimSpace(t))
+		return string(b), err
+	}
+	return t, nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var dedupWindow = flag.Duration("dedup-window", 0, "If set, drop sample lines identical (same device, timestamp and values) to one from the same source this recently, as gateways that replay their buffer after a reconnect send")
+var dedupMaxLines = flag.Int("dedup-max-lines", 4096, "Most recent lines -dedup-window remembers; older ones are forgotten early past this")
+
+var duplicateLines = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "duplicate_lines_total",
+	Help:      "Sample lines dropped as repeats of recent ones, per -dedup-window",
+})
+
+type dedupEntry struct {
+	key string
+	at  time.Time
+}
+
+var (
+	dedupMu sync.Mutex
+	// dedupSeen holds when each remembered line was last seen, and
+	// dedupRing the lines in the order seen, so the oldest is forgotten
+	// to make room.
+	dedupSeen = map[string]time.Time{}
+	dedupRing []dedupEntry
+	dedupNext int
+)
+
+// duplicate reports whether the timestamped line f from c was seen within
+// -dedup-window, and if not, remembers it.
+func duplicate(f []string, c *connection) bool {
+	if *dedupWindow <= 0 || !isTimestampField(f[0]) {
+		return false
+	}
+	key := c.src.endpoint + "\xff" + strings.Join(f, "\xff")
+	now := clk.Now()
+	dedupMu.Lock()
+	defer dedupMu.Unlock()
+	if at, ok := dedupSeen[key]; ok && now.Sub(at) <= *dedupWindow {
+		duplicateLines.Inc()
+		return true
+	}
+	if dedupRing == nil {
+		dedupRing = make([]dedupEntry, *dedupMaxLines)
+	}
+	if old := dedupRing[dedupNext]; old.key != "" && dedupSeen[old.key].Equal(old.at) {
+		delete(dedupSeen, old.key)
+	}
+	dedupRing[dedupNext] = dedupEntry{key, now}
+	dedupNext = (dedupNext + 1) % len(dedupRing)
+	dedupSeen[key] = now
+	return false
+}
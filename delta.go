@@ -0,0 +1,150 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var deltaMaxClients = flag.Int("delta-max-clients", 16, "Most /metrics/delta client tokens to remember what was last sent to; the least recently seen is forgotten past this")
+
+// deltaClient is what was last sent to one /metrics/delta client: each
+// metric's encoding, by family name and labels.
+type deltaClient struct {
+	sent map[string]deltaSent
+	seen time.Time
+}
+
+// deltaSent is a metric as last sent to a client, and enough of its family
+// to say later that it has gone.
+type deltaSent struct {
+	enc    string
+	family *dto.MetricFamily
+	labels []*dto.LabelPair
+}
+
+var (
+	deltaMu      sync.Mutex
+	deltaClients = map[string]*deltaClient{}
+)
+
+// deltaClientFor returns the state for token, forgetting the least
+// recently seen client if there are too many.
+func deltaClientFor(token string) *deltaClient {
+	c := deltaClients[token]
+	if c == nil {
+		if len(deltaClients) >= *deltaMaxClients {
+			var oldest string
+			for t, o := range deltaClients {
+				if oldest == "" || o.seen.Before(deltaClients[oldest].seen) {
+					oldest = t
+				}
+			}
+			delete(deltaClients, oldest)
+		}
+		c = &deltaClient{sent: map[string]deltaSent{}}
+		deltaClients[token] = c
+	}
+	c.seen = clk.Now()
+	return c
+}
+
+// deltaGatherer gathers from g only the metrics that have changed since
+// it last gathered for the client with the given token, and, with a NaN
+// value, those that have gone since.  Families left with no metrics are
+// dropped.
+type deltaGatherer struct {
+	g     prometheus.Gatherer
+	token string
+}
+
+func (d deltaGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := d.g.Gather()
+	deltaMu.Lock()
+	defer deltaMu.Unlock()
+	c := deltaClientFor(d.token)
+	sent := make(map[string]deltaSent, len(c.sent))
+	changed := map[string]*dto.MetricFamily{}
+	for _, mf := range mfs {
+		family := &dto.MetricFamily{Name: mf.Name, Help: mf.Help, Type: mf.Type}
+		var ms []*dto.Metric
+		for _, m := range mf.Metric {
+			labels := prometheus.Labels{}
+			for _, l := range m.Label {
+				labels[l.GetName()] = l.GetValue()
+			}
+			key := mf.GetName() + "\xff" + labelsKey(labels)
+			enc := m.String()
+			if c.sent[key].enc != enc {
+				ms = append(ms, m)
+			}
+			sent[key] = deltaSent{enc, family, m.Label}
+		}
+		if len(ms) > 0 {
+			mf.Metric = ms
+			changed[mf.GetName()] = mf
+		}
+	}
+	// Rebuilding sent from this gather forgets what has gone, once the
+	// client has been told.
+	for key, s := range c.sent {
+		if _, ok := sent[key]; ok {
+			continue
+		}
+		mf := changed[s.family.GetName()]
+		if mf == nil {
+			mf = s.family
+			mf.Metric = nil
+			changed[mf.GetName()] = mf
+		}
+		mf.Metric = append(mf.Metric, goneMetric(s.family.GetType(), s.labels))
+	}
+	c.sent = sent
+	out := make([]*dto.MetricFamily, 0, len(changed))
+	for _, mf := range changed {
+		out = append(out, mf)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].GetName() < out[j].GetName() })
+	return out, err
+}
+
+// goneMetric is a metric of the given type and labels with a NaN value,
+// telling a delta client that the series has gone.
+func goneMetric(typ dto.MetricType, labels []*dto.LabelPair) *dto.Metric {
+	nan := math.NaN()
+	m := &dto.Metric{Label: labels}
+	switch typ {
+	case dto.MetricType_COUNTER:
+		m.Counter = &dto.Counter{Value: &nan}
+	case dto.MetricType_GAUGE:
+		m.Gauge = &dto.Gauge{Value: &nan}
+	case dto.MetricType_SUMMARY:
+		m.Summary = &dto.Summary{SampleSum: &nan}
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		m.Histogram = &dto.Histogram{SampleSum: &nan}
+	default:
+		m.Untyped = &dto.Untyped{Value: &nan}
+	}
+	return m
+}
+
+// deltaHandler serves /metrics/delta: the metrics of g that changed since
+// the previous scrape by the same ?token=.  It is not a Prometheus
+// endpoint, since Prometheus expects every series in every scrape.
+func deltaHandler(g prometheus.Gatherer) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := r.URL.Query().Get("token")
+		if token == "" {
+			http.Error(w, "token is required", http.StatusBadRequest)
+			return
+		}
+		promhttp.HandlerFor(deltaGatherer{g, token}, promhttp.HandlerOpts{}).ServeHTTP(w, r)
+	})
+}
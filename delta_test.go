@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// deltaValues gathers from d, returning each gauge's value by its "device"
+// label.
+func deltaValues(t *testing.T, d deltaGatherer) map[string]float64 {
+	mfs, err := d.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs := map[string]float64{}
+	for _, mf := range mfs {
+		for _, m := range mf.Metric {
+			vs[labelValue(m, "device")] = m.GetGauge().GetValue()
+		}
+	}
+	return vs
+}
+
+func TestDeltaGatherer(t *testing.T) {
+	t.Cleanup(func() {
+		deltaMu.Lock()
+		delete(deltaClients, t.Name())
+		deltaMu.Unlock()
+	})
+	g := prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "test_delta"}, []string{"device"})
+	r := prometheus.NewRegistry()
+	r.MustRegister(g)
+	d := deltaGatherer{r, t.Name()}
+
+	g.WithLabelValues("a").Set(1)
+	g.WithLabelValues("b").Set(2)
+	if got := deltaValues(t, d); len(got) != 2 || got["a"] != 1 || got["b"] != 2 {
+		t.Errorf("first gather = %v; want everything", got)
+	}
+	g.WithLabelValues("b").Set(3)
+	if got := deltaValues(t, d); len(got) != 1 || got["b"] != 3 {
+		t.Errorf("gather after b changed = %v; want only b", got)
+	}
+	g.DeleteLabelValues("a")
+	if got := deltaValues(t, d); len(got) != 1 || !math.IsNaN(got["a"]) {
+		t.Errorf("gather after a went = %v; want a as NaN", got)
+	}
+	if got := deltaValues(t, d); len(got) != 0 {
+		t.Errorf("gather with no changes = %v; want nothing", got)
+	}
+	deltaMu.Lock()
+	n := len(deltaClientFor(t.Name()).sent)
+	deltaMu.Unlock()
+	if n != 1 {
+		t.Errorf("client remembers %d series; want 1", n)
+	}
+	g.DeleteLabelValues("b")
+	rec := httptest.NewRecorder()
+	deltaHandler(r).ServeHTTP(rec, httptest.NewRequest("GET", "/metrics/delta?token="+t.Name(), nil))
+	if got, want := rec.Body.String(), `test_delta{device="b"} NaN`; !strings.Contains(got, want) {
+		t.Errorf("scrape after the family went = %q; want %s", got, want)
+	}
+}
+
+func TestGoneMetric(t *testing.T) {
+	for _, typ := range []dto.MetricType{
+		dto.MetricType_COUNTER, dto.MetricType_GAUGE, dto.MetricType_SUMMARY,
+		dto.MetricType_UNTYPED, dto.MetricType_HISTOGRAM,
+	} {
+		m := goneMetric(typ, nil)
+		var v float64
+		switch typ {
+		case dto.MetricType_COUNTER:
+			v = m.GetCounter().GetValue()
+		case dto.MetricType_GAUGE:
+			v = m.GetGauge().GetValue()
+		case dto.MetricType_SUMMARY:
+			v = m.GetSummary().GetSampleSum()
+		case dto.MetricType_UNTYPED:
+			v = m.GetUntyped().GetValue()
+		case dto.MetricType_HISTOGRAM:
+			v = m.GetHistogram().GetSampleSum()
+		}
+		if !math.IsNaN(v) {
+			t.Errorf("goneMetric(%v) = %v; want a NaN value", typ, m)
+		}
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"syscall"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var startupGrace = flag.Duration("startup-grace", 0, "For this long after startup, don't count failures to connect to sources that haven't connected yet as errors, as a gateway booting alongside the collector isn't ready straight away")
+var exitOnUnknownHost = flag.Bool("exit-on-unknown-host", false, "Exit if the host to connect to doesn't exist in DNS, rather than retrying")
+
+// unknownHostDelay is the backoff after a host is found not to exist, which
+// won't fix itself as quickly as a refused connection.
+const unknownHostDelay = time.Minute
+
+var dialErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "dial_errors_total",
+	Help:      "Failed connection attempts, by class: unknown_host, dns_temporary, timeout, refused or other",
+}, []string{"class"})
+
+var dialDuration = newDialDuration(prometheus.ExponentialBuckets(0.001, 2, 14))
+
+func newDialDuration(buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "sensors",
+		Name:      "dial_duration_seconds",
+		Help:      "Time taken to connect to a source, by endpoint, for successful connections only",
+		Buckets:   buckets,
+	}, []string{"endpoint"})
+}
+
+// timedDial connects to src with dial, observing how long it took in
+// sensors_dial_duration_seconds if it succeeds.
+func timedDial(src *source, dial dialFunc) (net.Conn, error) {
+	start := clk.Now()
+	conn, err := dial(src.endpoint)
+	if err == nil {
+		dialDuration.WithLabelValues(src.endpoint).Observe(clk.Now().Sub(start).Seconds())
+	}
+	return conn, err
+}
+
+var startupDialErrors = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "startup_dial_errors_total",
+	Help:      "Failed connection attempts within -startup-grace, not counted as errors",
+})
+
+// classifyDialError says what kind of failure a dial error was, as the
+// class label of sensors_dial_errors_total.
+func classifyDialError(err error) string {
+	var dnsErr *net.DNSError
+	if errors.As(err, &dnsErr) {
+		if dnsErr.IsNotFound {
+			return "unknown_host"
+		}
+		return "dns_temporary"
+	}
+	if errors.Is(err, syscall.ECONNREFUSED) {
+		return "refused"
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+	return "other"
+}
+
+// dialFailed counts and logs a failed dial of src, returning how long to
+// back off before the next.  An unknown host is a misconfiguration rather
+// than a network problem, so it backs off longer, or with
+// -exit-on-unknown-host, exits.  Failures before src has first connected,
+// within -startup-grace, are likely just the gateway still starting, and
+// are only counted apart and mentioned.
+func dialFailed(src *source, err error) time.Duration {
+	endpoint := src.endpoint
+	if src.inStartupGrace() {
+		startupDialErrors.Inc()
+		throttledLogf("connection error", "Not connected to %s yet, retrying: %v", endpoint, err)
+		return reconnectDelay
+	}
+	src.countError()
+	class := classifyDialError(err)
+	dialErrors.WithLabelValues(class).Inc()
+	if class == "unknown_host" {
+		if *exitOnUnknownHost {
+			log.Fatalf("The host of %s doesn't exist: %v", endpoint, err)
+		}
+		log.Printf("ERROR: the host of %s doesn't exist (%v); is it configured right?  Retrying in %v", endpoint, err, unknownHostDelay)
+		return unknownHostDelay
+	}
+	throttledLogf("connection error", "Error connecting to %s: %v", endpoint, err)
+	return reconnectDelay
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var discoveryFile = flag.String("discovery-file", "", "JSON file of extra labels for each device, by device label or raw id, as {\"<device>\": {\"room\": \"kitchen\"}}, and perhaps its \"thresholds\"; reloaded on SIGHUP")
+var discoveryLabels = flag.String("discovery-labels", "", "Comma-separated names of every label -discovery-file may set; devices without a value get an empty one")
+
+// discoveryLabelNames are -discovery-labels, split.
+var discoveryLabelNames []string
+
+// discovery holds the labels loaded from -discovery-file.
+var discovery atomic.Pointer[map[string]map[string]string]
+
+var labelNameRE = regexp.MustCompile(`^[a-zA-Z_][a-zA-Z0-9_]*$`)
+
+// checkDiscoveryLabels validates -discovery-labels.
+func checkDiscoveryLabels() error {
+	for _, name := range strings.Split(*discoveryLabels, ",") {
+		if name = strings.TrimSpace(name); name == "" {
+			continue
+		}
+		if !labelNameRE.MatchString(name) || strings.HasPrefix(name, "__") {
+			return fmt.Errorf("invalid label name %q", name)
+		}
+		switch name {
+		case "id", "device", "model", "metric":
+			return fmt.Errorf("label %q is the collector's own", name)
+		case "thresholds":
+			return fmt.Errorf("%q is reserved for devices' thresholds", name)
+		}
+		discoveryLabelNames = append(discoveryLabelNames, name)
+	}
+	return nil
+}
+
+// loadDiscovery reads a -discovery-file, which may only set the labels
+// named by -discovery-labels, returning them and the thresholds, by metric,
+// that devices may also have as "thresholds".
+func loadDiscovery(path string) (map[string]map[string]string, map[string]map[string]threshold, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	var raw map[string]map[string]json.RawMessage
+	if err := json.Unmarshal(b, &raw); err != nil {
+		return nil, nil, err
+	}
+	declared := map[string]bool{}
+	for _, name := range discoveryLabelNames {
+		declared[name] = true
+	}
+	d, ts := map[string]map[string]string{}, map[string]map[string]threshold{}
+	for device, fields := range raw {
+		d[device] = map[string]string{}
+		for name, v := range fields {
+			if name == "thresholds" {
+				var t map[string]threshold
+				if err := json.Unmarshal(v, &t); err != nil {
+					return nil, nil, fmt.Errorf("device %q: thresholds: %v", device, err)
+				}
+				if err := checkThresholds(fmt.Sprintf("device %q: thresholds", device), t); err != nil {
+					return nil, nil, err
+				}
+				ts[device] = t
+				continue
+			}
+			if !declared[name] {
+				return nil, nil, fmt.Errorf("device %q: label %q is not in -discovery-labels", device, name)
+			}
+			var label string
+			if err := json.Unmarshal(v, &label); err != nil {
+				return nil, nil, fmt.Errorf("device %q: label %q: %v", device, name, err)
+			}
+			d[device][name] = label
+		}
+		if len(d[device]) == 0 {
+			delete(d, device)
+		}
+	}
+	return d, ts, nil
+}
+
+// withDiscoveryLabels adds the -discovery-labels to a series' labels, with
+// the values -discovery-file gives its device, if any.
+func withDiscoveryLabels(labels prometheus.Labels) prometheus.Labels {
+	var found map[string]string
+	if d := discovery.Load(); d != nil {
+		if found = (*d)[labels["device"]]; found == nil {
+			found = (*d)[labels["id"]]
+		}
+	}
+	l := prometheus.Labels{}
+	for k, v := range labels {
+		l[k] = v
+	}
+	for _, name := range discoveryLabelNames {
+		l[name] = found[name]
+	}
+	return l
+}
+
+// reloadDiscovery rereads -discovery-file, relabelling every series and
+// replacing devices' thresholds, which take effect at the next evaluation.
+// Derived gauges that aren't series of their own, such as
+// sensors_battery_low, are dropped, and come back with their next sample.
+func reloadDiscovery() error {
+	d, ts, err := loadDiscovery(*discoveryFile)
+	if err != nil {
+		return err
+	}
+	seriesMu.Lock()
+	defer seriesMu.Unlock()
+	values := map[*series]float64{}
+	for _, s := range allSeries {
+		var m dto.Metric
+		if err := s.vec.With(s.vecLabels).Write(&m); err == nil {
+			values[s] = m.GetGauge().GetValue()
+		}
+		s.vec.Delete(s.vecLabels)
+	}
+	discovery.Store(&d)
+	deviceThresholds.Store(&ts)
+	for s, v := range values {
+		s.vec.With(s.vecLabels).Set(v)
+	}
+	for _, v := range []*sensorGaugeVec{batteryLowGauges, readErrorGauges, rawTemperatureGauges, windowMinGauges, windowMaxGauges, windowSampleGauges, unsmoothedGauges} {
+		v.get().Reset()
+	}
+	return nil
+}
+
+// reloadDiscoveryOnHUP reloads -discovery-file whenever a SIGHUP arrives,
+// keeping the old labels if the new file is bad.
+func reloadDiscoveryOnHUP() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		if err := reloadDiscovery(); err != nil {
+			log.Printf("Error reloading -discovery-file, keeping the old labels and thresholds: %v", err)
+			continue
+		}
+		log.Printf("Reloaded -discovery-file %s", *discoveryFile)
+	}
+}
@@ -0,0 +1,70 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"log"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var driftThreshold = flag.Float64("drift-threshold", 0, "If set, reconnect when more than this fraction of the last -drift-window lines didn't match any sample format")
+var driftWindow = flag.Int("drift-window", 100, "Number of recent lines -drift-threshold considers")
+
+var formatDriftReconnects = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "format_drift_reconnects_total",
+	Help:      "Reconnects forced because most recent lines were unrecognizable (-drift-threshold)",
+})
+
+var errFormatDrift = errors.New("too many unrecognizable lines")
+
+// driftDetector watches a sliding window of lines for a connection whose
+// output has stopped making sense, say after a firmware upgrade changed
+// the format, which otherwise just silently produces no data.
+type driftDetector struct {
+	window    []bool // true for unmatched lines; a ring
+	next      int
+	filled    bool
+	unmatched int
+}
+
+func newDriftDetector() *driftDetector {
+	if *driftThreshold <= 0 || *driftWindow <= 0 {
+		return nil
+	}
+	return &driftDetector{window: make([]bool, *driftWindow)}
+}
+
+// observe records whether a line matched, returning true once a full
+// window's unmatched fraction exceeds -drift-threshold.  A nil detector
+// never trips.
+func (d *driftDetector) observe(matched bool) bool {
+	if d == nil {
+		return false
+	}
+	if d.window[d.next] {
+		d.unmatched--
+	}
+	d.window[d.next] = !matched
+	if !matched {
+		d.unmatched++
+	}
+	d.next = (d.next + 1) % len(d.window)
+	if d.next == 0 {
+		d.filled = true
+	}
+	return d.filled && float64(d.unmatched) > *driftThreshold*float64(len(d.window))
+}
+
+// drifted records whether a line matched, returning true, for the scan
+// loop to reconnect, if the connection's format seems to have drifted.
+func (c *connection) drifted(matched bool) bool {
+	if !c.drift.observe(matched) {
+		return false
+	}
+	log.Printf("FORMAT DRIFT: over %.0f%% of the last %d lines from %s were unrecognizable; reconnecting",
+		100**driftThreshold, *driftWindow, c.src.endpoint)
+	formatDriftReconnects.Inc()
+	return true
+}
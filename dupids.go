@@ -0,0 +1,74 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var duplicateIDs = flag.String("duplicate-ids", "merge", "What to do about the same device ID reported by several sources: merge (into one series), prefix (device labels with the source endpoint) or first (keep only the first source's samples)")
+
+var duplicateIDCount = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "duplicate_ids_total",
+	Help:      "Times a device ID already reported by one source was reported by another",
+})
+
+// origin is when and from where a sample line came, as worked out by
+// noteSample for the record functions.
+type origin struct {
+	at  time.Time
+	src *source
+}
+
+// device returns the device label of a device's samples from o.
+func (o origin) device(ID, model string) string {
+	return o.prefixed(formatDevice(ID, model))
+}
+
+// prefixed returns device, prefixed with o's source endpoint per
+// -duplicate-ids=prefix.
+func (o origin) prefixed(device string) string {
+	if *duplicateIDs != "prefix" || o.src == nil {
+		return device
+	}
+	return o.src.endpoint + "/" + device
+}
+
+var (
+	idSourcesMu sync.Mutex
+	// idSources lists, by device ID, the endpoints of the sources that
+	// have reported it, the first first, until its series expire.
+	idSources = map[string][]string{}
+)
+
+// claimID notes a device ID reported by src, counting it if another source
+// has reported it too, and reports whether to keep its samples: with
+// -duplicate-ids=first, only those from the first source to report it.
+func claimID(ID string, src *source) bool {
+	ID = strings.ToLower(ID)
+	idSourcesMu.Lock()
+	defer idSourcesMu.Unlock()
+	endpoints := idSources[ID]
+	for _, e := range endpoints {
+		if e == src.endpoint {
+			return e == endpoints[0] || *duplicateIDs != "first"
+		}
+	}
+	if len(endpoints) > 0 {
+		duplicateIDCount.Inc()
+	}
+	idSources[ID] = append(endpoints, src.endpoint)
+	return len(endpoints) == 0 || *duplicateIDs != "first"
+}
+
+// releaseID forgets the sources of a device ID once its series are gone,
+// so that with -duplicate-ids=first another source can take it over.
+func releaseID(ID string) {
+	idSourcesMu.Lock()
+	delete(idSources, strings.ToLower(ID))
+	idSourcesMu.Unlock()
+}
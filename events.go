@@ -0,0 +1,130 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var eventWebhookURL = flag.String("event-webhook-url", "", "If set, POST device lifecycle events (device_seen, device_stale, sample_rejected) to this URL as JSON")
+var eventQueue = flag.Int("event-queue", 256, "Events to queue for a slow sink before dropping them")
+
+var (
+	eventsDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "sensors",
+		Name:      "events_dropped_total",
+		Help:      "Device lifecycle events dropped because the event sink was backed up",
+	})
+	eventErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "sensors",
+		Name:      "event_errors_total",
+		Help:      "Device lifecycle events the event sink failed to deliver",
+	})
+)
+
+// eventSink is told about device lifecycle events, for integrations.
+type eventSink interface {
+	// DeviceSeen is a device's first series being created, or with
+	// -stale-action=mark, a sample of a device whose series are all stale.
+	DeviceSeen(device, model string)
+	// DeviceStale is a device's last series expiring, or being marked
+	// stale.
+	DeviceStale(device, model string)
+	// SampleRejected is a sample from a device being dropped for reason.
+	SampleRejected(device, reason string)
+}
+
+// events is where events go; nopSink unless -event-webhook-url is set.
+var events eventSink = nopSink{}
+
+type nopSink struct{}
+
+func (nopSink) DeviceSeen(device, model string)      {}
+func (nopSink) DeviceStale(device, model string)     {}
+func (nopSink) SampleRejected(device, reason string) {}
+
+// asyncSink delivers events to next from a goroutine of its own, so a slow
+// sink doesn't hold up collection.  Events that don't fit in the queue are
+// dropped and counted.
+type asyncSink struct {
+	next  eventSink
+	queue chan func()
+}
+
+func newAsyncSink(next eventSink, size int) asyncSink {
+	a := asyncSink{next, make(chan func(), size)}
+	go func() {
+		for deliver := range a.queue {
+			deliver()
+		}
+	}()
+	return a
+}
+
+func (a asyncSink) enqueue(deliver func()) {
+	select {
+	case a.queue <- deliver:
+	default:
+		eventsDropped.Inc()
+	}
+}
+
+func (a asyncSink) DeviceSeen(device, model string) {
+	a.enqueue(func() { a.next.DeviceSeen(device, model) })
+}
+
+func (a asyncSink) DeviceStale(device, model string) {
+	a.enqueue(func() { a.next.DeviceStale(device, model) })
+}
+
+func (a asyncSink) SampleRejected(device, reason string) {
+	a.enqueue(func() { a.next.SampleRejected(device, reason) })
+}
+
+// webhookSink POSTs each event to a URL as a JSON object.
+type webhookSink struct {
+	url    string
+	client *http.Client
+}
+
+type webhookEvent struct {
+	Event  string    `json:"event"`
+	Device string    `json:"device"`
+	Model  string    `json:"model,omitempty"`
+	Reason string    `json:"reason,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
+func (w webhookSink) post(e webhookEvent) {
+	e.Time = clk.Now()
+	b, _ := json.Marshal(e)
+	resp, err := w.client.Post(w.url, "application/json", bytes.NewReader(b))
+	if err == nil {
+		resp.Body.Close()
+		if resp.StatusCode/100 != 2 {
+			err = fmt.Errorf("status %s", resp.Status)
+		}
+	}
+	if err != nil {
+		log.Printf("Error posting %s event to %s: %v", e.Event, w.url, err)
+		eventErrors.Inc()
+	}
+}
+
+func (w webhookSink) DeviceSeen(device, model string) {
+	w.post(webhookEvent{Event: "device_seen", Device: device, Model: model})
+}
+
+func (w webhookSink) DeviceStale(device, model string) {
+	w.post(webhookEvent{Event: "device_stale", Device: device, Model: model})
+}
+
+func (w webhookSink) SampleRejected(device, reason string) {
+	w.post(webhookEvent{Event: "sample_rejected", Device: device, Reason: reason})
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"container/heap"
+	"time"
+)
+
+// expiry is when a series is next due to be checked for staleness.
+type expiry struct {
+	key string
+	s   *series
+	due time.Time
+}
+
+// expiryQueue is a min-heap of expiries by due time, so each sweep only
+// looks at the series that might have gone stale rather than at all of
+// them.  Entries aren't updated as samples arrive; one found to be early
+// is requeued for its series' new due time instead.  It is guarded by
+// seriesMu.
+type expiryQueue []expiry
+
+func (q expiryQueue) Len() int            { return len(q) }
+func (q expiryQueue) Less(i, j int) bool  { return q[i].due.Before(q[j].due) }
+func (q expiryQueue) Swap(i, j int)       { q[i], q[j] = q[j], q[i] }
+func (q *expiryQueue) Push(x interface{}) { *q = append(*q, x.(expiry)) }
+
+func (q *expiryQueue) Pop() interface{} {
+	old := *q
+	e := old[len(old)-1]
+	*q = old[:len(old)-1]
+	return e
+}
+
+var expiries expiryQueue
+
+// queueExpiry schedules a new series' staleness check, if it has a TTL.
+// seriesMu must be held.
+func queueExpiry(key string, s *series, now time.Time) {
+	if s.ttl > 0 {
+		heap.Push(&expiries, expiry{key, s, now.Add(s.ttl)})
+	}
+}
+
+// expireDue deletes, or with -stale-action=mark marks, the series that
+// have gone their TTL without a sample as of now, returning how many.
+// seriesMu must be held.
+func expireDue(now time.Time) int {
+	n := 0
+	for len(expiries) > 0 && !expiries[0].due.After(now) {
+		e := heap.Pop(&expiries).(expiry)
+		if allSeries[e.key] != e.s {
+			// Already forgotten, say by /expire.
+			continue
+		}
+		if due := e.s.at.Add(e.s.ttl); due.After(now) {
+			heap.Push(&expiries, expiry{e.key, e.s, due})
+			continue
+		}
+		if *staleAction == "mark" {
+			e.s.markStale()
+		} else {
+			forgetSeries(e.key, e.s)
+			if deviceGone(e.s.labels["device"]) {
+				events.DeviceStale(e.s.labels["device"], e.s.labels["model"])
+			}
+		}
+		n++
+	}
+	return n
+}
+
+// markStale sets a series' gauge to -stale-value until its next sample,
+// which requeues its expiry.  A device whose series are all stale is as
+// good as gone to the event sink.  seriesMu must be held.
+func (s *series) markStale() {
+	s.stale = true
+	sink.SetGauge(s.metric, s.labels, *staleValue)
+	device := s.labels["device"]
+	if staleSeries[device]++; staleSeries[device] == deviceSeries[device] {
+		events.DeviceStale(device, s.labels["model"])
+	}
+}
+
+// unmarkStale notes a sample, or at least a sign of life, of a stale
+// series.  Its gauge gets a real value again once a sample's accepted.
+// seriesMu must be held.
+func (s *series) unmarkStale(key string, now time.Time) {
+	s.stale = false
+	device := s.labels["device"]
+	if staleSeries[device] == deviceSeries[device] {
+		events.DeviceSeen(device, s.labels["model"])
+	}
+	if staleSeries[device]--; staleSeries[device] == 0 {
+		delete(staleSeries, device)
+	}
+	queueExpiry(key, s, now)
+}
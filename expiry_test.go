@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+// forgetDevice forgets every series of device.
+func forgetDevice(device string) {
+	seriesMu.Lock()
+	defer seriesMu.Unlock()
+	for key, s := range allSeries {
+		if s.labels["device"] == device {
+			forgetSeries(key, s)
+		}
+	}
+}
+
+func TestExpireDue(t *testing.T) {
+	type step struct {
+		advance time.Duration
+		value   string // of a sample to send first, if any
+		expired int
+		want    float64 // or NaN if marked stale
+		present bool
+	}
+	for i, tt := range []struct {
+		name   string
+		action string
+		steps  []step
+	}{
+		{"delete", "delete", []step{
+			{0, "70.5", 0, 21.4, true},
+			{30 * time.Second, "", 0, 21.4, true},
+			{30 * time.Second, "", 1, 0, false},
+			{time.Hour, "", 0, 0, false},
+		}},
+		{"requeued", "delete", []step{
+			{0, "70.5", 0, 21.4, true},
+			{40 * time.Second, "71.5", 0, 21.9, true},
+			{30 * time.Second, "", 0, 21.9, true},
+			{30 * time.Second, "", 1, 0, false},
+		}},
+		{"mark", "mark", []step{
+			{0, "70.5", 0, 21.4, true},
+			{time.Minute, "", 1, math.NaN(), true},
+			{time.Hour, "", 0, math.NaN(), true},
+			{10 * time.Second, "71.5", 0, 21.9, true},
+			{59 * time.Second, "", 0, 21.9, true},
+			{time.Second, "", 1, math.NaN(), true},
+		}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, "stale-ttl", "1m")
+			setFlag(t, "stale-action", tt.action)
+			c := newFakeClock()
+			setClock(t, c)
+			id := "28ff0a1b2c6" + string(rune('0'+i))
+			device := formatDevice(id, "DS18B20")
+			t.Cleanup(func() { forgetDevice(device) })
+			conn := testConnection(t)
+			for j, st := range tt.steps {
+				c.Advance(st.advance)
+				if st.value != "" && !processLine("100 temp "+id+" DS18B20 "+st.value, conn) {
+					t.Fatalf("step %d: sample didn't match", j)
+				}
+				seriesMu.Lock()
+				n := expireDue(c.Now())
+				seriesMu.Unlock()
+				if n != st.expired {
+					t.Errorf("step %d: expireDue = %d; want %d", j, n, st.expired)
+				}
+				v, ok := gaugeValue(temperatureGauges, device)
+				switch {
+				case ok != st.present:
+					t.Errorf("step %d: gauge present = %v; want %v", j, ok, st.present)
+				case math.IsNaN(st.want) && !math.IsNaN(v), !math.IsNaN(st.want) && ok && v != st.want:
+					t.Errorf("step %d: gauge = %v; want %v", j, v, st.want)
+				}
+			}
+		})
+	}
+}
+
+func TestMarkStaleCountsDevices(t *testing.T) {
+	setFlag(t, "stale-ttl", "1m")
+	setFlag(t, "stale-action", "mark")
+	c := newFakeClock()
+	setClock(t, c)
+	// Series left from other tests were made without a TTL.
+	forgetDevice("dht22")
+	t.Cleanup(func() { forgetDevice("dht22") })
+	conn := testConnection(t)
+	if !processLine("100 humidity DHT22 45.2 70.5", conn) {
+		t.Fatal("sample didn't match")
+	}
+	c.Advance(time.Minute)
+	seriesMu.Lock()
+	n := expireDue(c.Now())
+	stale, all := staleSeries["dht22"], deviceSeries["dht22"]
+	seriesMu.Unlock()
+	if n != 2 || stale != 2 || all != 2 {
+		t.Fatalf("expireDue = %d, with %d of %d series stale; want 2 of 2", n, stale, all)
+	}
+	processLine("100 humidity DHT22 45.3 70.6", conn)
+	seriesMu.Lock()
+	_, stillStale := staleSeries["dht22"]
+	seriesMu.Unlock()
+	if stillStale {
+		t.Error("a fresh sample didn't unmark the device's series")
+	}
+}
+
+func BenchmarkExpireDueIdle(b *testing.B) {
+	setFlag(b, "stale-ttl", "1h")
+	c := newFakeClock()
+	setClock(b, c)
+	conn := testConnection(b)
+	var devices []string
+	for i := 0; i < 10000; i++ {
+		id := fmt.Sprintf("28%012x", i)
+		processLine("100 temp "+id+" DS18B20 70.5", conn)
+		devices = append(devices, formatDevice(id, "DS18B20"))
+	}
+	b.Cleanup(func() {
+		for _, d := range devices {
+			forgetDevice(d)
+		}
+	})
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		seriesMu.Lock()
+		expireDue(c.Now())
+		seriesMu.Unlock()
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"flag"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var maxExportAge = flag.Duration("max-export-age", 0, "If set, leave sensor series out of scrapes once they go this long without a sample, without deleting them as -stale-ttl does")
+
+// labelsKey identifies a gauge of a vec by its label values.
+func labelsKey(labels prometheus.Labels) string {
+	names := make([]string, 0, len(labels))
+	for name := range labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	for _, name := range names {
+		b.WriteString(name + "=" + labels[name] + "\xff")
+	}
+	return b.String()
+}
+
+// collectSeries collects only those of v's gauges that some series has
+// updated within -max-export-age, if set, with -export-timestamps timed by
+// the latest sample of the series updating them.  Gauges that aren't a
+// series' own, such as sensors_battery_low, are collected regardless, and
+// untimed.
+func (v *sensorGaugeVec) collectSeries(ch chan<- prometheus.Metric) {
+	// Of the series updating each gauge, the latest to, which with
+	// -label-set=minimal may be any of several.
+	latest, tracked := map[string]*series{}, map[string]bool{}
+	now := clk.Now()
+	seriesMu.Lock()
+	for _, s := range allSeries {
+		if s.vec != v {
+			continue
+		}
+		key := labelsKey(exported(s.vecLabels))
+		tracked[key] = true
+		if *maxExportAge > 0 && now.Sub(s.at) > *maxExportAge {
+			continue
+		}
+		if l := latest[key]; l == nil || s.at.After(l.at) {
+			latest[key] = s
+		}
+	}
+	sampled := map[string]time.Time{}
+	for key, s := range latest {
+		sampled[key] = s.sampled
+	}
+	seriesMu.Unlock()
+
+	metrics := make(chan prometheus.Metric)
+	go func() {
+		v.get().Collect(metrics)
+		close(metrics)
+	}()
+	for m := range metrics {
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			continue
+		}
+		labels := prometheus.Labels{}
+		for _, l := range pb.Label {
+			labels[l.GetName()] = l.GetValue()
+		}
+		key := labelsKey(labels)
+		at, fresh := sampled[key]
+		switch {
+		case !tracked[key]:
+			ch <- m
+		case !fresh:
+		case *exportTimestamps && !at.IsZero():
+			ch <- prometheus.NewMetricWithTimestamp(exportedTime(at), m)
+		default:
+			ch <- m
+		}
+	}
+}
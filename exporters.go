@@ -0,0 +1,182 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	exportErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sensors",
+		Name:      "export_errors_total",
+		Help:      "Failed writes by each exporter, such as graphite or influxdb",
+	}, []string{"exporter"})
+	exportedPoints = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sensors",
+		Name:      "exported_points_total",
+		Help:      "Points written by each exporter, such as graphite or influxdb",
+	}, []string{"exporter"})
+)
+
+// point is the latest value of a series for an exporter, and when it was
+// taken.
+type point struct {
+	name   string
+	labels prometheus.Labels
+	v      float64
+	at     time.Time
+}
+
+// bufferSink is a metricSink for exporters that write on an interval,
+// holding the latest point of each series updated since the last write.
+// Counters and histograms are kept as running totals, the latter as its
+// name with _count and _sum, as the backends have no such types.  NaN and
+// infinite values, such as -stale-value's default, are left out, as
+// neither backend accepts them.
+type bufferSink struct {
+	mu      sync.Mutex
+	points  map[string]point
+	totals  map[string]float64
+	pending []point // ones a failed write is to retry
+}
+
+func newBufferSink() *bufferSink {
+	return &bufferSink{points: map[string]point{}, totals: map[string]float64{}}
+}
+
+// pointKey identifies a series of name by all of its labels.
+func pointKey(name string, labels prometheus.Labels) string {
+	names := make([]string, 0, len(labels))
+	for k := range labels {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var b strings.Builder
+	b.WriteString(name)
+	for _, k := range names {
+		b.WriteString("\xff" + k + "=" + labels[k])
+	}
+	return b.String()
+}
+
+func (b *bufferSink) SetGauge(name string, labels prometheus.Labels, v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	b.mu.Lock()
+	b.points[pointKey(name, labels)] = point{name, labels, v, clk.Now()}
+	b.mu.Unlock()
+}
+
+func (b *bufferSink) IncCounter(name string, labels prometheus.Labels, delta float64) {
+	if math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return
+	}
+	b.mu.Lock()
+	b.add(name, labels, delta)
+	b.mu.Unlock()
+}
+
+func (b *bufferSink) ObserveHistogram(name string, labels prometheus.Labels, v float64) {
+	if math.IsNaN(v) || math.IsInf(v, 0) {
+		return
+	}
+	b.mu.Lock()
+	b.add(name+"_count", labels, 1)
+	b.add(name+"_sum", labels, v)
+	b.mu.Unlock()
+}
+
+// add adds delta to a total and takes it as the series' latest point.
+// b.mu must be held.
+func (b *bufferSink) add(name string, labels prometheus.Labels, delta float64) {
+	key := pointKey(name, labels)
+	b.totals[key] += delta
+	b.points[key] = point{name, labels, b.totals[key], clk.Now()}
+}
+
+// take returns the points to write, those of a failed write first.
+func (b *bufferSink) take() []point {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	ps := b.pending
+	b.pending = nil
+	for _, p := range b.points {
+		ps = append(ps, p)
+	}
+	b.points = map[string]point{}
+	return ps
+}
+
+// retry keeps points whose write failed for the next, up to max of them,
+// dropping the oldest beyond that.
+func (b *bufferSink) retry(ps []point, max int) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if len(ps) > max {
+		ps = ps[len(ps)-max:]
+	}
+	b.pending = ps
+}
+
+// maxPendingPoints bounds the points kept for retrying by each exporter
+// while its backend is unreachable.
+const maxPendingPoints = 100000
+
+// exporter is a backend written to from a bufferSink every interval.
+type exporter struct {
+	name     string
+	target   string
+	interval time.Duration
+	sink     *bufferSink
+	write    func(ps []point) error
+}
+
+// exporters are those configured, each fed from sink by main.
+var exporters []*exporter
+
+// addExporter configures an exporter, pre-creating its metrics.
+func addExporter(name, target string, interval time.Duration, write func([]point) error) {
+	exportErrors.WithLabelValues(name)
+	exportedPoints.WithLabelValues(name)
+	exporters = append(exporters, &exporter{name, target, interval, newBufferSink(), write})
+}
+
+// rejectedError is a failed write that the backend refused outright, so
+// retrying its points wouldn't help.
+type rejectedError struct{ error }
+
+// run writes e's points every interval.  A failed write is logged and
+// counted, and unless rejected, its points are retried with the next, so
+// exporters fail independently of each other and of the rest of the
+// collector.
+func (e *exporter) run() {
+	for range tick(e.interval) {
+		e.flush()
+	}
+}
+
+func (e *exporter) flush() {
+	ps := e.sink.take()
+	if len(ps) == 0 {
+		return
+	}
+	if err := e.write(ps); err != nil {
+		log.Printf("Error exporting to %s %s: %v", e.name, e.target, err)
+		exportErrors.WithLabelValues(e.name).Inc()
+		if errors.As(err, new(rejectedError)) {
+			log.Printf("Dropping %d points %s rejected", len(ps), e.name)
+			return
+		}
+		e.sink.retry(ps, maxPendingPoints)
+		return
+	}
+	exportedPoints.WithLabelValues(e.name).Add(float64(len(ps)))
+}
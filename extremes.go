@@ -0,0 +1,60 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var exportExtremes = flag.Bool("extremes", false, "Also export the lowest and highest sample of each series since it appeared")
+var extremeHalfLife = flag.Duration("extreme-half-life", 0, "With -extremes, decay each extreme halfway toward the latest sample every this often, rather than keep it forever")
+
+var (
+	extremeMinGauges = newSensorGaugeVec(prometheus.GaugeOpts{Namespace: "sensors", Name: "extreme_min", Help: "Lowest sample of a series, decayed by -extreme-half-life if set"}, windowLabels)
+	extremeMaxGauges = newSensorGaugeVec(prometheus.GaugeOpts{Namespace: "sensors", Name: "extreme_max", Help: "Highest sample of a series, decayed by -extreme-half-life if set"}, windowLabels)
+)
+
+// extremeLabels returns the labels of a series' extremes, which are
+// those of the series plus its metric.
+func (s *series) extremeLabels() prometheus.Labels {
+	l := prometheus.Labels{"metric": s.metric}
+	for k, v := range s.labels {
+		l[k] = v
+	}
+	return l
+}
+
+// noteExtremes updates and exports s's extremes with a sample.  With
+// -extreme-half-life, each first relaxes toward the sample by how long
+// it's been since the last, so that a one-off spike fades away where a
+// lifetime extreme would stick.  seriesMu must be held.
+func (s *series) noteExtremes(v float64, now time.Time) {
+	if !*exportExtremes {
+		return
+	}
+	if s.extremeAt.IsZero() {
+		s.lo, s.hi = v, v
+	} else if *extremeHalfLife > 0 {
+		decay := math.Exp2(-float64(now.Sub(s.extremeAt)) / float64(*extremeHalfLife))
+		s.lo = v + (s.lo-v)*decay
+		s.hi = v + (s.hi-v)*decay
+	}
+	s.lo = math.Min(s.lo, v)
+	s.hi = math.Max(s.hi, v)
+	s.extremeAt = now
+	l := s.extremeLabels()
+	extremeMinGauges.With(l).Set(s.lo)
+	extremeMaxGauges.With(l).Set(s.hi)
+}
+
+// forgetExtremes deletes s's extremes along with it.
+func (s *series) forgetExtremes() {
+	if s.extremeAt.IsZero() {
+		return
+	}
+	l := s.extremeLabels()
+	extremeMinGauges.Delete(l)
+	extremeMaxGauges.Delete(l)
+}
@@ -0,0 +1,129 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var sourceStrategy = flag.String("source-strategy", "all", "With several -connect endpoints: all, to read from every one at once, or failover, to read only from the first that works, going back to earlier ones once they recover")
+var failoverProbeInterval = flag.Duration("failover-probe-interval", 30*time.Second, "With -source-strategy=failover, how often to check whether the primary endpoint is back while using another")
+
+var activeEndpoint = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "sensors",
+	Name:      "active_endpoint",
+	Help:      "With -source-strategy=failover, 1 for the endpoint currently read from, else 0",
+}, []string{"endpoint"})
+
+// connectEndpoints returns -connect's endpoints.
+func connectEndpoints(spec string) []string {
+	var endpoints []string
+	for _, e := range strings.Split(spec, ",") {
+		if e = strings.TrimSpace(e); e != "" {
+			endpoints = append(endpoints, e)
+		}
+	}
+	return endpoints
+}
+
+// setActive marks srcs[active] as the active endpoint, or none if -1.
+func setActive(srcs []*source, active int) {
+	for i, s := range srcs {
+		v := 0.
+		if i == active {
+			v = 1
+		}
+		activeEndpoint.WithLabelValues(s.endpoint).Set(v)
+	}
+}
+
+// redialFailover reads from the first of srcs it can connect to, in order.
+// Failing to connect moves on to the next; a connection that ends is
+// redialled first.  While on a fallback, the primary is probed every
+// -failover-probe-interval, and the fallback dropped once it answers.
+func redialFailover(srcs []*source, dial dialFunc) {
+	clk.Sleep(*startupDelay)
+	if *waitForNetwork > 0 {
+		awaitResolvable(srcs[0].endpoint, *waitForNetwork)
+	}
+	setActive(srcs, -1)
+	connectNums := make([]int, len(srcs))
+	var lastAttempt time.Time
+	for i := 0; ; {
+		if wait := lastAttempt.Add(*minConnectInterval).Sub(clk.Now()); wait > 0 {
+			clk.Sleep(wait)
+		}
+		lastAttempt = clk.Now()
+		src := srcs[i]
+		src.countAttempt()
+		conn, err := timedDial(src, dial)
+		if err != nil {
+			delay := dialFailed(src, err)
+			if i = (i + 1) % len(srcs); i == 0 {
+				// All failed; back off before starting over.
+				src.fail(delay)
+			} else {
+				src.fail(0)
+			}
+			continue
+		}
+		connectNums[i]++
+		setActive(srcs, i)
+		var promoted <-chan struct{}
+		stop := make(chan struct{})
+		if i > 0 {
+			promoted = probePrimary(srcs[0], src, conn, dial, stop)
+		}
+		failed := session(src, conn, connectNums[i])
+		close(stop)
+		setActive(srcs, -1)
+		select {
+		case <-promoted:
+			src.disconnected(0)
+			i = 0
+			continue
+		default:
+		}
+		if failed {
+			src.fail(reconnectDelay)
+		} else {
+			src.disconnected(0)
+		}
+	}
+}
+
+// probePrimary dials primary every -failover-probe-interval until stop is
+// closed.  Once it answers, the returned channel is closed and conn, the
+// connection to fallback, is closed to end its session.
+func probePrimary(primary, fallback *source, conn net.Conn, dial dialFunc, stop <-chan struct{}) <-chan struct{} {
+	promoted := make(chan struct{})
+	var once sync.Once
+	go func() {
+		ticks, stopTicks := clk.NewTicker(*failoverProbeInterval)
+		defer stopTicks()
+		for {
+			select {
+			case <-stop:
+				return
+			case <-ticks:
+			}
+			probe, err := dial(primary.endpoint)
+			if err != nil {
+				continue
+			}
+			probe.Close()
+			once.Do(func() {
+				log.Printf("%s is back; switching to it from %s", primary.endpoint, fallback.endpoint)
+				close(promoted)
+				conn.Close()
+			})
+			return
+		}
+	}()
+	return promoted
+}
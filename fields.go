@@ -0,0 +1,35 @@
+package main
+
+import (
+	"flag"
+	"strings"
+)
+
+var fieldDelimiter = flag.String("field-delimiter", "", `Delimiter between fields of a sample line, with \t etc. escapes honored; empty splits on runs of whitespace`)
+
+var sampleSeparator = flag.String("sample-separator", "", "If set, separator between several samples on one line, each parsed on its own")
+
+// splitSamples breaks a line holding several samples, as some gateways send
+// when they coalesce readings, into one string per sample.
+func splitSamples(t string) []string {
+	if *sampleSeparator == "" {
+		return []string{t}
+	}
+	return strings.Split(t, commandUnescaper.Replace(*sampleSeparator))
+}
+
+// splitFields breaks a line into fields on -field-delimiter, ignoring
+// surrounding whitespace and empty fields so irregular spacing still
+// parses.
+func splitFields(t string) []string {
+	if *fieldDelimiter == "" {
+		return strings.Fields(t)
+	}
+	var fields []string
+	for _, f := range strings.Split(t, commandUnescaper.Replace(*fieldDelimiter)) {
+		if f = strings.TrimSpace(f); f != "" {
+			fields = append(fields, f)
+		}
+	}
+	return fields
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestSplitFields(t *testing.T) {
+	for _, tt := range []struct {
+		delimiter string
+		line      string
+		want      []string
+	}{
+		{"", "100 temp 28ff0a1b2c3d DS18B20 70.5", []string{"100", "temp", "28ff0a1b2c3d", "DS18B20", "70.5"}},
+		{"", " 100\ttemp  28ff0a1b2c3d DS18B20 70.5 \r", []string{"100", "temp", "28ff0a1b2c3d", "DS18B20", "70.5"}},
+		{",", "100,temp,28ff0a1b2c3d,DS18B20,70.5", []string{"100", "temp", "28ff0a1b2c3d", "DS18B20", "70.5"}},
+		{",", "100, temp ,,28ff0a1b2c3d,DS18B20,70.5,", []string{"100", "temp", "28ff0a1b2c3d", "DS18B20", "70.5"}},
+		{`\t`, "100\ttemp\t28ff0a1b2c3d\tDS18B20\t70.5", []string{"100", "temp", "28ff0a1b2c3d", "DS18B20", "70.5"}},
+		{";", "100 temp;28ff0a1b2c3d", []string{"100 temp", "28ff0a1b2c3d"}},
+		{"", "", nil},
+		{",", ",,", nil},
+	} {
+		setFlag(t, "field-delimiter", tt.delimiter)
+		if got := splitFields(tt.line); len(got) > 0 && !reflect.DeepEqual(got, tt.want) || len(got) != len(tt.want) {
+			t.Errorf("with -field-delimiter=%q, splitFields(%q) = %q; want %q", tt.delimiter, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestFieldDelimiterLines(t *testing.T) {
+	setFlag(t, "field-delimiter", ",")
+	temperatureGauges.get().Reset()
+	if !processLine("100,temp,28ff0a1b2c01,DS18B20,70.5", testConnection(t)) {
+		t.Fatal("comma-delimited line didn't match")
+	}
+	if v, ok := gaugeValue(temperatureGauges, "ds18b20-00ff0a1b2c01"); !ok || v != 21.4 {
+		t.Errorf("temperature = %v, %v; want 21.4", v, ok)
+	}
+}
+
+func TestSplitSamples(t *testing.T) {
+	for _, tt := range []struct {
+		separator string
+		line      string
+		want      []string
+	}{
+		{"", "100 temp 28ff0a1b2c3d DS18B20 70.5;101 temp 28ff0a1b2c3e DS18B20 71.5", []string{"100 temp 28ff0a1b2c3d DS18B20 70.5;101 temp 28ff0a1b2c3e DS18B20 71.5"}},
+		{";", "100 temp 28ff0a1b2c3d DS18B20 70.5;101 temp 28ff0a1b2c3e DS18B20 71.5", []string{"100 temp 28ff0a1b2c3d DS18B20 70.5", "101 temp 28ff0a1b2c3e DS18B20 71.5"}},
+		{" | ", "a | b | c", []string{"a", "b", "c"}},
+		{`\t`, "a\tb", []string{"a", "b"}},
+		{";", "a;", []string{"a", ""}},
+	} {
+		setFlag(t, "sample-separator", tt.separator)
+		if got := splitSamples(tt.line); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("with -sample-separator=%q, splitSamples(%q) = %q; want %q", tt.separator, tt.line, got, tt.want)
+		}
+	}
+}
+
+func TestMultiSampleLines(t *testing.T) {
+	setFlag(t, "sample-separator", ";")
+	temperatureGauges.get().Reset()
+	c := testConnection(t)
+	if err := processMessage("100 temp 28ff0a1b2c04 DS18B20 70.5;101 temp 28ff0a1b2c05 DS18B20 71.5;", c); err != nil {
+		t.Fatalf("processMessage: %v", err)
+	}
+	for device, want := range map[string]float64{"ds18b20-00ff0a1b2c04": 21.4, "ds18b20-00ff0a1b2c05": 21.9} {
+		if v, ok := gaugeValue(temperatureGauges, device); !ok || v != want {
+			t.Errorf("%s = %v, %v; want %v", device, v, ok, want)
+		}
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+)
+
+var fifo = flag.String("fifo", "", "Read samples from this named pipe instead of -connect, reopening it whenever the writer closes it")
+
+// checkFIFO makes sure path is an existing named pipe, so a typo fails at
+// startup instead of leaving the collector waiting forever.
+func checkFIFO(path string) error {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return fmt.Errorf("%v (create it with mkfifo)", err)
+	}
+	if fi.Mode()&os.ModeNamedPipe == 0 {
+		return fmt.Errorf("%s is not a named pipe", path)
+	}
+	return nil
+}
+
+// readFIFO reads samples from the named pipe at path.  Opening it blocks
+// until a writer appears, and the writer closing it is an EOF, after which
+// it is reopened to wait for the next writer.
+func readFIFO(src *source, path string) {
+	openNum := 0
+	for {
+		f, err := os.Open(path)
+		if err != nil {
+			throttledLogf("connection error", "Error opening %s: %v", path, err)
+			src.fail(reconnectDelay)
+			continue
+		}
+		openNum++
+		if openNum == 1 || !*quietReconnects {
+			log.Printf("Opened %s (writer %d)", path, openNum)
+		}
+		src.setConnected(openNum, f)
+		err = scan(f, newConnection(src, openNum))
+		f.Close()
+		if err != nil {
+			throttledLogf("connection error", "Read failed from %s: %v", path, err)
+			src.fail(reconnectDelay)
+		} else {
+			src.disconnected(0)
+		}
+	}
+}
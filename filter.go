@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// deviceFilter matches devices against a comma-separated list of IDs or
+// regular expressions.  Each entry must match the whole of either the raw
+// ID or the formatted device name; plain IDs are just regexes that only
+// match themselves.
+type deviceFilter []*regexp.Regexp
+
+func parseDeviceFilter(spec string) (deviceFilter, error) {
+	var f deviceFilter
+	for _, entry := range strings.Split(spec, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		re, err := regexp.Compile(`^(?i)(?:` + entry + `)$`)
+		if err != nil {
+			return nil, fmt.Errorf("bad device filter entry %q: %v", entry, err)
+		}
+		f = append(f, re)
+	}
+	return f, nil
+}
+
+func (f deviceFilter) matches(ID, device string) bool {
+	for _, re := range f {
+		if re.MatchString(ID) || re.MatchString(device) {
+			return true
+		}
+	}
+	return false
+}
+
+var allowedDevices, deniedDevices deviceFilter
+
+// deviceAllowed reports whether samples from a device should be recorded,
+// counting the reason if not.  An empty allowlist allows everything; the
+// denylist takes precedence over the allowlist.
+func deviceAllowed(ID, device string) bool {
+	if len(allowedDevices) > 0 && !allowedDevices.matches(ID, device) {
+		skipSample("not_allowed", device)
+		return false
+	}
+	if deniedDevices.matches(ID, device) {
+		skipSample("denied", device)
+		return false
+	}
+	return true
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"regexp"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var firmwareRegexp = flag.String("firmware-regexp", "", "If set, a regexp whose first group is the gateway's firmware version, for sensors_gateway_firmware_info, matched against the banner lines -header-regexp identifies")
+
+var (
+	firmwareInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "sensors",
+		Name:      "gateway_firmware_info",
+		Help:      "1 for the firmware version in the latest banner from each source, per -firmware-regexp",
+	}, []string{"endpoint", "version"})
+	bannerParseFailures = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sensors",
+		Name:      "banner_parse_failures_total",
+		Help:      "Banner lines from each source that -firmware-regexp found no version in",
+	}, []string{"endpoint"})
+)
+
+// firmwareRE is -firmware-regexp, compiled; nil if unset.
+var firmwareRE *regexp.Regexp
+
+var (
+	firmwareMu sync.Mutex
+	// firmwareVersions are, by endpoint, the versions in firmwareInfo.
+	firmwareVersions = map[string]string{}
+)
+
+// noteBanner takes the firmware version of c's source from a banner line,
+// replacing any version seen before, or counts the line if there's none
+// in it.
+func (c *connection) noteBanner(line string) {
+	if firmwareRE == nil {
+		return
+	}
+	endpoint := c.src.endpoint
+	m := firmwareRE.FindStringSubmatch(line)
+	if len(m) < 2 || m[1] == "" {
+		bannerParseFailures.WithLabelValues(endpoint).Inc()
+		return
+	}
+	firmwareMu.Lock()
+	defer firmwareMu.Unlock()
+	if prev, ok := firmwareVersions[endpoint]; ok && prev != m[1] {
+		firmwareInfo.DeleteLabelValues(endpoint, prev)
+	}
+	firmwareVersions[endpoint] = m[1]
+	firmwareInfo.WithLabelValues(endpoint, m[1]).Set(1)
+}
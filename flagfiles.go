@@ -0,0 +1,67 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+)
+
+// expandFlagFiles returns command-line arguments with flag values given
+// as @file replaced by the contents of the file, less a trailing newline,
+// so secrets such as -socks5-password needn't be in argv, where any user
+// can see them.  A value starting @@ stands for itself less the first @.
+// Arguments are scanned as flag.Parse would, up to the first that isn't a
+// flag, and those it would reject are left for it to.
+func expandFlagFiles(args []string) ([]string, error) {
+	args = append([]string(nil), args...)
+	for i := 0; i < len(args); i++ {
+		a := args[i]
+		if a == "--" || len(a) < 2 || a[0] != '-' {
+			break
+		}
+		name, value, hasValue := strings.Cut(strings.TrimPrefix(a[1:], "-"), "=")
+		if hasValue {
+			v, err := readFlagFile(name, value)
+			if err != nil {
+				return nil, err
+			}
+			args[i] = a[:len(a)-len(value)] + v
+			continue
+		}
+		f := flag.Lookup(name)
+		if f == nil || isBoolFlag(f) || i+1 == len(args) {
+			continue
+		}
+		i++
+		v, err := readFlagFile(name, args[i])
+		if err != nil {
+			return nil, err
+		}
+		args[i] = v
+	}
+	return args, nil
+}
+
+// readFlagFile returns the value of flag name given as value, reading it
+// from a file if it's @file.
+func readFlagFile(name, value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, "@@"):
+		return value[1:], nil
+	case !strings.HasPrefix(value, "@"):
+		return value, nil
+	}
+	b, err := os.ReadFile(value[1:])
+	if err != nil {
+		return "", fmt.Errorf("-%s: %v", name, err)
+	}
+	v := strings.TrimSuffix(string(b), "\n")
+	return strings.TrimSuffix(v, "\r"), nil
+}
+
+// isBoolFlag reports whether f takes no value, as -flag alone sets it.
+func isBoolFlag(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return ok && b.IsBoolFlag()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"net"
+	"sort"
+	"strings"
+	"time"
+)
+
+var graphiteAddr = flag.String("graphite-addr", "", "If set, write sensor samples to this Graphite (Carbon plaintext) host:port every -graphite-interval, as tagged series")
+var graphitePrefix = flag.String("graphite-prefix", "sensors", "What Graphite series names start with, before the metric name")
+var graphiteInterval = flag.Duration("graphite-interval", 30*time.Second, "How often to write to -graphite-addr")
+
+// graphiteTagEscaper replaces what Graphite tag values can't contain.
+var graphiteTagEscaper = strings.NewReplacer(";", "_", "~", "_", " ", "_", "\t", "_", "\n", "_")
+
+// writeGraphite writes points to -graphite-addr in a connection of their
+// own, one line each, as "<prefix>.<name>;<label>=<value>... <value>
+// <time>".  Empty labels are left out, as Graphite doesn't allow them.
+func writeGraphite(ps []point) error {
+	conn, err := net.DialTimeout("tcp", *graphiteAddr, *connectTimeout)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetDeadline(clk.Now().Add(*graphiteInterval))
+	w := bufio.NewWriter(conn)
+	for _, p := range ps {
+		fmt.Fprintf(w, "%s.%s", *graphitePrefix, p.name)
+		names := make([]string, 0, len(p.labels))
+		for k := range p.labels {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			if v := p.labels[k]; v != "" {
+				fmt.Fprintf(w, ";%s=%s", k, graphiteTagEscaper.Replace(v))
+			}
+		}
+		fmt.Fprintf(w, " %g %d\n", p.v, p.at.Unix())
+	}
+	return w.Flush()
+}
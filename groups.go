@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"math"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var groupMaxAge = flag.Duration("group-max-age", 5*time.Minute, "Leave sensor_groups members out of their group's spread once they go this long without a temperature sample")
+
+var groupSpreadDesc = prometheus.NewDesc("sensors_group_spread_degrees_celsius",
+	"Difference between the highest and lowest temperatures of each of the -config sensor_groups", []string{"group"}, nil)
+
+// groupSpreadCollector exports, at scrape time, the spread between the
+// latest temperatures of the members of each sensor group, such as
+// redundant sensors in the same place.  A group is left out if fewer than
+// two of its members have fresh samples, as there's nothing to compare.
+type groupSpreadCollector struct{}
+
+func (groupSpreadCollector) Describe(ch chan<- *prometheus.Desc) { ch <- groupSpreadDesc }
+
+func (groupSpreadCollector) Collect(ch chan<- prometheus.Metric) {
+	seriesMu.Lock()
+	defer seriesMu.Unlock()
+	now := clk.Now()
+	for group, members := range cfg.SensorGroups {
+		in := map[string]bool{}
+		for _, m := range members {
+			in[m] = true
+		}
+		min, max, n := math.Inf(1), math.Inf(-1), 0
+		for _, s := range allSeries {
+			if s.metric != "temperature_degrees_celsius" || !in[s.labels["device"]] && !in[s.labels["id"]] || now.Sub(s.at) > *groupMaxAge {
+				continue
+			}
+			min, max, n = math.Min(min, s.value), math.Max(max, s.value), n+1
+		}
+		if n >= 2 {
+			ch <- prometheus.MustNewConstMetric(groupSpreadDesc, prometheus.GaugeValue, max-min, group)
+		}
+	}
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var heartbeatToken = flag.String("heartbeat-token", "", "A line, such as \".\", that the gateway sends as a heartbeat; blank lines always are one")
+
+var lastHeartbeat = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	Namespace: "sensors",
+	Name:      "last_heartbeat_timestamp_seconds",
+	Help:      "When each source last sent a heartbeat: a blank line, or -heartbeat-token",
+}, []string{"endpoint"})
+
+// heartbeat reports whether a message read on c, once decoded, is a
+// heartbeat, noting when if so.  It's checked ahead of line filters and
+// checksums, which heartbeats needn't satisfy, and of splitting messages
+// into lines and samples, whose empty leftovers aren't heartbeats: only a
+// message that's wholly blank, or -heartbeat-token, is.
+func (c *connection) heartbeat(msg string) bool {
+	if msg != "" && (*heartbeatToken == "" || strings.TrimSpace(msg) != *heartbeatToken) {
+		return false
+	}
+	lastHeartbeat.WithLabelValues(c.src.endpoint).Set(float64(clk.Now().UnixNano()) / 1e9)
+	return true
+}
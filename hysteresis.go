@@ -0,0 +1,45 @@
+package main
+
+import (
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	flagStatesMu sync.Mutex
+	// flagStates holds the threshold flags that are set, by metric and
+	// labels.
+	flagStates = map[string]bool{}
+)
+
+// thresholdFlag reports whether a flag metric such as sensors_battery_low
+// is set for the series with the given labels, given its latest value.  It
+// is set once the value goes below threshold (or above, if !below), and
+// clears only once the value is back past it by the metric's margin in
+// flag_hysteresis, so a value hovering at the threshold doesn't flap.
+func thresholdFlag(metric string, labels prometheus.Labels, v, threshold float64, below bool) bool {
+	key := metric + "\xff" + labelsKey(labels)
+	margin := cfg.FlagHysteresis[metric]
+	flagStatesMu.Lock()
+	defer flagStatesMu.Unlock()
+	set := flagStates[key]
+	if below {
+		set = v < threshold || (set && v < threshold+margin)
+	} else {
+		set = v > threshold || (set && v > threshold-margin)
+	}
+	if set {
+		flagStates[key] = true
+	} else {
+		delete(flagStates, key)
+	}
+	return set
+}
+
+// forgetFlag forgets whether a flag metric was set for a series.
+func forgetFlag(metric string, labels prometheus.Labels) {
+	flagStatesMu.Lock()
+	delete(flagStates, metric+"\xff"+labelsKey(labels))
+	flagStatesMu.Unlock()
+}
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestThresholdFlag(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		margin float64
+		below  bool
+		values []float64
+		want   []bool
+	}{
+		{"no margin", 0, true, []float64{3.5, 3.2, 3.31, 3.29, 3.3}, []bool{false, true, false, true, false}},
+		{"margin", 0.2, true, []float64{3.5, 3.2, 3.31, 3.45, 3.5, 3.29, 3.6}, []bool{false, true, true, true, false, true, false}},
+		{"above", 2, false, []float64{25, 31, 29.5, 28.5, 27.9, 30.5}, []bool{false, true, true, true, false, true}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, config{FlagHysteresis: map[string]float64{"battery_low": tt.margin}})
+			labels := prometheus.Labels{"id": t.Name(), "device": t.Name(), "model": "node"}
+			defer forgetFlag("battery_low", labels)
+			threshold := 3.3
+			if !tt.below {
+				threshold = 30
+			}
+			for i, v := range tt.values {
+				if got := thresholdFlag("battery_low", labels, v, threshold, tt.below); got != tt.want[i] {
+					t.Errorf("at %v (sample %d), flag = %v; want %v", v, i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestForgetFlag(t *testing.T) {
+	labels := prometheus.Labels{"id": "n1", "device": "n1", "model": "node"}
+	setConfig(t, config{FlagHysteresis: map[string]float64{"battery_low": 1}})
+	thresholdFlag("battery_low", labels, 3, 3.3, true)
+	forgetFlag("battery_low", labels)
+	if thresholdFlag("battery_low", labels, 3.5, 3.3, true) {
+		t.Error("a forgotten flag stayed set within the margin")
+	}
+}
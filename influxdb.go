@@ -0,0 +1,67 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+)
+
+var influxURL = flag.String("influxdb-url", "", "If set, POST sensor samples in InfluxDB line protocol to this write URL every -influxdb-interval, e.g. http://influx:8086/write?db=sensors")
+var influxToken = flag.String("influxdb-token", "", "If set, the API token to write to -influxdb-url with")
+var influxInterval = flag.Duration("influxdb-interval", 30*time.Second, "How often to write to -influxdb-url")
+
+var (
+	influxMeasurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	influxTagEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+)
+
+// writeInflux POSTs points to -influxdb-url as lines of
+// "sensors_<name>,<label>=<value>... value=<value> <time>", the time in
+// nanoseconds.  Empty labels are left out, as InfluxDB doesn't allow them.
+func writeInflux(ps []point) error {
+	var body bytes.Buffer
+	for _, p := range ps {
+		body.WriteString(influxMeasurementEscaper.Replace("sensors_" + p.name))
+		names := make([]string, 0, len(p.labels))
+		for k := range p.labels {
+			names = append(names, k)
+		}
+		sort.Strings(names)
+		for _, k := range names {
+			if v := p.labels[k]; v != "" {
+				fmt.Fprintf(&body, ",%s=%s", influxTagEscaper.Replace(k), influxTagEscaper.Replace(v))
+			}
+		}
+		fmt.Fprintf(&body, " value=%g %d\n", p.v, p.at.UnixNano())
+	}
+	req, err := http.NewRequest(http.MethodPost, *influxURL, &body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	if *influxToken != "" {
+		req.Header.Set("Authorization", "Token "+*influxToken)
+	}
+	client := http.Client{Timeout: *influxInterval}
+	resp, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 256))
+		err := fmt.Errorf("%s: %s", resp.Status, bytes.TrimSpace(msg))
+		// Such as a malformed point, or a missing database or token:
+		// sending them again would fail the same way.
+		if resp.StatusCode/100 == 4 && resp.StatusCode != http.StatusTooManyRequests {
+			return rejectedError{err}
+		}
+		return err
+	}
+	return nil
+}
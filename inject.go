@@ -0,0 +1,119 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+var injectToken = flag.String("inject-token", "", "If set, serve POST /inject, authenticated by this bearer token, to feed sample lines, or a JSON sample, through the parsers as if read from a source named inject")
+
+// maxInjectBytes bounds the body of an /inject request.
+const maxInjectBytes = 1 << 20
+
+var (
+	// injectMu serializes injections, as connections aren't safe for
+	// concurrent use.
+	injectMu sync.Mutex
+	// injectConn is the connection injected lines are read in, created
+	// with the first, to a source that isn't among those reported on by
+	// /healthz.
+	injectConn *connection
+)
+
+// serveInject handles POST /inject, processing the lines of the body, or
+// with Content-Type: application/json, the sample it describes, as if
+// read in the one connection to a source named inject, and answering
+// with how many samples they had.
+func serveInject(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	if !hasBearerToken(r, *injectToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	body, err := io.ReadAll(http.MaxBytesReader(w, r.Body, maxInjectBytes))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusRequestEntityTooLarge)
+		return
+	}
+	text := string(body)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "application/json") {
+		if text, err = jsonSampleLine(body); err != nil {
+			http.Error(w, "bad JSON sample: "+err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	injectMu.Lock()
+	defer injectMu.Unlock()
+	if injectConn == nil {
+		injectConn = newConnection(configuredSource("inject"), 1)
+	}
+	before := injectConn.samples
+	for _, line := range splitLines(text) {
+		if line == "" {
+			// Not a heartbeat, just the end of the body.
+			continue
+		}
+		if err := processMessage(line, injectConn); err != nil {
+			// Start afresh, as a reconnect would.
+			injectConn = nil
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(struct {
+		Samples int `json:"samples"`
+	}{injectConn.samples - before})
+}
+
+// jsonSampleLine turns a JSON sample, {"id": "28ff...", "model": "DS18B20",
+// "temp": 21.5, ...}, into the key=value line it stands for.
+func jsonSampleLine(body []byte) (string, error) {
+	var sample map[string]interface{}
+	d := json.NewDecoder(strings.NewReader(string(body)))
+	d.UseNumber()
+	if err := d.Decode(&sample); err != nil {
+		return "", err
+	}
+	if _, ok := sample["id"]; !ok {
+		return "", fmt.Errorf("no id")
+	}
+	keys := make([]string, 0, len(sample))
+	for k := range sample {
+		if k != "id" && k != "model" {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	keys = append([]string{"id", "model"}, keys...)
+	var pairs []string
+	for _, k := range keys {
+		v, ok := sample[k]
+		if !ok {
+			continue
+		}
+		var s string
+		switch v := v.(type) {
+		case string:
+			s = v
+		case json.Number:
+			s = v.String()
+		default:
+			return "", fmt.Errorf("%q: must be a string or number", k)
+		}
+		if k == "" || s == "" || strings.ContainsAny(k+s, " \t\r\n=") {
+			return "", fmt.Errorf("%q: keys and values can't be empty or contain spaces or =", k)
+		}
+		pairs = append(pairs, k+"="+s)
+	}
+	return strings.Join(pairs, " "), nil
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var interSampleSeconds = newInterSampleSeconds(prometheus.ExponentialBuckets(0.5, 2, 12))
+
+func newInterSampleSeconds(buckets []float64) *prometheus.HistogramVec {
+	return prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: "sensors",
+		Name:      "inter_sample_seconds",
+		Help:      "Time between consecutive samples from each device, by model",
+		Buckets:   buckets,
+	}, []string{"model"})
+}
+
+// noteInterval observes the time since a device's previous sample in this
+// connection.  Intervals aren't measured across connections, which would
+// count the time spent reconnecting, nor across clock jumps.
+func (c *connection) noteInterval(ID, model string, at time.Time) {
+	if prev, ok := c.last[ID]; ok && at.After(prev) && !clockJumpedSince(prev) {
+		sink.ObserveHistogram("inter_sample_seconds", prometheus.Labels{"model": strings.ToLower(model)}, at.Sub(prev).Seconds())
+	}
+	c.last[ID] = at
+}
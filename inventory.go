@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var inventoryFile = flag.String("inventory-file", "", "JSON file listing every device expected to report, by device label or raw id, as [\"<device>\", ...]; reloaded on SIGHUP")
+
+var (
+	expectedMissingDesc = prometheus.NewDesc("sensors_expected_missing",
+		"1 for each device in -inventory-file without fresh samples, 0 for those with", []string{"device"}, nil)
+	unexpectedDeviceDesc = prometheus.NewDesc("sensors_unexpected_device",
+		"1 for each device with fresh samples that isn't in -inventory-file", []string{"device"}, nil)
+)
+
+// inventory holds the devices listed in -inventory-file.
+var inventory atomic.Pointer[[]string]
+
+// loadInventory reads an -inventory-file.
+func loadInventory(path string) ([]string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var devices []string
+	if err := json.Unmarshal(b, &devices); err != nil {
+		return nil, err
+	}
+	return devices, nil
+}
+
+// reloadInventoryOnHUP rereads -inventory-file whenever a SIGHUP arrives,
+// keeping the old inventory if the new file is bad.
+func reloadInventoryOnHUP() {
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	for range hup {
+		devices, err := loadInventory(*inventoryFile)
+		if err != nil {
+			log.Printf("Error reloading -inventory-file, keeping the old inventory: %v", err)
+			continue
+		}
+		inventory.Store(&devices)
+		log.Printf("Reloaded -inventory-file %s", *inventoryFile)
+	}
+}
+
+// inventoryCollector exports, at scrape time, which of the devices in
+// -inventory-file are missing, and which devices are reporting that
+// aren't in it.  A device is fresh while it has series that haven't been
+// marked stale: they go, or are marked, once past their TTLs, so a device
+// that's never reported since startup is missing straight away.
+type inventoryCollector struct{}
+
+func (inventoryCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- expectedMissingDesc
+	ch <- unexpectedDeviceDesc
+}
+
+func (inventoryCollector) Collect(ch chan<- prometheus.Metric) {
+	p := inventory.Load()
+	if p == nil {
+		return
+	}
+	expected := map[string]bool{}
+	for _, d := range *p {
+		expected[d] = true
+	}
+	seriesMu.Lock()
+	fresh, unexpected := map[string]bool{}, map[string]bool{}
+	for _, s := range allSeries {
+		if s.stale {
+			continue
+		}
+		device, ID := s.labels["device"], s.labels["id"]
+		fresh[device], fresh[ID] = true, true
+		if !expected[device] && !expected[ID] {
+			unexpected[device] = true
+		}
+	}
+	seriesMu.Unlock()
+	for d := range expected {
+		missing := 1.0
+		if fresh[d] {
+			missing = 0
+		}
+		ch <- prometheus.MustNewConstMetric(expectedMissingDesc, prometheus.GaugeValue, missing, d)
+	}
+	for d := range unexpected {
+		ch <- prometheus.MustNewConstMetric(unexpectedDeviceDesc, prometheus.GaugeValue, 1, d)
+	}
+}
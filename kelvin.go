@@ -0,0 +1,34 @@
+package main
+
+import (
+	"flag"
+	"math"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var exportKelvin = flag.Bool("export-kelvin", false, "Also export every celsius temperature as sensors_temperature_kelvin")
+
+var kelvinGauges = newSensorGaugeVec(prometheus.GaugeOpts{
+	Namespace: "sensors",
+	Name:      "temperature_kelvin",
+	Help:      "Temperature sampled from a single sensor, in kelvin",
+}, sensorLabels)
+
+// kelvin converts an already-rounded celsius temperature of model's,
+// rounding it per temperatureDecimalsFor to clean up float error, though
+// to no fewer decimals than absoluteZero has, so 21.4° is 294.55K rather
+// than 294.5K.  The rounding has already been accounted for in celsius, so
+// it's not noted again.
+func kelvin(c float64, model string) float64 {
+	k := c - absoluteZero
+	decimals := temperatureDecimalsFor(model)
+	if decimals < 0 {
+		return k
+	}
+	if decimals < 2 {
+		decimals = 2
+	}
+	scale := math.Pow10(decimals)
+	return math.Round(k*scale) / scale
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestKelvin(t *testing.T) {
+	setConfig(t, config{ModelTemperatureDecimals: map[string]int{"ds18b20": -1, "max31820": 2}})
+	for _, tt := range []struct {
+		c     float64
+		model string
+		want  float64
+	}{
+		{21.4, "ds18s20", 294.55},
+		{21, "ds18s20", 294.15},
+		{-273.15, "ds18s20", 0},
+		{21.389, "ds18b20", 21.389 - absoluteZero},
+		{21.39, "MAX31820", 294.54},
+		{21.389, "max31820", 294.54},
+	} {
+		if got := kelvin(tt.c, tt.model); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("kelvin(%v, %q) = %v; want %v", tt.c, tt.model, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aqua/wrt54gl-sensor-collector/sensor"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var captureUnknown = flag.Bool("capture-unknown", false, "Export numeric key=value pairs of unrouted kinds as sensors_raw_value")
+var captureUnknownMaxSeries = flag.Int("capture-unknown-max-series", 100, "Maximum number of sensors_raw_value series -capture-unknown will create")
+
+var (
+	rawValueGauges = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "sensors",
+		Name:      "raw_value",
+		Help:      "Numeric value of an unrecognized key from a key=value sample line (-capture-unknown only)",
+	}, []string{"key", "device"})
+	rawValueSeries = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "sensors",
+		Name:      "raw_value_series",
+		Help:      "Number of sensors_raw_value series created by -capture-unknown",
+	})
+)
+
+// rawSeries is a sensors_raw_value series: its device's labels, as
+// seriesTTL takes them, and when it was last set.
+type rawSeries struct {
+	labels prometheus.Labels // id, device, model
+	at     time.Time
+}
+
+var (
+	rawMu sync.Mutex
+	// rawSeen is the sensors_raw_value series, by key and device, for the
+	// -capture-unknown-max-series guard and expiry.
+	rawSeen = map[[2]string]*rawSeries{}
+)
+
+// recordKV records the samples of a key=value line from o, through the
+// routing table where a route exists.
+func recordKV(samples []sensor.Sample, o origin) {
+	for _, s := range samples {
+		if s.ID == "" {
+			throttledLogf("parse error", "Ignoring key=value sample with no id")
+			return
+		}
+		switch {
+		case routes[s.Kind] != nil || !*captureUnknown:
+			recordGeneric(s.Kind, s.Model, s.ID, s.Value, o)
+		default:
+			if device := o.device(s.ID, s.Model); deviceAllowed(s.ID, device) {
+				recordRaw(s.Kind, s.ID, s.Model, device, s.Value)
+			}
+		}
+	}
+}
+
+func recordRaw(key, ID, model, device, value string) {
+	fv, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		// Not every unknown key is numeric; that's fine.
+		return
+	}
+	rawMu.Lock()
+	defer rawMu.Unlock()
+	series := [2]string{key, device}
+	s := rawSeen[series]
+	if s == nil {
+		if len(rawSeen) >= *captureUnknownMaxSeries {
+			skipSample("raw_series_limit", device)
+			return
+		}
+		s = &rawSeries{labels: prometheus.Labels{"id": ID, "device": device, "model": strings.ToLower(model)}}
+		rawSeen[series] = s
+		rawValueSeries.Set(float64(len(rawSeen)))
+	}
+	s.at = clk.Now()
+	rawValueGauges.WithLabelValues(key, device).Set(fv)
+}
+
+// expireRaw deletes the sensors_raw_value series not set within their
+// TTL, returning how many.
+func expireRaw(now time.Time) int {
+	rawMu.Lock()
+	defer rawMu.Unlock()
+	n := 0
+	for series, s := range rawSeen {
+		if ttl := seriesTTL(s.labels); ttl > 0 && now.Sub(s.at) > ttl {
+			forgetRaw(series)
+			n++
+		}
+	}
+	return n
+}
+
+// forgetRawDevice deletes the sensors_raw_value series of a device, by
+// device or raw id, returning how many.
+func forgetRawDevice(device string) int {
+	rawMu.Lock()
+	defer rawMu.Unlock()
+	n := 0
+	for series, s := range rawSeen {
+		if s.labels["device"] == device || s.labels["id"] == device {
+			forgetRaw(series)
+			n++
+		}
+	}
+	return n
+}
+
+// forgetRaw deletes a sensors_raw_value series.  rawMu must be held.
+func forgetRaw(series [2]string) {
+	rawValueGauges.DeleteLabelValues(series[0], series[1])
+	delete(rawSeen, series)
+	rawValueSeries.Set(float64(len(rawSeen)))
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"sync"
+	"testing"
+	"time"
+)
+
+// rawValue returns the sensors_raw_value of a key of device, if any.
+func rawValue(key, device string) (float64, bool) {
+	for _, m := range collect(rawValueGauges) {
+		if labelValue(m, "key") == key && labelValue(m, "device") == device {
+			return m.GetGauge().GetValue(), true
+		}
+	}
+	return 0, false
+}
+
+func TestRecordRaw(t *testing.T) {
+	setFlag(t, "capture-unknown", "true")
+	setFlag(t, "capture-unknown-max-series", "2")
+	for _, tt := range []struct {
+		name  string
+		deny  string
+		lines []string
+		want  map[string]float64 // by key of node-1
+	}{
+		{"captured", "", []string{"id=node-1 rssi=-70 snr=9.5"}, map[string]float64{"rssi": -70, "snr": 9.5}},
+		{"not numeric", "", []string{"id=node-1 rssi=weak"}, map[string]float64{}},
+		{"limit", "", []string{"id=node-1 rssi=-70 snr=9.5 lqi=200"}, map[string]float64{"rssi": -70, "snr": 9.5}},
+		{"denied", "node-1", []string{"id=node-1 rssi=-70"}, map[string]float64{}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			var err error
+			old := deniedDevices
+			if deniedDevices, err = parseDeviceFilter(tt.deny); err != nil {
+				t.Fatal(err)
+			}
+			t.Cleanup(func() {
+				deniedDevices = old
+				forgetRawDevice("node-1")
+			})
+			conn := testConnection(t)
+			for _, line := range tt.lines {
+				processLine(line, conn)
+			}
+			for _, key := range []string{"rssi", "snr", "lqi"} {
+				v, ok := rawValue(key, "node-1")
+				if want, wantOK := tt.want[key]; ok != wantOK || v != want {
+					t.Errorf("%s gave %v, %v; want %v, %v", key, v, ok, want, wantOK)
+				}
+			}
+		})
+	}
+}
+
+func TestExpireRaw(t *testing.T) {
+	setFlag(t, "capture-unknown", "true")
+	setFlag(t, "stale-ttl", "1m")
+	c := newFakeClock()
+	setClock(t, c)
+	t.Cleanup(func() { forgetRawDevice("node-2") })
+	conn := testConnection(t)
+	processLine("id=node-2 rssi=-70", conn)
+	c.Advance(30 * time.Second)
+	processLine("id=node-2 snr=9.5", conn)
+	for _, tt := range []struct {
+		advance   time.Duration
+		expired   int
+		rssi, snr bool
+	}{
+		{0, 0, true, true},
+		{31 * time.Second, 1, false, true},
+		{30 * time.Second, 1, false, false},
+	} {
+		c.Advance(tt.advance)
+		if n := expireRaw(c.Now()); n != tt.expired {
+			t.Errorf("after %v, expireRaw = %d; want %d", tt.advance, n, tt.expired)
+		}
+		_, rssi := rawValue("rssi", "node-2")
+		_, snr := rawValue("snr", "node-2")
+		if rssi != tt.rssi || snr != tt.snr {
+			t.Errorf("after %v, rssi and snr present = %v, %v; want %v, %v", tt.advance, rssi, snr, tt.rssi, tt.snr)
+		}
+	}
+}
+
+func TestRecordRawConcurrently(t *testing.T) {
+	setFlag(t, "capture-unknown", "true")
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func(device string) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				recordRaw("rssi", device, "generic", device, "-70")
+			}
+		}("node-3" + string(rune('a'+i)))
+	}
+	wg.Wait()
+	for i := 0; i < 4; i++ {
+		forgetRawDevice("node-3" + string(rune('a'+i)))
+	}
+}
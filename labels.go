@@ -0,0 +1,93 @@
+package main
+
+import (
+	"flag"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var labelSet = flag.String("label-set", "full", `Labels on sensor series: "full" (id, device, model) or "minimal" (device, model; device being derived from id anyway)`)
+
+// sensorLabels labels most sensor series.
+var sensorLabels = []string{"id", "device", "model"}
+
+// sensorGaugeVec is a GaugeVec of sensor series whose label names depend on
+// -label-set, and so can't be built until flags are parsed.  It is built on
+// first use.
+type sensorGaugeVec struct {
+	opts   prometheus.GaugeOpts
+	labels []string
+
+	once sync.Once
+	vec  *prometheus.GaugeVec
+}
+
+func newSensorGaugeVec(opts prometheus.GaugeOpts, labels []string) *sensorGaugeVec {
+	return &sensorGaugeVec{opts: opts, labels: labels}
+}
+
+func (v *sensorGaugeVec) get() *prometheus.GaugeVec {
+	v.once.Do(func() {
+		v.vec = prometheus.NewGaugeVec(v.opts, sensorLabelNames(v.labels))
+	})
+	return v.vec
+}
+
+// sensorLabelNames returns the label names exported for series labelled
+// by labels, per -label-set and -discovery-labels.
+func sensorLabelNames(labels []string) []string {
+	var names []string
+	for _, l := range labels {
+		if l != "id" || *labelSet != "minimal" {
+			names = append(names, l)
+		}
+	}
+	return append(names, discoveryLabelNames...)
+}
+
+func (v *sensorGaugeVec) Describe(ch chan<- *prometheus.Desc) { v.get().Describe(ch) }
+
+func (v *sensorGaugeVec) Collect(ch chan<- prometheus.Metric) {
+	if *maxExportAge > 0 || *exportTimestamps {
+		v.collectSeries(ch)
+		return
+	}
+	v.get().Collect(ch)
+}
+
+// exported returns the labels actually exported for a series; labels
+// should always include the id, which is dropped if -label-set says so,
+// and are extended with any -discovery-labels and sanitized per
+// label_sanitization.
+func exported(labels prometheus.Labels) prometheus.Labels {
+	if len(discoveryLabelNames) > 0 {
+		labels = withDiscoveryLabels(labels)
+	}
+	labels = sanitizeLabels(labels)
+	if _, ok := labels["id"]; !ok || *labelSet != "minimal" {
+		return labels
+	}
+	l := prometheus.Labels{}
+	for k, val := range labels {
+		if k != "id" {
+			l[k] = val
+		}
+	}
+	return l
+}
+
+// With returns the gauge for labels.
+func (v *sensorGaugeVec) With(labels prometheus.Labels) prometheus.Gauge {
+	return v.get().With(exported(labels))
+}
+
+// Delete deletes the gauge for labels, if it exists.
+func (v *sensorGaugeVec) Delete(labels prometheus.Labels) bool {
+	return v.get().Delete(exported(labels))
+}
+
+// DeletePartialMatch deletes the gauges whose labels include labels.
+func (v *sensorGaugeVec) DeletePartialMatch(labels prometheus.Labels) int {
+	return v.get().DeletePartialMatch(exported(labels))
+}
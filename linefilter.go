@@ -0,0 +1,34 @@
+package main
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// lineFilter admits only the lines of a source meant for this collector,
+// on a bus shared with others.  A line must satisfy each condition that is
+// set.
+type lineFilter struct {
+	Prefix   string `json:"prefix"`
+	Contains string `json:"contains"`
+	Regex    string `json:"regex"`
+
+	re *regexp.Regexp
+}
+
+var filteredLines = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "filtered_lines_total",
+	Help:      "Lines ignored for not matching their source's line filter, by endpoint",
+}, []string{"endpoint"})
+
+// admits reports whether a line passes f; a nil filter admits everything.
+func (f *lineFilter) admits(line string) bool {
+	if f == nil {
+		return true
+	}
+	return strings.HasPrefix(line, f.Prefix) && strings.Contains(line, f.Contains) &&
+		(f.re == nil || f.re.MatchString(line))
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"crypto/subtle"
+	"errors"
+	"flag"
+	"log"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+	"golang.org/x/net/http2"
+	"golang.org/x/net/http2/h2c"
+)
+
+var listenRetry = flag.Duration("listen-retry", 0, "If set, keep retrying to listen on -listen for this long, backing off, if it fails (say the port is still held by the previous instance) instead of exiting straight away")
+
+var listenH2C = flag.Bool("listen-h2c", false, "Also serve HTTP/2 without TLS (h2c) on -listen, for scrapers that prefer it; HTTP/1.1 keeps working")
+
+var (
+	httpReadTimeout  = flag.Duration("http-read-timeout", 30*time.Second, "Longest the HTTP server waits to read a request, so slow clients can't hold connections open")
+	httpWriteTimeout = flag.Duration("http-write-timeout", time.Minute, "Longest the HTTP server takes writing a response before giving up")
+	httpIdleTimeout  = flag.Duration("http-idle-timeout", 2*time.Minute, "How long the HTTP server keeps idle keep-alive connections open")
+	maxScrapes       = flag.Int("max-concurrent-scrapes", 0, "If set, answer scrapes (of /metrics and the like, and /snapshot) beyond this many at once with 503 rather than serve them all at once")
+)
+
+var listenFailures = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "listen_failures_total",
+	Help:      "Times the HTTP server on -listen failed to start or stopped",
+})
+
+var scrapesLimited = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "scrapes_limited_total",
+	Help:      "Scrapes refused for exceeding -max-concurrent-scrapes",
+})
+
+// scrapeSlots holds a token for each scrape being served, per
+// -max-concurrent-scrapes; nil if there's no limit.
+var scrapeSlots chan struct{}
+
+// limitScrapes serves h only while fewer than -max-concurrent-scrapes
+// scrapes are being served, of any path it wraps, refusing the rest with
+// 503 straight away: a scraper is better off retrying than queueing
+// behind the others.
+func limitScrapes(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if scrapeSlots == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+		select {
+		case scrapeSlots <- struct{}{}:
+			defer func() { <-scrapeSlots }()
+			h.ServeHTTP(w, r)
+		default:
+			scrapesLimited.Inc()
+			http.Error(w, "too many concurrent scrapes", http.StatusServiceUnavailable)
+		}
+	})
+}
+
+// hasBearerToken reports whether r is authorized by an Authorization:
+// Bearer header with token.
+func hasBearerToken(r *http.Request, token string) bool {
+	return subtle.ConstantTimeCompare([]byte(r.Header.Get("Authorization")), []byte("Bearer "+token)) == 1
+}
+
+// maxListenBackoff caps the wait between attempts to listen.
+const maxListenBackoff = 30 * time.Second
+
+// serveHTTP serves HTTP on addr.  If listening fails, or the server stops,
+// it retries with backoff until -listen-retry has passed without it
+// serving, then flushes what it can and exits.  A server that was up for
+// longer than that gets a fresh allowance.
+func serveHTTP(addr string) {
+	backoff := time.Second
+	deadline := clk.Now().Add(*listenRetry)
+	for {
+		started := clk.Now()
+		err := listenAndServe(addr)
+		listenFailures.Inc()
+		if clk.Now().Sub(started) > *listenRetry {
+			deadline, backoff = clk.Now().Add(*listenRetry), time.Second
+		}
+		if !clk.Now().Add(backoff).Before(deadline) {
+			flushBeforeExit()
+			log.Fatalf("Metrics HTTP server on %s failed, exiting: %v", addr, err)
+		}
+		log.Printf("Metrics HTTP server on %s failed, retrying in %v (sensor sources unaffected): %v", addr, backoff, err)
+		clk.Sleep(backoff)
+		if backoff *= 2; backoff > maxListenBackoff {
+			backoff = maxListenBackoff
+		}
+	}
+}
+
+func listenAndServe(addr string) error {
+	l, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+	log.Printf("Metrics HTTP server listening on %s", l.Addr())
+	server := &http.Server{
+		Handler:           serverHandler(http.DefaultServeMux),
+		ReadHeaderTimeout: *httpReadTimeout,
+		ReadTimeout:       *httpReadTimeout,
+		WriteTimeout:      *httpWriteTimeout,
+		IdleTimeout:       *httpIdleTimeout,
+	}
+	err = server.Serve(l)
+	if errors.Is(err, net.ErrClosed) {
+		err = errors.New("listener closed")
+	}
+	return err
+}
+
+// serverHandler is h as the HTTP server serves it: also over h2c, with
+// -listen-h2c.
+func serverHandler(h http.Handler) http.Handler {
+	if *listenH2C {
+		return h2c.NewHandler(h, &http2.Server{IdleTimeout: *httpIdleTimeout})
+	}
+	return h
+}
+
+// flushBeforeExit pushes the metrics, writes the snapshot file and flushes
+// the exporters one last time, where configured, so the last readings
+// aren't lost with the HTTP server.
+func flushBeforeExit() {
+	if *pushgatewayURL != "" {
+		if err := push.New(*pushgatewayURL, *pushgatewayJob).Gatherer(unitSystemGatherer{registry}).Push(); err != nil {
+			log.Printf("Error pushing to %s: %v", *pushgatewayURL, err)
+		}
+	}
+	if *jsonOutputFile != "" {
+		if err := writeSnapshot(*jsonOutputFile); err != nil {
+			log.Printf("Error writing %s: %v", *jsonOutputFile, err)
+		}
+	}
+	for _, e := range exporters {
+		e.flush()
+	}
+}
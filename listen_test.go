@@ -0,0 +1,53 @@
+package main
+
+import (
+	"context"
+	"crypto/tls"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"golang.org/x/net/http2"
+)
+
+func TestListenH2C(t *testing.T) {
+	h1 := &http.Client{}
+	h2c := &http.Client{Transport: &http2.Transport{
+		AllowHTTP: true,
+		DialTLSContext: func(ctx context.Context, network, addr string, cfg *tls.Config) (net.Conn, error) {
+			var d net.Dialer
+			return d.DialContext(ctx, network, addr)
+		},
+	}}
+	for _, tt := range []struct {
+		h2c    bool
+		client *http.Client
+		want   string // or "" for a failed request
+	}{
+		{false, h1, "HTTP/1.1"},
+		{false, h2c, ""},
+		{true, h1, "HTTP/1.1"},
+		{true, h2c, "HTTP/2.0"},
+	} {
+		if tt.h2c {
+			setFlag(t, "listen-h2c", "true")
+		} else {
+			setFlag(t, "listen-h2c", "false")
+		}
+		s := httptest.NewServer(serverHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, r.Proto)
+		})))
+		got := ""
+		if resp, err := tt.client.Get(s.URL); err == nil {
+			b, _ := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			got = string(b)
+		}
+		s.Close()
+		if got != tt.want {
+			t.Errorf("with -listen-h2c=%v, %q client got %q; want %q", tt.h2c, tt.want, got, tt.want)
+		}
+	}
+}
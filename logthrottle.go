@@ -0,0 +1,73 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+)
+
+var logRate = flag.Float64("log-rate", 10, "Messages per second each kind of error, such as parse errors or a source's connection errors, may log once past -log-burst, the rest summarized; 0 logs them all")
+var logBurst = flag.Int("log-burst", 100, "How many messages of each kind of error may log at once before -log-rate applies")
+
+// logSummaryInterval is how long suppressed messages are counted before
+// their summary is logged.
+const logSummaryInterval = 10 * time.Second
+
+// logBucket is the token bucket of a kind of message, and what's been
+// suppressed since its last summary.
+type logBucket struct {
+	tokens     float64
+	at         time.Time
+	suppressed int
+	latest     string
+}
+
+var (
+	logBucketsMu sync.Mutex
+	logBuckets   = map[string]*logBucket{}
+)
+
+// throttledLogf is log.Printf for messages that may come in storms, such as
+// one per bad line, rate limited per kind by -log-rate and -log-burst.  Once
+// a kind runs out, its messages are counted instead, and a summary of how
+// many there were and the latest is logged after logSummaryInterval.
+func throttledLogf(kind, format string, v ...interface{}) {
+	if *logRate <= 0 {
+		log.Printf(format, v...)
+		return
+	}
+	now := clk.Now()
+	logBucketsMu.Lock()
+	b := logBuckets[kind]
+	if b == nil {
+		b = &logBucket{tokens: float64(*logBurst), at: now}
+		logBuckets[kind] = b
+	}
+	b.tokens = math.Min(float64(*logBurst), b.tokens+now.Sub(b.at).Seconds()**logRate)
+	b.at = now
+	if b.tokens >= 1 {
+		b.tokens--
+		logBucketsMu.Unlock()
+		log.Printf(format, v...)
+		return
+	}
+	if b.suppressed++; b.suppressed == 1 {
+		go summarizeLogs(kind, b)
+	}
+	b.latest = fmt.Sprintf(format, v...)
+	logBucketsMu.Unlock()
+}
+
+// summarizeLogs logs, after logSummaryInterval, how many of a kind's
+// messages were suppressed.
+func summarizeLogs(kind string, b *logBucket) {
+	clk.Sleep(logSummaryInterval)
+	logBucketsMu.Lock()
+	n, latest := b.suppressed, b.latest
+	b.suppressed, b.latest = 0, ""
+	logBucketsMu.Unlock()
+	log.Printf("%d more %s messages in the last %v, the latest: %s", n, kind, logSummaryInterval, latest)
+}
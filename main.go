@@ -1,39 +1,61 @@
 package main
 
 import (
-	"bufio"
 	"flag"
-	"fmt"
+	"io"
 	"log"
-	"math"
 	"net"
 	"net/http"
+	"net/url"
+	"os"
 	"regexp"
-	"strconv"
+	"runtime/debug"
 	"strings"
 	"time"
+	"unicode/utf8"
 
 	"github.com/prometheus/client_golang/prometheus"
-	"github.com/prometheus/client_golang/prometheus/promhttp"
 )
 
 var listen = flag.String("listen", ":9456", "(Host and) port to listen on for Prometheus export")
-var connect = flag.String("connect", "192.168.3.41:9456", "Host/port to connect to for sensor readings")
+var configFile = flag.String("config", "", "JSON file of additional configuration (routes, ...)")
+var connect = flag.String("connect", "192.168.3.41:9456", "Host/port to connect to for sensor readings; several, comma-separated, are read per -source-strategy")
 var connectTimeout = flag.Duration("connect-timeout", 30*time.Second, "Connection deadline")
+var connectCommand = flag.String("connect-command", "", `Command written to the connection after each successful dial; \n, \r, \t and \\ escapes are honored`)
+var startupDelay = flag.Duration("startup-delay", 0, "Wait this long after starting before the first connection attempt")
+var waitForNetwork = flag.Duration("wait-for-network", 0, "If set, before the first connection attempt, wait up to this long for the -connect host to resolve")
+var minConnectInterval = flag.Duration("min-connect-interval", time.Second, "Minimum time between connection attempts, however they ended")
+var keepaliveInterval = flag.Duration("keepalive-interval", 0, "If set, write -keepalive-message to the connection this often")
+var keepaliveMessage = flag.String("keepalive-message", `\n`, "Message written every -keepalive-interval, with the same escapes as -connect-command")
+var inputEncoding = flag.String("input-encoding", "none", "Encoding of each received line: none, base64 or hex")
+var debugMetrics = flag.Bool("debug-metrics", false, "Export diagnostic metrics of interest only when debugging the collector")
+var defaultModel = flag.String("default-model", "ds18b20", "Model assumed for temperature lines from firmware that doesn't report one")
+var deviceAllow = flag.String("device-allow", "", "Comma-separated device IDs or regexes to record; empty records all")
+var deviceDeny = flag.String("device-deny", "", "Comma-separated device IDs or regexes to skip")
+var logFirstSamples = flag.Bool("log-first-samples", true, "Log the first sample from each device in each connection")
+var quietReconnects = flag.Bool("quiet-reconnects", false, "Don't log successful reconnections, only the first connection and errors")
 
 var (
-	ds18x20SampleRE   = regexp.MustCompile(`^(?i)-?\d+ (temp) ([0-9a-f]+) (\w+) ([\d.]+)$`)
-	dht22SampleRE     = regexp.MustCompile(`^(?i)-?\d+ (humidity) (DHT22) ([\d.]+) ([\d.]+)$`)
-	temperatureGauges = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	temperatureGauges = newSensorGaugeVec(prometheus.GaugeOpts{
 		Namespace: "sensors",
 		Name:      "temperature_degrees_celsius",
 		Help:      "Temperature sampled from a single sensor, in degrees celsius",
-	}, []string{"id", "device", "model"})
-	humidityGauges = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+	}, sensorLabels)
+	humidityGauges = newSensorGaugeVec(prometheus.GaugeOpts{
 		Namespace: "sensors",
 		Name:      "relative_humidity_percent",
 		Help:      "Relative humidity sampled from a single sensor, in percent",
-	}, []string{"id", "device", "model"})
+	}, sensorLabels)
+	illuminanceGauges = newSensorGaugeVec(prometheus.GaugeOpts{
+		Namespace: "sensors",
+		Name:      "illuminance_lux",
+		Help:      "Illuminance sampled from a single sensor, in lux",
+	}, sensorLabels)
+	co2Gauges = newSensorGaugeVec(prometheus.GaugeOpts{
+		Namespace: "sensors",
+		Name:      "co2_ppm",
+		Help:      "CO2 concentration sampled from a single sensor, in parts per million",
+	}, sensorLabels)
 	connectionAttempts = prometheus.NewCounter(prometheus.CounterOpts{
 		Namespace: "sensors",
 		Name:      "connection_attempts",
@@ -54,8 +76,63 @@ var (
 		Name:      "bytes_received",
 		Help:      "Bytes received by collector (not necessarily in samples)",
 	})
+	bytesDropped = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "sensors",
+		Name:      "bytes_dropped_total",
+		Help:      "Bytes read but discarded unprocessed when a connection failed mid-line",
+	})
+	scanGoroutines = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "sensors",
+		Name:      "scan_goroutines",
+		Help:      "Connections currently being read; more than the number of sources means a leak",
+	})
+	unmatchedLines = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "sensors",
+		Name:      "unmatched_lines_total",
+		Help:      "Non-blank lines that didn't look like any known sample format",
+	})
+	samplesSkipped = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sensors",
+		Name:      "samples_skipped_total",
+		Help:      "Samples received but deliberately not recorded, by reason",
+	}, []string{"reason"})
+	decodeErrors = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "sensors",
+		Name:      "decode_errors_total",
+		Help:      "Lines dropped because they could not be decoded per -input-encoding, or weren't UTF-8",
+	})
+	roundingResidual = newRoundingResidual(prometheus.LinearBuckets(-0.05, 0.01, 11))
+	panicsRecovered  = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "sensors",
+		Name:      "panics_total",
+		Help:      "Lines dropped because processing them panicked",
+	})
+	acceptedSamples = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sensors",
+		Name:      "accepted_total",
+		Help:      "Sample values exported, by device",
+	}, []string{"device"})
+	rejectedSamples = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sensors",
+		Name:      "rejected_total",
+		Help:      "Sample values dropped rather than exported, by device and reason",
+	}, []string{"device", "reason"})
+	deviceSamples = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sensors",
+		Name:      "samples_total",
+		Help:      "Samples recorded from a single sensor",
+	}, []string{"device", "model"})
 )
 
+func newRoundingResidual(buckets []float64) prometheus.Histogram {
+	return prometheus.NewHistogram(prometheus.HistogramOpts{
+		Namespace: "sensors",
+		Name:      "rounding_residual_celsius",
+		Help:      "Difference between converted temperatures and their exported rounded value (-debug-metrics only)",
+		Buckets:   buckets,
+	})
+}
+
 var arduinoDeviceIDRE = regexp.MustCompile(`^(?i)([0-9a-f]{2})([0-9a-f]+)$`)
 
 func formatDevice(ID, model string) string {
@@ -64,109 +141,694 @@ func formatDevice(ID, model string) string {
 		return "dht22"
 	}
 	if m := arduinoDeviceIDRE.FindStringSubmatch(ID); m != nil {
-		if deviceID, err := strconv.ParseUint(m[2], 16, 64); err != nil {
-			log.Printf("unparseable device ID %q: %v", m[2], err)
-			return ID
-		} else {
-			return strings.ToLower(model) + "-" + fmt.Sprintf("%012x", deviceID)
+		// The ID after the family code, zero-padded to 12 digits but
+		// otherwise as given.  It used to go through ParseUint, which
+		// dropped leading zeros past the 12th digit and gave up on IDs of
+		// more than 64 bits.
+		serial := strings.ToLower(m[2])
+		if len(serial) < 12 {
+			serial = strings.Repeat("0", 12-len(serial)) + serial
 		}
+		return strings.ToLower(model) + "-" + serial
 	}
 	return ID
 }
 
-func recordDS18x20(kind, ID, model, value string) {
-	fv, err := strconv.ParseFloat(value, 64)
+// roundedCelsius converts a fahrenheit reading of model's to celsius,
+// rounded per -temperature-decimals (to the nearest 0.1 degrees, unless
+// set otherwise).
+func roundedCelsius(f float64, model string) float64 {
+	return roundTemperature((f-32.)*5./9., model)
+}
+
+// recordDS18x20 records a DS18x20 line's temperature from o, which is in
+// unit if the line gave one.
+func recordDS18x20(kind, ID, model, value, unit string, o origin) {
+	device := o.device(ID, model)
+	if !deviceAllowed(ID, device) {
+		return
+	}
+	fv, embedded, err := parseValue(value)
 	if err != nil {
-		log.Printf("Error parsing sample value %q from device %q: %v", value, ID, err)
+		throttledLogf("parse error", "Error parsing sample value %q from device %q: %v", value, ID, err)
+		badValue(device, value, err)
+		return
+	}
+	// The firmware converts to fahrenheit; convert back to celsius and round
+	// to nearest 0.1 degrees, the DS18S20 and DS18B20 both being precise to
+	// within ±0.5°.  A unit given in the line is believed over one glued
+	// to the value, which is believed over the table.
+	given := unit != ""
+	if !given {
+		unit = temperatureUnit(model, ds18x20Units)
+	}
+	if !checkEmbeddedUnit(device, unit, embedded) {
+		if !isTemperatureUnit(embedded) {
+			skipSample("unit_mismatch", device)
+			return
+		}
+		if !given {
+			unit = embedded
+		}
+	}
+	labels := prometheus.Labels{
+		"id":     ID,
+		"device": device,
+		"model":  strings.ToLower(model),
+	}
+	recordRawTemperature(labels, fv, unit)
+	fv = toCelsius(fv, unit, labels["model"])
+	deviceSamples.WithLabelValues(device, strings.ToLower(model)).Inc()
+	if readError(labels, fv) {
 		return
 	}
-	// Convert back to celsius and round to nearest 0.1 degrees; the DS18S20 and
-	// DS18B20 were both precise to within ±0.5°.
-	fv = math.Round(10*(fv-32.)*5./9.) / 10.
 	switch kind {
 	case "temp":
-		temperatureGauges.With(prometheus.Labels{
-			"id":     ID,
-			"device": formatDevice(ID, model),
-			"model":  strings.ToLower(model),
-		}).Set(fv)
+		setGauge("temperature_degrees_celsius", temperatureGauges, labels, fv, o)
 	default:
-		log.Printf("Unrecognized sensor type %q", kind)
+		throttledLogf("parse error", "Unrecognized sensor type %q", kind)
 	}
 }
 
-func recordDHT22(kind, model, v1, v2 string) {
-	hv, err := strconv.ParseFloat(v1, 64)
+// recordHumidity records a humidity line's humidity and temperature from
+// o, the latter in fahrenheit if so.  The firmware only supports one sensor of
+// each model, so the model stands in for the ID.
+func recordHumidity(kind, model, v1, v2 string, fahrenheit bool, o origin) {
+	ID := strings.ToLower(model)
+	device := o.prefixed(ID)
+	if !deviceAllowed(ID, device) {
+		return
+	}
+	hv, hunit, err := parseValue(v1)
 	if err != nil {
-		log.Printf("Error parsing sample value 1 %q from device %q: %v", v1, model, err)
+		throttledLogf("parse error", "Error parsing sample value 1 %q from device %q: %v", v1, model, err)
+		badValue(device, v1, err)
 		return
 	}
+	deviceSamples.WithLabelValues(device, ID).Inc()
 	labels := prometheus.Labels{
-		"id":     strings.ToLower(model),
-		"device": strings.ToLower(model),
-		"model":  strings.ToLower(model),
+		"id":     ID,
+		"device": device,
+		"model":  ID,
+	}
+	if checkEmbeddedUnit(device, "percent", hunit) {
+		setGauge("relative_humidity_percent", humidityGauges, labels, hv, o)
+	} else {
+		skipSample("unit_mismatch", device)
 	}
-	humidityGauges.With(labels).Set(hv)
 
-	tv, err := strconv.ParseFloat(v2, 64)
-	// For some reason past-me had this output in fahrenheit, and now can't
-	// reflash to fix it; convert it back.  Round to 0.1 degrees, since the
-	// DHT22 has a precision of ±0.5°C and reporting more is pointless.
-	tv = math.Round(10*(tv-32.)*5./9.) / 10.
+	// Humidity stands on its own even if the temperature is garbled.
+	tv, tunit, err := parseValue(v2)
 	if err != nil {
-		log.Printf("Error parsing sample value 2 %q from device %q: %v", v2, model, err)
+		throttledLogf("parse error", "Error parsing sample value 2 %q from device %q: %v", v2, model, err)
+		badValue(device, v2, err)
 		return
 	}
-	temperatureGauges.With(labels).Set(tv)
+	expected := "celsius"
+	if fahrenheit {
+		expected = "fahrenheit"
+	}
+	if !checkEmbeddedUnit(device, expected, tunit) {
+		if !isTemperatureUnit(tunit) {
+			skipSample("unit_mismatch", device)
+			return
+		}
+		fahrenheit = tunit == "fahrenheit"
+	}
+	if !fahrenheit {
+		recordRawTemperature(labels, tv, "celsius")
+	} else {
+		recordRawTemperature(labels, tv, "fahrenheit")
+		// For some reason past-me had the DHT22 output in fahrenheit, and
+		// not every node can be reflashed to fix it; convert it back.
+		// Round to 0.1 degrees, since the DHT22 has a precision of ±0.5°C
+		// and reporting more is pointless.
+		tv = roundedCelsius(tv, labels["model"])
+	}
+	setGauge("temperature_degrees_celsius", temperatureGauges, labels, tv, o)
 }
 
-func redial() {
+// processLine parses a single line of sensor output and records any sample
+// found in it, returning false if it wasn't recognizable as a sample.
+func processLine(t string, c *connection) bool {
+	if !utf8.ValidString(t) {
+		// Label values must be UTF-8.
+		decodeErrors.Inc()
+		return false
+	}
+	f := splitFields(t)
+	if len(f) == 0 {
+		// Blank lines are harmless.
+		return true
+	}
+	if duplicate(f, c) {
+		return true
+	}
+	for _, p := range c.src.parsers {
+		if p.parse(f, c) {
+			return true
+		}
+	}
+	if c.lines == 1 && *suppressPartialLine {
+		// Connecting mid-line leaves the tail of one to start with.
+		suppressedLines.Inc()
+		return true
+	}
+	unmatchedLines.Inc()
+	unmatchedLine(t, f, c)
+	return false
+}
+
+// noteSample does the bookkeeping common to every sample line, returning
+// its origin, including the time the sample was taken (ts being its
+// timestamp field, if any), or false if it should be dropped.
+func noteSample(ts, ID, model string, c *connection) (origin, bool) {
+	samplesReceived.Inc()
+	c.samples++
+	if *scrapeReconnect > 0 {
+		c.src.noteSampleTime(clk.Now())
+	}
+	if ID != "" && !c.seen[ID] {
+		c.seen[ID] = true
+		if *logFirstSamples {
+			log.Printf("Got first sample from %s in connection %d to %s", ID, c.num, c.src.endpoint)
+		}
+	}
+	if ID != "" {
+		c.noteSyslogHost(ID, model)
+		if *busWindow > 0 {
+			c.noteBusMember(ID, clk.Now())
+		}
+	}
+	o, ok := origin{at: clk.Now(), src: c.src}, true
+	switch {
+	case ts == "":
+	case *leadingField == "sequence":
+		c.noteSequence(ID, ts)
+	default:
+		if o.at, ok = plausibleTime(sampleTime(ts), ID); !ok {
+			skipSample("implausible_timestamp", o.device(ID, model))
+		}
+	}
+	if ok && ID != "" {
+		if !claimID(ID, c.src) {
+			skipSample("duplicate_id", o.device(ID, model))
+			return o, false
+		}
+		c.noteInterval(ID, model, o.at)
+		if c.warmingUp(ID, model, clk.Now()) {
+			skipSample("warming_up", o.device(ID, model))
+			return o, false
+		}
+	}
+	return o, ok
+}
+
+// processLineSafely is processLine, but drops the line rather than the
+// whole collector if handling it panics.
+func processLineSafely(t string, c *connection) (matched bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Panic processing line %q from %s: %v\n%s", t, c.src.endpoint, r, debug.Stack())
+			panicsRecovered.Inc()
+			matched = false
+		}
+	}()
+	return processLine(t, c)
+}
+
+var commandUnescaper = strings.NewReplacer(`\\`, `\`, `\n`, "\n", `\r`, "\r", `\t`, "\t")
+
+// reconnectDelay is how long to wait before redialing after a failure.
+const reconnectDelay = 5 * time.Second
+
+// dialFunc connects to a source's endpoint.  redial takes one so that
+// what it connects through can be swapped out, say for scripted
+// connections in a test.
+type dialFunc func(endpoint string) (net.Conn, error)
+
+// dialTCP is the usual dialFunc.
+func dialTCP(endpoint string) (net.Conn, error) {
+	return net.DialTimeout("tcp", endpoint, *connectTimeout)
+}
+
+// redial reads from src, connecting with dial, reconnecting whenever the
+// connection fails or ends.
+func redial(src *source, dial dialFunc) {
+	clk.Sleep(*startupDelay)
+	if *waitForNetwork > 0 {
+		awaitResolvable(src.endpoint, *waitForNetwork)
+	}
 	connectNum := 0
+	var lastAttempt time.Time
 	for {
-		seen := map[string]bool{}
-		connectionAttempts.Inc()
-		conn, err := net.DialTimeout("tcp", *connect, *connectTimeout)
+		// A source that accepts then immediately hangs up gets no backoff,
+		// so this keeps it from being redialled in a tight loop.
+		if wait := lastAttempt.Add(*minConnectInterval).Sub(clk.Now()); wait > 0 {
+			clk.Sleep(wait)
+		}
+		lastAttempt = clk.Now()
+		src.countAttempt()
+		conn, err := timedDial(src, dial)
 		if err != nil {
-			log.Printf("Error connecting to %s: %v", *connect, err)
-			connectionErrors.Inc()
-			time.Sleep(5 * time.Second)
+			src.fail(dialFailed(src, err))
 			continue
 		}
 		connectNum++
-		log.Printf("Connected to %s (connection %d)", *connect, connectNum)
-		scanner := bufio.NewScanner(conn)
-		for scanner.Scan() {
-			t := scanner.Text()
-			bytesReceived.Add(float64(len(t) + 1))
-			if m := ds18x20SampleRE.FindStringSubmatch(t); m != nil {
-				samplesReceived.Inc()
-				if !seen[m[2]] {
-					seen[m[2]] = true
-					log.Printf("Got first sample from %s in connection %d", m[2], connectNum)
-				}
-				recordDS18x20(m[1], m[2], m[3], m[4])
-			} else if m := dht22SampleRE.FindStringSubmatch(t); m != nil {
-				samplesReceived.Inc()
-				if !seen[m[2]] {
-					seen[m[2]] = true
-					log.Printf("Got first sample from %s in connection %d", m[2], connectNum)
-				}
-				recordDHT22(m[1], m[2], m[3], m[4])
+		if session(src, conn, connectNum) {
+			src.fail(reconnectDelay)
+		} else {
+			src.disconnected(0)
+		}
+	}
+}
+
+// session reads from conn, the connectNum'th connection to src, until it
+// fails or ends, reporting whether it failed.  It closes conn.
+func session(src *source, conn net.Conn, connectNum int) (failed bool) {
+	defer conn.Close()
+	if connectNum == 1 || !*quietReconnects {
+		log.Printf("Connected to %s (connection %d)", src.endpoint, connectNum)
+	}
+	notePeer(conn.RemoteAddr())
+	if *connectCommand != "" {
+		if _, err := conn.Write([]byte(commandUnescaper.Replace(*connectCommand))); err != nil {
+			throttledLogf("connection error", "Error sending connect command to %s: %v", src.endpoint, err)
+			src.countError()
+			return true
+		}
+	}
+	src.setConnected(connectNum, conn)
+	done := make(chan struct{})
+	if *keepaliveInterval > 0 {
+		go keepalive(conn, src.endpoint, done)
+	}
+	c := newConnection(src, connectNum)
+	if *pollCommand != "" {
+		c.responses = make(chan struct{}, 1)
+		go poll(conn, c, done)
+	}
+	err := scan(conn, c)
+	close(done)
+	if err != nil {
+		throttledLogf("connection error", "Read failed from %s: %v", src.endpoint, err)
+		return true
+	}
+	return false
+}
+
+// awaitResolvable waits up to timeout for the host of endpoint, a
+// host:port or a -ws-url, to resolve, so a collector started before the
+// network is up doesn't log a string of failed dials.  It gives up
+// quietly; the dial will say what's wrong.
+func awaitResolvable(endpoint string, timeout time.Duration) {
+	host, _, err := net.SplitHostPort(endpoint)
+	if u, uerr := url.Parse(endpoint); err != nil && uerr == nil {
+		host, err = u.Hostname(), nil
+	}
+	if err != nil || host == "" || net.ParseIP(host) != nil {
+		return
+	}
+	deadline := clk.Now().Add(timeout)
+	for {
+		if _, err := net.LookupHost(host); err == nil || clk.Now().After(deadline) {
+			return
+		}
+		clk.Sleep(time.Second)
+	}
+}
+
+// keepalive periodically writes -keepalive-message to conn until done is
+// closed, for gateways that drop clients that never say anything.  A failed
+// write closes conn, so the scan loop notices and reconnects.
+func keepalive(conn net.Conn, endpoint string, done <-chan struct{}) {
+	msg := []byte(commandUnescaper.Replace(*keepaliveMessage))
+	ticks, stop := clk.NewTicker(*keepaliveInterval)
+	defer stop()
+	for {
+		select {
+		case <-done:
+			return
+		case <-ticks:
+			if _, err := conn.Write(msg); err != nil {
+				throttledLogf("connection error", "Error sending keepalive to %s: %v", endpoint, err)
+				conn.Close()
+				return
 			}
 		}
-		if err := scanner.Err(); err != nil {
-			log.Printf("Read failed from %s: %v", *connect, err)
-			conn.Close()
-			time.Sleep(5 * time.Second)
+	}
+}
+
+// scan processes lines read from r until it ends or fails.
+func scan(r io.Reader, c *connection) error {
+	scanGoroutines.Inc()
+	defer scanGoroutines.Dec()
+	defer c.ended()
+	scanner := newLineScanner(r)
+	for consumed := int64(0); scanner.Scan(); consumed = scanner.consumed {
+		bytesReceived.Add(float64(scanner.consumed - consumed))
+		c.noteResponse()
+		if *framing == "binary" {
+			if !c.suppressed() && c.drifted(processFrameSafely(scanner.Bytes(), c)) {
+				return errFormatDrift
+			}
+			continue
 		}
+		if err := processMessage(scanner.Text(), c); err != nil {
+			return err
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		bytesDropped.Add(float64(scanner.buffered()))
+		return err
 	}
+	return nil
+}
+
+// processMessage processes a message read by scan, which may hold
+// several lines, returning errFormatDrift if c has drifted.
+func processMessage(t string, c *connection) error {
+	payload, err := decodeLine(t)
+	if err != nil {
+		decodeErrors.Inc()
+		return nil
+	}
+	if c.heartbeat(payload) {
+		return nil
+	}
+	for _, line := range splitLines(payload) {
+		if *syslogInput && line != "" {
+			host, msg, ok := parseSyslog(line)
+			if !ok {
+				syslogInvalid.Inc()
+				continue
+			}
+			c.syslogHost, line = host, msg
+		}
+		if c.suppressed() || header(line, c) {
+			continue
+		}
+		if !c.src.filter.admits(line) {
+			filteredLines.WithLabelValues(c.src.endpoint).Inc()
+			continue
+		}
+		line, ok := verifyChecksum(line)
+		if !ok {
+			checksumErrors.Inc()
+			continue
+		}
+		for _, part := range splitSamples(line) {
+			if c.drifted(processLineSafely(part, c)) {
+				return errFormatDrift
+			}
+		}
+	}
+	return nil
 }
 
 func main() {
-	flag.Parse()
-	prometheus.MustRegister(connectionAttempts, connectionErrors,
-		samplesReceived, bytesReceived, temperatureGauges, humidityGauges)
-	go redial()
-	http.Handle("/metrics", promhttp.Handler())
-	log.Fatal(http.ListenAndServe(*listen, nil))
+	args, err := expandFlagFiles(os.Args[1:])
+	if err != nil {
+		log.Fatal(err)
+	}
+	flag.CommandLine.Parse(args)
+	if *instanceName != "" {
+		log.SetPrefix(*instanceName + " ")
+	}
+	if cfg, err = loadConfig(*configFile); err != nil {
+		log.Fatalf("-config: %v", err)
+	}
+	applyHistogramBuckets(cfg.HistogramBuckets)
+	if allowedDevices, err = parseDeviceFilter(*deviceAllow); err != nil {
+		log.Fatalf("-device-allow: %v", err)
+	}
+	if deniedDevices, err = parseDeviceFilter(*deviceDeny); err != nil {
+		log.Fatalf("-device-deny: %v", err)
+	}
+	if *headerRegexp != "" {
+		if headerRE, err = regexp.Compile(*headerRegexp); err != nil {
+			log.Fatalf("-header-regexp: %v", err)
+		}
+	}
+	if *firmwareRegexp != "" {
+		if headerRE == nil {
+			log.Fatalf("-firmware-regexp: needs -header-regexp to pick out the banner")
+		}
+		if firmwareRE, err = regexp.Compile(*firmwareRegexp); err != nil {
+			log.Fatalf("-firmware-regexp: %v", err)
+		}
+		if firmwareRE.NumSubexp() < 1 {
+			log.Fatalf("-firmware-regexp: needs a group to capture the version")
+		}
+	}
+	switch *skewedTimestamps {
+	case "receipt", "drop":
+	default:
+		log.Fatalf("-skewed-timestamps: must be receipt or drop, not %q", *skewedTimestamps)
+	}
+	switch *labelSet {
+	case "full", "minimal":
+	default:
+		log.Fatalf("-label-set: must be full or minimal, not %q", *labelSet)
+	}
+	if err := checkDiscoveryLabels(); err != nil {
+		log.Fatalf("-discovery-labels: %v", err)
+	}
+	if *discoveryFile != "" {
+		d, ts, err := loadDiscovery(*discoveryFile)
+		if err != nil {
+			log.Fatalf("-discovery-file: %v", err)
+		}
+		discovery.Store(&d)
+		deviceThresholds.Store(&ts)
+		go reloadDiscoveryOnHUP()
+	}
+	if *inventoryFile != "" {
+		devices, err := loadInventory(*inventoryFile)
+		if err != nil {
+			log.Fatalf("-inventory-file: %v", err)
+		}
+		inventory.Store(&devices)
+		go reloadInventoryOnHUP()
+	}
+	switch *unitSystem {
+	case "metric", "imperial":
+	default:
+		log.Fatalf("-unit-system: must be metric or imperial, not %q", *unitSystem)
+	}
+	if *pollCommand != "" && (*pollInterval <= 0 || *pollTimeout <= 0) {
+		log.Fatalf("-poll-command: -poll-interval and -poll-timeout must be positive")
+	}
+	if *timestampGrid < 0 || *timestampGrid > 0 && !*exportTimestamps {
+		log.Fatalf("-timestamp-grid: needs -export-timestamps, and must not be negative")
+	}
+	switch *duplicateIDs {
+	case "merge", "prefix", "first":
+	default:
+		log.Fatalf("-duplicate-ids: must be merge, prefix or first, not %q", *duplicateIDs)
+	}
+	if *precisionLossWarn < 0 {
+		log.Fatalf("-precision-loss-warn: must not be negative")
+	}
+	if *auditMaxBytes < 0 {
+		log.Fatalf("-audit-max-bytes: must not be negative")
+	}
+	if *busWindow < 0 {
+		log.Fatalf("-bus-window: must not be negative")
+	}
+	if *scrapeReconnect < 0 {
+		log.Fatalf("-scrape-reconnect: must not be negative")
+	}
+	if *peerReverseDNS && *reverseDNSTimeout <= 0 {
+		log.Fatalf("-reverse-dns-timeout: must be positive")
+	}
+	switch *staleAction {
+	case "delete", "mark":
+	default:
+		log.Fatalf("-stale-action: must be delete or mark, not %q", *staleAction)
+	}
+	if *dedupMaxLines < 1 {
+		log.Fatalf("-dedup-max-lines: must be at least 1")
+	}
+	if err := (smoothing{*smoothingMethod, *smoothingWindow}).check(); err != nil {
+		log.Fatalf("-smoothing-method: %v", err)
+	}
+	if *logRate > 0 && *logBurst < 1 {
+		log.Fatalf("-log-burst: must be at least 1")
+	}
+	if *extremeHalfLife < 0 {
+		log.Fatalf("-extreme-half-life: must not be negative")
+	}
+	switch *sourceStrategy {
+	case "all", "failover":
+	default:
+		log.Fatalf("-source-strategy: must be all or failover, not %q", *sourceStrategy)
+	}
+	if *eventWebhookURL != "" {
+		events = newAsyncSink(webhookSink{*eventWebhookURL, &http.Client{Timeout: 10 * time.Second}}, *eventQueue)
+	}
+	switch *framing {
+	case "newline", "length-prefixed":
+	case "binary":
+		if *syslogInput {
+			log.Fatalf("-framing=binary can't be used with -syslog")
+		}
+	default:
+		log.Fatalf("-framing: unknown framing %q", *framing)
+	}
+	switch *leadingField {
+	case "timestamp", "sequence":
+	default:
+		log.Fatalf("-leading-field: must be timestamp or sequence, not %q", *leadingField)
+	}
+	switch *healthzRequire {
+	case "any", "all":
+	default:
+		log.Fatalf("-healthz-require: must be any or all, not %q", *healthzRequire)
+	}
+	if _, ok := crcs[*lineChecksum]; !ok && *lineChecksum != "none" && *lineChecksum != "nmea" {
+		log.Fatalf("-line-checksum: unknown checksum %q", *lineChecksum)
+	}
+	switch *checksumField {
+	case "first", "last":
+	default:
+		log.Fatalf("-checksum-field: must be first or last, not %q", *checksumField)
+	}
+	switch *inputEncoding {
+	case "none", "base64", "hex":
+	default:
+		log.Fatalf("-input-encoding: unknown encoding %q", *inputEncoding)
+	}
+	routeGauges, err := buildRoutes(cfg.Routes)
+	if err != nil {
+		log.Fatalf("-config: %v", err)
+	}
+	if err := registerMetrics(registry, enabledMetrics(routeGauges)); err != nil {
+		log.Fatalf("Can't register metrics: %v", err)
+	}
+	setBuildInfo()
+	if *graphiteAddr != "" {
+		if *graphiteInterval <= 0 {
+			log.Fatalf("-graphite-interval: must be positive")
+		}
+		addExporter("graphite", *graphiteAddr, *graphiteInterval, writeGraphite)
+	}
+	if *influxURL != "" {
+		if *influxInterval <= 0 {
+			log.Fatalf("-influxdb-interval: must be positive")
+		}
+		addExporter("influxdb", *influxURL, *influxInterval, writeInflux)
+	}
+	if len(exporters) > 0 {
+		// The exposition is always fed, for /metrics and pushes.
+		sinks := fanOutSink{promSink{}}
+		for _, e := range exporters {
+			sinks = append(sinks, e.sink)
+			go e.run()
+		}
+		sink = sinks
+	}
+	if len(cfg.AlertRules) > 0 || thresholdsConfigured() {
+		if *alertInterval <= 0 {
+			log.Fatalf("-alert-interval: must be positive")
+		}
+		go evaluateAlerts(cfg.AlertRules, *alertInterval)
+	}
+	if *clockJumpThreshold > 0 {
+		go watchClock()
+	}
+	if *averageWindow > 0 {
+		go flushWindows()
+	}
+	if interval := shortestTTL(); interval > 0 {
+		go expireSeries(interval / 2)
+	}
+	if *auditFile != "" {
+		if err := openAudit(); err != nil {
+			log.Fatalf("-audit-file: %v", err)
+		}
+	}
+	if *jsonOutputFile != "" {
+		go writeSnapshots(*jsonOutputFile, *jsonOutputInterval)
+	}
+	if *startupCheck > 0 {
+		go checkStartup(*startupCheck)
+	}
+	if *requireSampleWithin > 0 {
+		go requireSample(*requireSampleWithin)
+	}
+	if *replay != "" {
+		go replayFiles(newSource("replay:"+*replay), *replay)
+	} else if *fifo != "" {
+		if err := checkFIFO(*fifo); err != nil {
+			log.Fatalf("-fifo: %v", err)
+		}
+		go readFIFO(newSource("fifo:"+*fifo), *fifo)
+	} else if *serialPorts != "" {
+		serialSources(*serialPorts)
+	} else if *wsURL != "" {
+		if err := checkWSURL(*wsURL); err != nil {
+			log.Fatalf("-ws-url: %v", err)
+		}
+		go redial(newSource(*wsURL), dialWS)
+	} else {
+		var srcs []*source
+		for _, endpoint := range connectEndpoints(*connect) {
+			srcs = append(srcs, newSource(endpoint))
+		}
+		if len(srcs) == 0 {
+			log.Fatalf("-connect: no endpoints")
+		}
+		dial := dialTCP
+		switch {
+		case *sshCommand != "" && *socks5Proxy != "":
+			log.Fatalf("-ssh-command can't be used with -socks5-proxy")
+		case *sshCommand != "":
+			if dial, err = sshDialer(); err != nil {
+				log.Fatalf("-ssh-command: %v", err)
+			}
+		case *socks5Proxy != "":
+			if dial, err = socks5Dialer(); err != nil {
+				log.Fatalf("-socks5-proxy: %v", err)
+			}
+		}
+		if *sourceStrategy == "failover" {
+			go redialFailover(srcs, dial)
+		} else {
+			for _, src := range srcs {
+				go redial(src, dial)
+			}
+		}
+	}
+	if *debugListen != "" {
+		if err := serveDebug(*debugListen); err != nil {
+			log.Fatalf("-debug-listen: %v", err)
+		}
+	}
+	if *pushgatewayURL != "" {
+		go pushMetrics(*pushgatewayURL, *pushgatewayJob, *pushgatewayInterval)
+	}
+	if *maxScrapes > 0 {
+		scrapeSlots = make(chan struct{}, *maxScrapes)
+	}
+	if *serveMetrics {
+		if err := handleMetricsPaths(http.DefaultServeMux, cfg.MetricsPaths); err != nil {
+			log.Fatalf("-config: %v", err)
+		}
+	}
+	http.HandleFunc("/healthz", healthz)
+	http.HandleFunc("/expire", expireDevice)
+	http.Handle("/snapshot", limitScrapes(http.HandlerFunc(serveSnapshot)))
+	http.HandleFunc("/config", serveConfig)
+	http.HandleFunc("/parse-errors", serveParseErrors)
+	if *reconnectToken != "" {
+		http.HandleFunc("/reconnect", serveReconnect)
+	}
+	if *maintenanceToken != "" {
+		http.HandleFunc("/maintenance", serveMaintenance)
+	}
+	if *injectToken != "" {
+		http.HandleFunc("/inject", serveInject)
+	}
+	serveHTTP(*listen)
 }
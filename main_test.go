@@ -0,0 +1,209 @@
+package main
+
+import (
+	"flag"
+	"io"
+	"log"
+	"math"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+func TestMain(m *testing.M) {
+	if _, err := buildRoutes(nil); err != nil {
+		log.Fatal(err)
+	}
+	log.SetOutput(io.Discard)
+	// Throttled logging would summarize in the background, on whatever
+	// clock a test has set.
+	flag.Set("log-rate", "0")
+	os.Exit(m.Run())
+}
+
+// setFlag sets the flag name to value for the rest of t.
+func setFlag(t testing.TB, name, value string) {
+	t.Helper()
+	old := flag.Lookup(name).Value.String()
+	if err := flag.Set(name, value); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { flag.Set(name, old) })
+}
+
+// setConfig sets the configuration to c for the rest of t.
+func setConfig(t testing.TB, c config) {
+	old := cfg
+	cfg = c
+	t.Cleanup(func() { cfg = old })
+}
+
+// testConnection returns the first connection to a source of t's own.
+func testConnection(t testing.TB) *connection {
+	return newConnection(configuredSource("test:"+t.Name()), 1)
+}
+
+// collect returns the metrics c currently exports.
+func collect(c prometheus.Collector) []*dto.Metric {
+	ch := make(chan prometheus.Metric)
+	go func() {
+		c.Collect(ch)
+		close(ch)
+	}()
+	var ms []*dto.Metric
+	for m := range ch {
+		pb := &dto.Metric{}
+		if err := m.Write(pb); err == nil {
+			ms = append(ms, pb)
+		}
+	}
+	return ms
+}
+
+// labelValue returns the value of m's label name.
+func labelValue(m *dto.Metric, name string) string {
+	for _, l := range m.Label {
+		if l.GetName() == name {
+			return l.GetValue()
+		}
+	}
+	return ""
+}
+
+// gaugeValue returns the value of vec's gauge for device, if it has one.
+func gaugeValue(vec *sensorGaugeVec, device string) (float64, bool) {
+	for _, m := range collect(vec.get()) {
+		if labelValue(m, "device") == device {
+			return m.GetGauge().GetValue(), true
+		}
+	}
+	return 0, false
+}
+
+// counterValue returns the total of c's counters.
+func counterValue(c prometheus.Collector) float64 {
+	var total float64
+	for _, m := range collect(c) {
+		total += m.GetCounter().GetValue()
+	}
+	return total
+}
+
+func TestFormatDevice(t *testing.T) {
+	for _, tt := range []struct {
+		ID, model string
+		want      string
+	}{
+		{"28ff0a1b2c3d", "DS18B20", "ds18b20-00ff0a1b2c3d"},
+		{"28FF0A1B2C3D4E5F", "DS18B20", "ds18b20-ff0a1b2c3d4e5f"},
+		{"28000a0b0c0d0e0f", "DS18B20", "ds18b20-000a0b0c0d0e0f"},
+		{"28000000000000000001", "DS18B20", "ds18b20-000000000000000001"},
+		{"10abc", "DS18S20", "ds18s20-000000000abc"},
+		{"28", "DS18B20", "28"},
+		{"node-1", "node", "node-1"},
+		{"", "DHT22", "dht22"},
+	} {
+		if got := formatDevice(tt.ID, tt.model); got != tt.want {
+			t.Errorf("formatDevice(%q, %q) = %q; want %q", tt.ID, tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestRecordHumidity(t *testing.T) {
+	for _, tt := range []struct {
+		name        string
+		line        string
+		device      string
+		humidity    float64
+		temperature float64 // or NaN for none
+	}{
+		{"fahrenheit", "100 humidity DHT22 45.2 70.5", "dht22", 45.2, 21.4},
+		{"celsius", "100 humidity AM2302 45.2 21.45", "am2302", 45.2, 21.45},
+		{"garbled temperature", "100 humidity DHT22 45.2 70..5", "dht22", 45.2, math.NaN()},
+		{"embedded units", "100 humidity DHT22 45.2% 21.5C", "dht22", 45.2, 21.5},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			temperatureGauges.get().Reset()
+			humidityGauges.get().Reset()
+			if !processLine(tt.line, testConnection(t)) {
+				t.Fatalf("processLine(%q) didn't match", tt.line)
+			}
+			if h, ok := gaugeValue(humidityGauges, tt.device); !ok || h != tt.humidity {
+				t.Errorf("humidity = %v, %v; want %v", h, ok, tt.humidity)
+			}
+			c, ok := gaugeValue(temperatureGauges, tt.device)
+			if math.IsNaN(tt.temperature) {
+				if ok {
+					t.Errorf("temperature = %v; want none", c)
+				}
+			} else if !ok || c != tt.temperature {
+				t.Errorf("temperature = %v, %v; want %v", c, ok, tt.temperature)
+			}
+		})
+	}
+}
+
+// panicky is a lineParser that panics on lines starting "panic".
+var panicky = lineParser{"panicky", func(f []string, c *connection) bool {
+	if f[0] == "panic" {
+		panic("bad line")
+	}
+	return false
+}}
+
+func TestProcessLineSafely(t *testing.T) {
+	for _, tt := range []struct {
+		line    string
+		matched bool
+		panics  float64
+	}{
+		{"panic now", false, 1},
+		{"100 temp 28ff0a1b2c02 DS18B20 70.5", true, 0},
+		{"no such line", false, 0},
+	} {
+		c := testConnection(t)
+		c.src.parsers = append([]lineParser{panicky}, lineParsers...)
+		before := counterValue(panicsRecovered)
+		if got := processLineSafely(tt.line, c); got != tt.matched {
+			t.Errorf("processLineSafely(%q) = %v; want %v", tt.line, got, tt.matched)
+		}
+		if got := counterValue(panicsRecovered) - before; got != tt.panics {
+			t.Errorf("processLineSafely(%q) recovered %v panics; want %v", tt.line, got, tt.panics)
+		}
+	}
+}
+
+func TestScanSurvivesPanics(t *testing.T) {
+	temperatureGauges.get().Reset()
+	c := testConnection(t)
+	c.src.parsers = append([]lineParser{panicky}, lineParsers...)
+	if err := scan(strings.NewReader("panic now\n100 temp 28ff0a1b2c03 DS18B20 70.5\n"), c); err != nil {
+		t.Fatalf("scan: %v", err)
+	}
+	if _, ok := gaugeValue(temperatureGauges, "ds18b20-00ff0a1b2c03"); !ok {
+		t.Error("line after the panic wasn't recorded")
+	}
+}
+
+// BenchmarkProcessLine is the whole of handling a line.  The sensor
+// package's BenchmarkParse compares its fast field matchers to regexps.
+func BenchmarkProcessLine(b *testing.B) {
+	for _, line := range []struct{ name, line string }{
+		{"ds18x20", "100 temp 28ff0a1b2c3d DS18B20 70.5"},
+		{"humidity", "100 humidity DHT22 45.2 70.5"},
+		{"generic", "100 lux bh1750 23 1234"},
+		{"unmatched", "100 something else entirely"},
+	} {
+		b.Run(line.name, func(b *testing.B) {
+			c := testConnection(b)
+			b.ReportAllocs()
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				processLine(line.line, c)
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var maintenanceToken = flag.String("maintenance-token", "", "If set, serve /maintenance, authenticated by this bearer token, to suspend series expiry and alerts while working on sensors")
+
+// maintenanceWindow is a time range in maintenance_windows.
+type maintenanceWindow struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+var (
+	maintenanceMu sync.Mutex
+	// Maintenance started by POST /maintenance, until manualUntil if that
+	// isn't zero.
+	manualMaintenance bool
+	manualUntil       time.Time
+)
+
+var maintenanceGauge = prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+	Namespace: "sensors",
+	Name:      "maintenance_mode",
+	Help:      "1 during maintenance, when series expiry and alerts are suspended",
+}, func() float64 {
+	if inMaintenance(clk.Now()) {
+		return 1
+	}
+	return 0
+})
+
+func checkMaintenanceWindows(windows []maintenanceWindow) error {
+	for i, w := range windows {
+		if !w.End.After(w.Start) {
+			return fmt.Errorf("maintenance_windows[%d]: end must be after start", i)
+		}
+	}
+	return nil
+}
+
+// inMaintenance reports whether now is during maintenance, whether started
+// by request or in one of the maintenance_windows.
+func inMaintenance(now time.Time) bool {
+	maintenanceMu.Lock()
+	defer maintenanceMu.Unlock()
+	if manualMaintenance && (manualUntil.IsZero() || now.Before(manualUntil)) {
+		return true
+	}
+	for _, w := range cfg.MaintenanceWindows {
+		if !now.Before(w.Start) && now.Before(w.End) {
+			return true
+		}
+	}
+	return false
+}
+
+// serveMaintenance handles /maintenance: POST, with an optional ?for=
+// duration, starts maintenance, DELETE ends it, and each, like GET,
+// answers with whether it's now in effect.  Ending it doesn't end any
+// maintenance window in progress.
+func serveMaintenance(w http.ResponseWriter, r *http.Request) {
+	if !hasBearerToken(r, *maintenanceToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	switch r.Method {
+	case http.MethodGet:
+	case http.MethodPost:
+		var d time.Duration
+		if s := r.URL.Query().Get("for"); s != "" {
+			var err error
+			if d, err = time.ParseDuration(s); err != nil || d <= 0 {
+				http.Error(w, "bad for parameter", http.StatusBadRequest)
+				return
+			}
+		}
+		maintenanceMu.Lock()
+		manualMaintenance, manualUntil = true, time.Time{}
+		if d > 0 {
+			manualUntil = clk.Now().Add(d)
+			log.Printf("Maintenance mode on for %v on request", d)
+		} else {
+			log.Printf("Maintenance mode on on request")
+		}
+		maintenanceMu.Unlock()
+	case http.MethodDelete:
+		maintenanceMu.Lock()
+		manualMaintenance = false
+		maintenanceMu.Unlock()
+		log.Printf("Maintenance mode off on request")
+	default:
+		http.Error(w, "GET, POST or DELETE only", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]bool{"maintenance": inMaintenance(clk.Now())})
+}
@@ -0,0 +1,39 @@
+package main
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// medianFor returns how many of a series' latest samples to take the
+// median of, with the same precedence as seriesTTL; 0 or 1 for none.
+func medianFor(labels prometheus.Labels) int {
+	if n, ok := cfg.DeviceMedian[labels["device"]]; ok {
+		return n
+	}
+	if n, ok := cfg.DeviceMedian[labels["id"]]; ok {
+		return n
+	}
+	return cfg.ModelMedian[labels["model"]]
+}
+
+// median adds a sample to s's recent ones, returning the median of the
+// last medianFor of them (or of as many as there are yet), which rejects
+// one-off spikes that lone samples would let through.  Samples from before
+// a gap longer than -max-export-age, having been left out of scrapes, are
+// forgotten rather than let a reading then outvote the current ones.
+// seriesMu must be held.
+func (s *series) median(v float64, prev, now time.Time) float64 {
+	n := medianFor(s.labels)
+	if n <= 1 {
+		return v
+	}
+	if *maxExportAge > 0 && now.Sub(prev) > *maxExportAge {
+		s.recent = s.recent[:0]
+	}
+	if s.recent = append(s.recent, v); len(s.recent) > n {
+		s.recent = s.recent[len(s.recent)-n:]
+	}
+	return medianOf(s.recent)
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var modelInName = flag.Bool("model-in-name", false, "Name sensor metrics per model (sensors_<model>_<metric>) rather than labelling them by model")
+
+var (
+	modelVecsMu sync.Mutex
+	modelVecs   = map[string]*sensorGaugeVec{}
+)
+
+// vecFor resolves the vec and labels a sensor series is exported by.
+// Normally that's just vec and labels, but with -model-in-name each model
+// gets its own vec, created and registered on its first sample.
+func vecFor(metric string, vec *sensorGaugeVec, labels prometheus.Labels) (*sensorGaugeVec, prometheus.Labels) {
+	if !*modelInName {
+		return vec, labels
+	}
+	model := labels["model"]
+	name := model + "_" + metric
+	modelVecsMu.Lock()
+	defer modelVecsMu.Unlock()
+	mv := modelVecs[name]
+	if mv == nil {
+		mv = newSensorGaugeVec(prometheus.GaugeOpts{
+			Namespace: "sensors",
+			Name:      name,
+			Help:      fmt.Sprintf("%s sampled from a single %s sensor", strings.ReplaceAll(metric, "_", " "), model),
+		}, []string{"id", "device"})
+		if err := registerLazily(mv, "per-model metric sensors_"+name); err != nil {
+			// Better exported under the wrong name than not at all.
+			return vec, labels
+		}
+		modelVecs[name] = mv
+	}
+	return mv, prometheus.Labels{"id": labels["id"], "device": labels["device"]}
+}
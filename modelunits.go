@@ -0,0 +1,54 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+// ds18x20Units and humidityUnits are the units the Arduino firmware's own
+// DS18x20 and humidity lines report temperatures in, by model.
+var (
+	ds18x20Units = map[string]string{
+		"ds18b20": "fahrenheit",
+		"ds18s20": "fahrenheit",
+		"ds1822":  "fahrenheit",
+	}
+	humidityUnits = map[string]string{"dht22": "fahrenheit"}
+)
+
+// temperatureUnit returns the unit a model reports temperatures in: per
+// model_units in -config, else firmware's entry for the model if it has
+// one, else default_unit.  Generic lines pass no firmware table, as they
+// don't come from the Arduino firmware.
+func temperatureUnit(model string, firmware map[string]string) string {
+	model = strings.ToLower(model)
+	if u, ok := cfg.ModelUnits[model]; ok {
+		return u
+	}
+	if u, ok := firmware[model]; ok {
+		return u
+	}
+	if cfg.DefaultUnit != "" {
+		return cfg.DefaultUnit
+	}
+	return "celsius"
+}
+
+// toCelsius converts a temperature of model's in unit to celsius.
+func toCelsius(v float64, unit, model string) float64 {
+	switch unit {
+	case "fahrenheit":
+		return roundedCelsius(v, model)
+	case "kelvin":
+		return roundTemperature(v+absoluteZero, model)
+	}
+	return v
+}
+
+func checkUnit(unit string) error {
+	switch unit {
+	case "", "celsius", "fahrenheit", "kelvin":
+		return nil
+	}
+	return fmt.Errorf("unknown unit %q", unit)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTemperatureUnit(t *testing.T) {
+	for _, tt := range []struct {
+		name     string
+		cfg      config
+		model    string
+		firmware map[string]string
+		want     string
+	}{
+		{"default", config{}, "sht31", nil, "celsius"},
+		{"firmware", config{}, "DS18B20", ds18x20Units, "fahrenheit"},
+		{"not firmware", config{}, "DS18B20", nil, "celsius"},
+		{"model_units", config{ModelUnits: map[string]string{"ds18b20": "celsius"}}, "DS18B20", ds18x20Units, "celsius"},
+		{"default_unit", config{DefaultUnit: "fahrenheit"}, "sht31", nil, "fahrenheit"},
+		{"firmware over default_unit", config{DefaultUnit: "celsius"}, "dht22", humidityUnits, "fahrenheit"},
+		{"model_units over default_unit", config{ModelUnits: map[string]string{"sht31": "celsius"}, DefaultUnit: "fahrenheit"}, "SHT31", nil, "celsius"},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			setConfig(t, tt.cfg)
+			if got := temperatureUnit(tt.model, tt.firmware); got != tt.want {
+				t.Errorf("temperatureUnit(%q) = %q; want %q", tt.model, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestModelUnitsLines(t *testing.T) {
+	setConfig(t, config{ModelUnits: map[string]string{"ds18b20": "celsius"}, DefaultUnit: "fahrenheit"})
+	for _, tt := range []struct {
+		line   string
+		device string
+		want   float64
+	}{
+		{"100 temp 28ff0a1b2c40 DS18B20 21.5", "ds18b20-00ff0a1b2c40", 21.5},
+		{"100 temp 3bff0a1b2c41 MAX31820 70.5", "max31820-00ff0a1b2c41", 21.4},
+	} {
+		temperatureGauges.get().Reset()
+		if !processLine(tt.line, testConnection(t)) {
+			t.Errorf("processLine(%q) didn't match", tt.line)
+			continue
+		}
+		if v, ok := gaugeValue(temperatureGauges, tt.device); !ok || v != tt.want {
+			t.Errorf("%q gave %v, %v; want %v", tt.line, v, ok, tt.want)
+		}
+	}
+}
+
+func TestToCelsius(t *testing.T) {
+	for _, tt := range []struct {
+		v        float64
+		unit     string
+		decimals string
+		want     float64
+	}{
+		{70.5, "fahrenheit", "1", 21.4},
+		{70.5, "fahrenheit", "2", 21.39},
+		{294.777, "kelvin", "1", 21.6},
+		{294.777, "kelvin", "2", 21.63},
+		{294.777, "kelvin", "-1", 21.627},
+		{21.627, "celsius", "1", 21.627},
+		{21.627, "", "1", 21.627},
+	} {
+		setFlag(t, "temperature-decimals", tt.decimals)
+		if got := toCelsius(tt.v, tt.unit, "ds18b20"); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("with -temperature-decimals=%s, toCelsius(%v, %q) = %v; want %v", tt.decimals, tt.v, tt.unit, got, tt.want)
+		}
+	}
+}
+
+func TestCheckUnit(t *testing.T) {
+	for _, tt := range []struct {
+		unit string
+		ok   bool
+	}{
+		{"", true},
+		{"celsius", true},
+		{"fahrenheit", true},
+		{"kelvin", true},
+		{"Celsius", false},
+		{"C", false},
+		{"rankine", false},
+	} {
+		if err := checkUnit(tt.unit); (err == nil) != tt.ok {
+			t.Errorf("checkUnit(%q) = %v; want ok %v", tt.unit, err, tt.ok)
+		}
+	}
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var legacyCounterNames = flag.Bool("legacy-counter-names", true, "Also export the counters that predate the _total convention under their old names (deprecated; OpenMetrics scrapes never get them)")
+
+// legacyCounters are the counters named before the _total suffix was
+// adopted, each with the desc of its _total alias.
+var legacyCounters = []struct {
+	name  string
+	c     prometheus.Counter
+	alias *prometheus.Desc
+}{
+	{"sensors_connection_attempts", connectionAttempts, prometheus.NewDesc("sensors_connection_attempts_total",
+		"Attempts to connect to the gateway", nil, nil)},
+	{"sensors_connection_errors", connectionErrors, prometheus.NewDesc("sensors_connection_errors_total",
+		"Failures to connect to the gateway", nil, nil)},
+	{"sensors_samples_received", samplesReceived, prometheus.NewDesc("sensors_samples_received_total",
+		"Samples received by collector", nil, nil)},
+	{"sensors_bytes_received", bytesReceived, prometheus.NewDesc("sensors_bytes_received_total",
+		"Bytes received by collector (not necessarily in samples)", nil, nil)},
+}
+
+// counterAliases exports each legacy counter under its _total name.
+type counterAliases struct{}
+
+func (counterAliases) Describe(ch chan<- *prometheus.Desc) {
+	for _, l := range legacyCounters {
+		ch <- l.alias
+	}
+}
+
+func (counterAliases) Collect(ch chan<- prometheus.Metric) {
+	for _, l := range legacyCounters {
+		var m dto.Metric
+		if err := l.c.Write(&m); err == nil {
+			ch <- prometheus.MustNewConstMetric(l.alias, prometheus.CounterValue, m.GetCounter().GetValue())
+		}
+	}
+}
+
+// legacyCounterMetrics returns the legacy counters to register under
+// their old names, if -legacy-counter-names.
+func legacyCounterMetrics() []prometheus.Collector {
+	if !*legacyCounterNames {
+		return nil
+	}
+	var cs []prometheus.Collector
+	for _, l := range legacyCounters {
+		cs = append(cs, l.c)
+	}
+	return cs
+}
+
+// withoutLegacyCounters leaves the legacy counters' old names out of what
+// g gathers.  OpenMetrics would give them a _total suffix too, clashing
+// with their aliases.
+type withoutLegacyCounters struct {
+	g prometheus.Gatherer
+}
+
+func (w withoutLegacyCounters) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := w.g.Gather()
+	var kept []*dto.MetricFamily
+	for _, mf := range mfs {
+		legacy := false
+		for _, l := range legacyCounters {
+			legacy = legacy || mf.GetName() == l.name
+		}
+		if !legacy {
+			kept = append(kept, mf)
+		}
+	}
+	return kept, err
+}
+
+// formatAccepts are the Accept headers ?format= stands for.
+var formatAccepts = map[string]string{
+	"text":        "text/plain;version=0.0.4",
+	"openmetrics": "application/openmetrics-text;version=1.0.0",
+	"protobuf":    "application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited",
+}
+
+// metricsHandler serves g in the text format, or in OpenMetrics to
+// scrapers that ask for it, or in whatever format ?format= asks for, to
+// check the exposition with curl.  Otherwise promhttp negotiates as usual.
+func metricsHandler(g prometheus.Gatherer) http.Handler {
+	text := promhttp.HandlerFor(g, promhttp.HandlerOpts{})
+	openMetrics := promhttp.HandlerFor(withoutLegacyCounters{g}, promhttp.HandlerOpts{EnableOpenMetrics: true})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if format := r.URL.Query().Get("format"); format != "" {
+			accept, ok := formatAccepts[format]
+			if !ok {
+				http.Error(w, fmt.Sprintf("unknown format %q", format), http.StatusBadRequest)
+				return
+			}
+			r = r.Clone(r.Context())
+			r.Header.Set("Accept", accept)
+		}
+		if strings.Contains(r.Header.Get("Accept"), "application/openmetrics-text") {
+			openMetrics.ServeHTTP(w, r)
+		} else {
+			text.ServeHTTP(w, r)
+		}
+	})
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+)
+
+// maxParseErrorText bounds the text kept of each parse error.
+const maxParseErrorText = 256
+
+// parseError is something that couldn't be parsed: a whole line, or a
+// value of an otherwise recognized line.
+type parseError struct {
+	Text     string    `json:"text"`
+	Error    string    `json:"error"`
+	Endpoint string    `json:"endpoint,omitempty"`
+	At       time.Time `json:"at"`
+}
+
+var (
+	// lastParseError is the latest of any, and deviceParseErrors the
+	// latest by device, of the devices with series.  Both are guarded by
+	// seriesMu.
+	lastParseError    *parseError
+	deviceParseErrors = map[string]*parseError{}
+)
+
+// noteParseError records a parse error, as the latest of device's if it
+// has series.  seriesMu must be held.
+func noteParseError(device, text, endpoint, err string) {
+	if len(text) > maxParseErrorText {
+		text = text[:maxParseErrorText]
+	}
+	e := &parseError{Text: text, Error: err, Endpoint: endpoint, At: clk.Now()}
+	lastParseError = e
+	if device != "" && deviceSeries[device] > 0 {
+		deviceParseErrors[device] = e
+	}
+}
+
+// badValue records a value of a device's that wouldn't parse.
+func badValue(device, value string, err error) {
+	seriesMu.Lock()
+	defer seriesMu.Unlock()
+	noteParseError(device, value, "", err.Error())
+}
+
+// unmatchedLine records a line that matched no format, attributing it to
+// the device of the first of its fields that's the ID of one sampled in
+// the same connection, if any.
+func unmatchedLine(line string, f []string, c *connection) {
+	seriesMu.Lock()
+	defer seriesMu.Unlock()
+	device := ""
+	for _, field := range f {
+		if c.seen[field] {
+			device = deviceOfID(field)
+			break
+		}
+	}
+	noteParseError(device, line, c.src.endpoint, "unrecognized line")
+}
+
+// deviceOfID returns the device label of the series with a raw ID.
+// seriesMu must be held.
+func deviceOfID(ID string) string {
+	for _, s := range allSeries {
+		if s.labels["id"] == ID {
+			return s.labels["device"]
+		}
+	}
+	return ""
+}
+
+// serveParseErrors handles /parse-errors, answering with the latest parse
+// error and the latest of each device as JSON.
+func serveParseErrors(w http.ResponseWriter, r *http.Request) {
+	seriesMu.Lock()
+	resp := struct {
+		Last    *parseError            `json:"last"`
+		Devices map[string]*parseError `json:"devices"`
+	}{lastParseError, map[string]*parseError{}}
+	for device, e := range deviceParseErrors {
+		resp.Devices[device] = e
+	}
+	seriesMu.Unlock()
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aqua/wrt54gl-sensor-collector/sensor"
+)
+
+// lineParser recognizes one family of sample line formats.  parse records
+// any sample in a line's fields f, returning false if f isn't in its
+// format.
+type lineParser struct {
+	name  string
+	parse func(f []string, c *connection) bool
+}
+
+// lineParsers are tried in order on each line, by sources that don't have
+// parsers configured in source_parsers.
+var lineParsers = []lineParser{
+	{"combo", parseCombo},
+	{"ds18x20", parseDS18x20},
+	{"humidity", parseHumidity},
+	{"generic", parseGeneric},
+	{"kv", parseKVLine},
+}
+
+// parsersNamed returns the lineParsers with the given names, in the given
+// order, or all of them if there are none.
+func parsersNamed(names []string) ([]lineParser, error) {
+	if len(names) == 0 {
+		return lineParsers, nil
+	}
+	var ps []lineParser
+	for _, name := range names {
+		found := false
+		for _, p := range lineParsers {
+			if p.name == name {
+				ps = append(ps, p)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown parser %q", name)
+		}
+	}
+	return ps, nil
+}
+
+// The sensor package's parsers of the firmware's line formats, with the
+// leading field per -timestamp-format.
+var (
+	ds18x20Parser  = sensor.DS18x20{Timestamp: isTimestampField}
+	humidityParser = sensor.Humidity{Timestamp: isTimestampField}
+	genericParser  = sensor.Generic{Timestamp: isTimestampField}
+	kvParser       = sensor.KV{Timestamp: isTimestampField}
+)
+
+func parseDS18x20(f []string, c *connection) bool {
+	samples, ok := ds18x20Parser.Parse(f)
+	if !ok {
+		return false
+	}
+	s := samples[0]
+	if s.Model == "" {
+		s.Model = *defaultModel
+	}
+	if o, ok := noteSample(s.Timestamp, s.ID, s.Model, c); ok {
+		recordDS18x20(s.Kind, s.ID, s.Model, s.Value, valueUnits[strings.ToLower(s.Unit)], o)
+	}
+	return true
+}
+
+func parseHumidity(f []string, c *connection) bool {
+	samples, ok := humidityParser.Parse(f)
+	if !ok {
+		return false
+	}
+	h, t := samples[0], samples[1]
+	if o, ok := noteSample(h.Timestamp, h.Model, h.Model, c); ok {
+		fahrenheit := temperatureUnit(h.Model, humidityUnits) == "fahrenheit"
+		if c.src.fahrenheitModels != nil {
+			fahrenheit = c.src.fahrenheitModels[strings.ToLower(h.Model)]
+		}
+		recordHumidity(h.Kind, h.Model, h.Value, t.Value, fahrenheit, o)
+	}
+	return true
+}
+
+func parseGeneric(f []string, c *connection) bool {
+	samples, ok := genericParser.Parse(f)
+	if !ok {
+		return false
+	}
+	s := samples[0]
+	if o, ok := noteSample(s.Timestamp, s.ID, s.Model, c); ok {
+		recordGeneric(s.Kind, s.Model, s.ID, s.Value, o)
+	}
+	return true
+}
+
+func parseKVLine(f []string, c *connection) bool {
+	samples, ok := kvParser.Parse(f)
+	if !ok {
+		return false
+	}
+	if len(samples) == 0 {
+		// Just an id and model, with nothing to record.
+		return true
+	}
+	s := samples[0]
+	if o, ok := noteSample(s.Timestamp, s.ID, s.Model, c); ok {
+		recordKV(samples, o)
+	}
+	return true
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func FuzzParseLine(f *testing.F) {
+	for _, line := range []string{
+		// DS18x20
+		"100 temp 28ff0a1b2c3d DS18B20 70.5",
+		"100 temp 28ff0a1b2c3d DS18B20 21.5 C",
+		"100 temp 28ff0a1b2c3d DS18B20 296.6K",
+		"100 temp 28ff0a1b2c3d -1e308",
+		"100 humidity DHT22 45.2 70.5",
+		// generic
+		"100 lux bh1750 23 1234",
+		"100 co2 scd30 61 415",
+		"100 vbat node 7 3.7",
+		// kv
+		"id=28ff0a1b2c3d model=ds18b20 temp=21.5",
+		"100 id=node-1 temp=21.5 humidity=40% battery=3.1",
+		"id=x temp=NaN",
+		// timestamped
+		"1700000000 temp 28ff0a1b2c3d DS18B20 70.5",
+		"1700000000 id=node-1 temp=-40",
+		"99999999999999999999 temp 28ff0a1b2c3d DS18B20 70.5",
+	} {
+		f.Add(line)
+	}
+	setFlag(f, "timestamp-format", "unix")
+	f.Fuzz(func(t *testing.T, line string) {
+		processLine(line, testConnection(t))
+		for _, c := range enabledMetrics(nil) {
+			for _, m := range collect(c) {
+				if v := m.GetGauge().GetValue(); math.IsNaN(v) || math.IsInf(v, 0) {
+					t.Fatalf("processLine(%q) left a gauge at %v: %v", line, v, m)
+				}
+			}
+		}
+	})
+}
@@ -0,0 +1,88 @@
+package main
+
+import "testing"
+
+func TestDefaultModel(t *testing.T) {
+	for _, tt := range []struct {
+		defaultModel string
+		line         string
+		device       string
+		want         float64
+	}{
+		{"ds18b20", "100 temp 28ff0a1b2c10 70.5", "ds18b20-00ff0a1b2c10", 21.4},
+		{"ds18s20", "100 temp 10ff0a1b2c11 70.5", "ds18s20-00ff0a1b2c11", 21.4},
+		// Not a firmware model, so taken as celsius.
+		{"max31820", "100 temp 3bff0a1b2c12 21.5", "max31820-00ff0a1b2c12", 21.5},
+		// A model given in the line wins.
+		{"ds18s20", "100 temp 28ff0a1b2c13 DS18B20 70.5", "ds18b20-00ff0a1b2c13", 21.4},
+	} {
+		setFlag(t, "default-model", tt.defaultModel)
+		temperatureGauges.get().Reset()
+		if !processLine(tt.line, testConnection(t)) {
+			t.Errorf("with -default-model=%s, processLine(%q) didn't match", tt.defaultModel, tt.line)
+			continue
+		}
+		if v, ok := gaugeValue(temperatureGauges, tt.device); !ok || v != tt.want {
+			t.Errorf("with -default-model=%s, %q gave %s = %v, %v; want %v", tt.defaultModel, tt.line, tt.device, v, ok, tt.want)
+		}
+	}
+}
+
+func TestSourceFahrenheitModels(t *testing.T) {
+	for _, tt := range []struct {
+		name   string
+		models []string // or nil for none configured
+		line   string
+		device string
+		want   float64
+	}{
+		{"default", nil, "100 humidity DHT22 45.2 70.5", "dht22", 21.4},
+		{"default celsius", nil, "100 humidity AM2302 45.2 21.5", "am2302", 21.5},
+		{"listed", []string{"AM2302"}, "100 humidity AM2302 45.2 70.5", "am2302", 21.4},
+		{"unlisted", []string{"AM2302"}, "100 humidity DHT22 45.2 21.5", "dht22", 21.5},
+		{"none", []string{}, "100 humidity DHT22 45.2 21.5", "dht22", 21.5},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := config{}
+			if tt.models != nil {
+				c.SourceFahrenheitModels = map[string][]string{"test:" + t.Name(): tt.models}
+			}
+			setConfig(t, c)
+			temperatureGauges.get().Reset()
+			if !processLine(tt.line, testConnection(t)) {
+				t.Fatalf("processLine(%q) didn't match", tt.line)
+			}
+			if v, ok := gaugeValue(temperatureGauges, tt.device); !ok || v != tt.want {
+				t.Errorf("%q gave %v, %v; want %v", tt.line, v, ok, tt.want)
+			}
+		})
+	}
+}
+
+func TestDS18x20UnitField(t *testing.T) {
+	for _, tt := range []struct {
+		line   string
+		device string
+		want   float64 // or 0 for none
+	}{
+		{"100 temp 28ff0a1b2c70 DS18B20 21.5 C", "ds18b20-00ff0a1b2c70", 21.5},
+		{"100 temp 28ff0a1b2c71 DS18B20 21.5 °C", "ds18b20-00ff0a1b2c71", 21.5},
+		{"100 temp 28ff0a1b2c72 DS18B20 70.5 F", "ds18b20-00ff0a1b2c72", 21.4},
+		{"100 temp 28ff0a1b2c73 DS18B20 294.65 K", "ds18b20-00ff0a1b2c73", 21.5},
+		{"100 temp 28ff0a1b2c74 DS18B20 294.65 \u212a", "ds18b20-00ff0a1b2c74", 21.5},
+		{"100 temp 28ff0a1b2c75 DS18B20 294.65 k", "ds18b20-00ff0a1b2c75", 21.5},
+		// The unit field is believed over one glued to the value.
+		{"100 temp 28ff0a1b2c76 DS18B20 21.5F C", "ds18b20-00ff0a1b2c76", 21.5},
+		{"100 temp 28ff0a1b2c77 DS18B20 21.5% C", "ds18b20-00ff0a1b2c77", 0},
+	} {
+		temperatureGauges.get().Reset()
+		if !processLine(tt.line, testConnection(t)) {
+			t.Errorf("processLine(%q) didn't match", tt.line)
+			continue
+		}
+		v, ok := gaugeValue(temperatureGauges, tt.device)
+		if tt.want == 0 && ok || tt.want != 0 && (!ok || v != tt.want) {
+			t.Errorf("%q gave %v, %v; want %v", tt.line, v, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,118 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	peerReverseDNS    = flag.Bool("peer-reverse-dns", false, "Label peers by their reverse DNS name rather than their address, falling back to the address")
+	reverseDNSTimeout = flag.Duration("reverse-dns-timeout", 2*time.Second, "How long to wait for each -peer-reverse-dns lookup")
+)
+
+var maxPeers = flag.Int("max-peers", 32, "Maximum number of distinct peer addresses to label sensors_peer_connections_total with; the rest are counted as \"other\"")
+
+var (
+	peerConnections = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sensors",
+		Name:      "peer_connections_total",
+		Help:      "Connections made, by remote peer address",
+	}, []string{"peer"})
+	remotePeers = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: "sensors",
+		Name:      "remote_peers",
+		Help:      "Distinct remote peer addresses connected to since startup",
+	})
+)
+
+var (
+	peersMu sync.Mutex
+	peers   = map[string]bool{} // whether each peer has its own label
+)
+
+// notePeer counts a connection to or from addr.  Only the host is used, so
+// connections from different ports count as the same peer.  The first
+// -max-peers peers seen get their own label.
+func notePeer(addr net.Addr) {
+	if addr == nil {
+		return
+	}
+	peer := addr.String()
+	if host, _, err := net.SplitHostPort(peer); err == nil {
+		peer = host
+	}
+	if *peerReverseDNS {
+		peer = peerName(peer)
+	}
+	peersMu.Lock()
+	labelled, ok := peers[peer]
+	if !ok {
+		labelled = len(peers) < *maxPeers
+		peers[peer] = labelled
+		remotePeers.Set(float64(len(peers)))
+	}
+	peersMu.Unlock()
+	if !labelled {
+		peer = "other"
+	}
+	peerConnections.WithLabelValues(peer).Inc()
+}
+
+// Reverse lookups are cached for an hour, failures included, so a
+// reconnecting gateway doesn't cost a lookup every time.  The cache holds
+// up to reverseNamesMax addresses, evicting the longest cached.
+const (
+	reverseNameTTL  = time.Hour
+	reverseNamesMax = 256
+)
+
+type reverseName struct {
+	name string
+	at   time.Time
+}
+
+var (
+	reverseNamesMu sync.Mutex
+	reverseNames   = map[string]reverseName{}
+)
+
+// peerName returns the reverse DNS name of the address host, or host
+// itself if it has none or the lookup fails or times out.
+func peerName(host string) string {
+	if net.ParseIP(host) == nil {
+		return host // already a name
+	}
+	now := clk.Now()
+	reverseNamesMu.Lock()
+	r, ok := reverseNames[host]
+	reverseNamesMu.Unlock()
+	if ok && now.Sub(r.at) < reverseNameTTL {
+		return r.name
+	}
+	name := host
+	ctx, cancel := context.WithTimeout(context.Background(), *reverseDNSTimeout)
+	names, err := net.DefaultResolver.LookupAddr(ctx, host)
+	cancel()
+	if err == nil && len(names) > 0 {
+		name = strings.TrimSuffix(names[0], ".")
+	}
+	reverseNamesMu.Lock()
+	defer reverseNamesMu.Unlock()
+	if _, ok := reverseNames[host]; !ok && len(reverseNames) >= reverseNamesMax {
+		var oldest string
+		for h, r := range reverseNames {
+			if oldest == "" || r.at.Before(reverseNames[oldest].at) {
+				oldest = h
+			}
+		}
+		delete(reverseNames, oldest)
+	}
+	reverseNames[host] = reverseName{name, now}
+	return name
+}
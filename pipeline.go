@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+// stage is a step of the pipeline samples go through in setGauge, once
+// converted to the exported units, applied to s, returning the sample as
+// it comes out, or false if it's dropped.  copied is true for Kelvin
+// copies of Celsius series, which aren't samples of their own.
+type stage struct {
+	name  string
+	apply func(s *series, v float64, prev, now time.Time, copied bool) (float64, bool)
+}
+
+// stages are every stage, in the default order.
+var stages = []stage{
+	{"decimate", decimateStage},
+	{"rate_of_change", rateOfChangeStage},
+	{"median", func(s *series, v float64, prev, now time.Time, copied bool) (float64, bool) {
+		return s.median(v, prev, now), true
+	}},
+	{"smooth", func(s *series, v float64, prev, now time.Time, copied bool) (float64, bool) {
+		return s.smooth(v, prev, now), true
+	}},
+}
+
+// stagesNamed returns the stages with the given names, in the given order.
+// Each may only be named once.
+func stagesNamed(names []string) ([]stage, error) {
+	var ss []stage
+	named := map[string]bool{}
+	for _, name := range names {
+		if named[name] {
+			return nil, fmt.Errorf("stage %q named twice", name)
+		}
+		named[name] = true
+		found := false
+		for _, st := range stages {
+			if st.name == name {
+				ss = append(ss, st)
+				found = true
+				break
+			}
+		}
+		if !found {
+			return nil, fmt.Errorf("unknown stage %q", name)
+		}
+	}
+	return ss, nil
+}
+
+// defaultStages returns the stages of sources without a pipeline of their
+// own in source_pipelines: those of the pipeline in -config, else all.
+// loadConfig has checked it.
+func defaultStages() []stage {
+	if cfg.Pipeline == nil {
+		return stages
+	}
+	ss, _ := stagesNamed(cfg.Pipeline)
+	return ss
+}
+
+// stages returns the pipeline of the samples from o.
+func (o origin) stages() []stage {
+	if o.src == nil {
+		return defaultStages()
+	}
+	return o.src.stages
+}
+
+// decimateStage drops samples per s's decimation.  Decimated samples have
+// still been taken as signs of life.
+func decimateStage(s *series, v float64, prev, now time.Time, copied bool) (float64, bool) {
+	if s.keep(now) {
+		return v, true
+	}
+	decimatedSamples.Inc()
+	if !copied {
+		rejectedSamples.WithLabelValues(s.labels["device"], "decimated").Inc()
+		auditRejection(s.labels["device"], "decimated")
+	}
+	debugf("decimated %s: %s = %g", s.labels["device"], s.metric, v)
+	return v, false
+}
+
+// rateOfChangeStage drops samples that change implausibly fast per
+// model_max_rates.
+func rateOfChangeStage(s *series, v float64, prev, now time.Time, copied bool) (float64, bool) {
+	if s.plausible(v, now) {
+		return v, true
+	}
+	if !copied {
+		skipSample("rate_of_change", s.labels["device"])
+	}
+	return v, false
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"flag"
+	"net"
+	"time"
+)
+
+var pollCommand = flag.String("poll-command", "", "If set, for gateways that only answer requests, write this to the connection every -poll-interval, with the same escapes as -connect-command")
+var pollInterval = flag.Duration("poll-interval", 30*time.Second, "How often to write -poll-command")
+var pollTimeout = flag.Duration("poll-timeout", 5*time.Second, "How long to wait for the first line of the response to -poll-command before reconnecting")
+
+// poll writes -poll-command to conn straight away and every -poll-interval
+// until done is closed, for gateways that send readings only when asked.
+// A failed write, or no line within -poll-timeout, is a connection error
+// and closes conn, so the scan loop notices and reconnects.  Lines read
+// are otherwise processed as usual, however many the response has.
+func poll(conn net.Conn, c *connection, done <-chan struct{}) {
+	msg := []byte(commandUnescaper.Replace(*pollCommand))
+	ticks, stop := clk.NewTicker(*pollInterval)
+	defer stop()
+	for {
+		// Only lines after the request answer it.
+		select {
+		case <-c.responses:
+		default:
+		}
+		if _, err := conn.Write(msg); err != nil {
+			throttledLogf("connection error", "Error sending poll command to %s: %v", c.src.endpoint, err)
+			c.src.countError()
+			conn.Close()
+			return
+		}
+		select {
+		case <-done:
+			return
+		case <-c.responses:
+		case <-clk.After(*pollTimeout):
+			throttledLogf("connection error", "No response to poll from %s within %v; reconnecting", c.src.endpoint, *pollTimeout)
+			c.src.countError()
+			conn.Close()
+			return
+		}
+		select {
+		case <-done:
+			return
+		case <-ticks:
+		}
+	}
+}
+
+// noteResponse tells poll that a line has been read, if it's waiting.
+func (c *connection) noteResponse() {
+	if c.responses == nil {
+		return
+	}
+	select {
+	case c.responses <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"math"
+	"strings"
+	"sync"
+)
+
+var temperatureDecimals = flag.Int("temperature-decimals", 1, "Decimal places to round temperatures converted from fahrenheit to; negative keeps them at full precision; per-model overrides go in -config")
+var precisionLossWarn = flag.Float64("precision-loss-warn", 0, "If set, log once per model when rounding a converted temperature discards more than this many degrees")
+
+var (
+	precisionWarnedMu sync.Mutex
+	// precisionWarned is the models -precision-loss-warn has logged.
+	precisionWarned = map[string]bool{}
+)
+
+// temperatureDecimalsFor returns the decimal places to round a model's
+// converted temperatures to: its model_temperature_decimals, if any, else
+// -temperature-decimals.
+func temperatureDecimalsFor(model string) int {
+	if d, ok := cfg.ModelTemperatureDecimals[strings.ToLower(model)]; ok {
+		return d
+	}
+	return *temperatureDecimals
+}
+
+// roundTemperature rounds a converted temperature of model's per
+// temperatureDecimalsFor, noting what's discarded in the rounding residual
+// and, past -precision-loss-warn, the log.
+func roundTemperature(c float64, model string) float64 {
+	decimals := temperatureDecimalsFor(model)
+	if decimals < 0 {
+		return c
+	}
+	scale := math.Pow10(decimals)
+	r := math.Round(c*scale) / scale
+	if *debugMetrics {
+		roundingResidual.Observe(c - r)
+	}
+	if *precisionLossWarn > 0 && math.Abs(c-r) > *precisionLossWarn {
+		warnPrecisionLoss(c, r, model, decimals)
+	}
+	return r
+}
+
+func warnPrecisionLoss(c, r float64, model string, decimals int) {
+	precisionWarnedMu.Lock()
+	defer precisionWarnedMu.Unlock()
+	if precisionWarned[model] {
+		return
+	}
+	precisionWarned[model] = true
+	log.Printf("Rounding %s temperatures to %d decimal places discarded %.3g°: %g became %g (see -temperature-decimals)", model, decimals, math.Abs(c-r), c, r)
+}
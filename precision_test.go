@@ -0,0 +1,49 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestRoundTemperature(t *testing.T) {
+	setConfig(t, config{ModelTemperatureDecimals: map[string]int{"ds18b20": -1, "ds1822": 0, "max31820": 2}})
+	full := (70.5 - 32) * 5 / 9
+	for _, tt := range []struct {
+		model    string
+		decimals string
+		want     float64
+	}{
+		{"DS18S20", "1", 21.4},
+		{"DS18S20", "2", 21.39},
+		{"DS18S20", "-1", full},
+		{"DS18B20", "1", full},
+		{"ds1822", "2", 21},
+		{"MAX31820", "0", 21.39},
+	} {
+		setFlag(t, "temperature-decimals", tt.decimals)
+		if got := roundTemperature(full, tt.model); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("with -temperature-decimals=%s, roundTemperature(%v, %q) = %v; want %v", tt.decimals, full, tt.model, got, tt.want)
+		}
+	}
+}
+
+func TestModelTemperatureDecimalsLines(t *testing.T) {
+	setConfig(t, config{ModelTemperatureDecimals: map[string]int{"ds18b20": -1}})
+	for _, tt := range []struct {
+		line   string
+		device string
+		want   float64
+	}{
+		{"100 temp 28ff0a1b2c50 DS18B20 70.5", "ds18b20-00ff0a1b2c50", (70.5 - 32) * 5 / 9},
+		{"100 temp 22ff0a1b2c51 DS1822 70.5", "ds1822-00ff0a1b2c51", 21.4},
+	} {
+		t.Cleanup(func() { forgetDevice(tt.device) })
+		if !processLine(tt.line, testConnection(t)) {
+			t.Errorf("processLine(%q) didn't match", tt.line)
+			continue
+		}
+		if v, ok := gaugeValue(temperatureGauges, tt.device); !ok || math.Abs(v-tt.want) > 1e-9 {
+			t.Errorf("%q gave %v, %v; want %v", tt.line, v, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/push"
+)
+
+var pushgatewayURL = flag.String("pushgateway-url", "", "If set, push all metrics to this Prometheus Pushgateway every -pushgateway-interval")
+var pushgatewayJob = flag.String("pushgateway-job", "sensors", "Job name to push metrics to the Pushgateway under")
+var pushgatewayInterval = flag.Duration("pushgateway-interval", 30*time.Second, "How often to push metrics to -pushgateway-url")
+var serveMetrics = flag.Bool("serve-metrics", true, "Serve metrics for scraping on /metrics (and any metrics_paths); turn off to only push")
+
+var pushErrors = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "push_errors_total",
+	Help:      "Failed pushes to -pushgateway-url",
+})
+
+// pushMetrics pushes the registry to the Pushgateway every interval,
+// replacing the job's previous push.  A failed push is retried sooner,
+// backing off from a second up to the interval.
+func pushMetrics(url, job string, interval time.Duration) {
+	p := push.New(url, job).Gatherer(unitSystemGatherer{registry})
+	retry := time.Second
+	for {
+		if err := p.Push(); err != nil {
+			log.Printf("Error pushing to %s: %v", url, err)
+			pushErrors.Inc()
+			if retry < interval {
+				clk.Sleep(retry)
+				retry *= 2
+				continue
+			}
+		}
+		retry = time.Second
+		clk.Sleep(interval)
+	}
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"time"
+)
+
+// maxRateFor returns the most a series' metric may change by per second,
+// per model_max_rates, or 0 for no limit.  Kelvin copies are limited like
+// the celsius series they're copied from.
+func maxRateFor(metric, model string) float64 {
+	if metric == "temperature_kelvin" {
+		metric = "temperature_degrees_celsius"
+	}
+	return cfg.ModelMaxRates[model][metric]
+}
+
+// plausible reports whether a sample is within its model's maximum rate
+// of change of the last one let through, and if so takes it as the one to
+// compare the next against.  The first sample has nothing to be compared
+// with, and the rate is over the time since the last sample let through,
+// so even a big change is allowed after a long enough gap; with
+// -max-export-age, a gap longer than that starts afresh anyway, as does
+// one across a clock jump, whose length isn't known.  seriesMu must be
+// held.
+func (s *series) plausible(v float64, now time.Time) bool {
+	limit := maxRateFor(s.metric, s.labels["model"])
+	if limit <= 0 {
+		return true
+	}
+	if !s.plausibleAt.IsZero() && (*maxExportAge <= 0 || now.Sub(s.plausibleAt) <= *maxExportAge) && !clockJumpedSince(s.plausibleAt) {
+		elapsed := now.Sub(s.plausibleAt).Seconds()
+		if math.Abs(v-s.plausibleValue) > limit*elapsed {
+			return false
+		}
+	}
+	s.plausibleValue, s.plausibleAt = v, now
+	return true
+}
+
+func checkMaxRates(rates map[string]map[string]float64) error {
+	for model, metrics := range rates {
+		for metric, limit := range metrics {
+			if limit <= 0 || math.IsNaN(limit) {
+				return fmt.Errorf("model_max_rates[%q][%q]: must be positive, not %v", model, metric, limit)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,25 @@
+package main
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// rawTemperatureGauges are temperatures as received, for checking unit
+// conversions and transforms against what sensors actually send.
+var rawTemperatureGauges = newSensorGaugeVec(prometheus.GaugeOpts{
+	Namespace: "sensors",
+	Name:      "temperature_raw",
+	Help:      "Temperature sampled from a single sensor as received, before conversion and rounding, in unit (-debug-metrics only)",
+}, []string{"id", "device", "model", "unit"})
+
+// recordRawTemperature records the value a temperature was converted from,
+// with -debug-metrics.  unit is what it was taken to be in, which is empty
+// for values a transform converts, such as thermistor readings.
+func recordRawTemperature(labels prometheus.Labels, v float64, unit string) {
+	if !*debugMetrics {
+		return
+	}
+	l := prometheus.Labels{"unit": unit}
+	for k, val := range labels {
+		l[k] = val
+	}
+	rawTemperatureGauges.With(l).Set(v)
+}
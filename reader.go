@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"flag"
+	"io"
+	"strings"
+)
+
+var framing = flag.String("framing", "newline", "How messages are delimited in the input stream: newline, length-prefixed (a 2-byte big-endian length before each message), or binary (fixed-size binary frames rather than lines)")
+
+// countingReader counts the bytes read through it.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// newlineSplitter returns a bufio.SplitFunc for lines ended by any mix of
+// \n, \r\n and bare \r, as captures from different systems have.  A line
+// ended by \r is returned straight away, rather than waiting to see if an
+// \n follows, so the splitter remembers to skip one if it does.
+func newlineSplitter() bufio.SplitFunc {
+	skipLF := false
+	return func(data []byte, atEOF bool) (int, []byte, error) {
+		start := 0
+		if skipLF && len(data) > 0 {
+			skipLF = false
+			if data[0] == '\n' {
+				start = 1
+			}
+		}
+		if i := bytes.IndexAny(data[start:], "\r\n"); i >= 0 {
+			skipLF = data[start+i] == '\r'
+			return start + i + 1, data[start : start+i], nil
+		}
+		if atEOF && len(data) > start {
+			return len(data), data[start:], nil
+		}
+		// Consume any skipped \n now, as skipLF has been reset.  (Only
+		// when not at EOF: Scanner stops at EOF on a nil token.)
+		if start > 0 && !atEOF {
+			return start, nil, nil
+		}
+		return 0, nil, nil
+	}
+}
+
+// splitLines splits text into lines the same way as newlineSplitter.
+func splitLines(text string) []string {
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	return strings.Split(strings.ReplaceAll(text, "\r", "\n"), "\n")
+}
+
+// scanLengthPrefixed is a bufio.SplitFunc for messages each preceded by a
+// 2-byte big-endian length.
+func scanLengthPrefixed(data []byte, atEOF bool) (advance int, token []byte, err error) {
+	if len(data) >= 2 {
+		n := 2 + int(binary.BigEndian.Uint16(data))
+		if len(data) >= n {
+			return n, data[2:n], nil
+		}
+	}
+	if atEOF && len(data) > 0 {
+		return 0, nil, io.ErrUnexpectedEOF
+	}
+	return 0, nil, nil
+}
+
+// lineScanner is a bufio.Scanner over messages (normally lines, per
+// -framing) that can tell how much of what it has read is still buffered,
+// unreturned, for sensors_bytes_dropped_total.
+type lineScanner struct {
+	*bufio.Scanner
+	in       *countingReader
+	consumed int64
+}
+
+func newLineScanner(r io.Reader) *lineScanner {
+	s := &lineScanner{in: &countingReader{r: r}}
+	s.Scanner = bufio.NewScanner(s.in)
+	split := newlineSplitter()
+	switch *framing {
+	case "length-prefixed":
+		split = scanLengthPrefixed
+		// Room for the largest possible message.
+		s.Buffer(make([]byte, 4096), 2+0xffff)
+	case "binary":
+		split = scanFrames
+	}
+	s.Split(func(data []byte, atEOF bool) (int, []byte, error) {
+		advance, token, err := split(data, atEOF)
+		s.consumed += int64(advance)
+		return advance, token, err
+	})
+	return s
+}
+
+// buffered returns the number of bytes read but not yet split into lines.
+func (s *lineScanner) buffered() int64 {
+	return s.in.n - s.consumed
+}
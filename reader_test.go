@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestNewlineSplitter(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want []string
+	}{
+		{"a\nb\n", []string{"a", "b"}},
+		{"a\r\nb\r\n", []string{"a", "b"}},
+		{"a\rb\r", []string{"a", "b"}},
+		{"a\r\nb\nc\rd", []string{"a", "b", "c", "d"}},
+		{"a\n\nb", []string{"a", "", "b"}},
+		{"a\r\r\nb", []string{"a", "", "b"}},
+		{"a\n\r\nb", []string{"a", "", "b"}},
+		{"\r\n", []string{""}},
+		{"a\r", []string{"a"}},
+		{"", nil},
+	} {
+		// One byte at a time, a \r\n is split across reads.
+		for _, r := range []io.Reader{strings.NewReader(tt.in), iotest.OneByteReader(strings.NewReader(tt.in))} {
+			s := bufio.NewScanner(r)
+			s.Split(newlineSplitter())
+			var got []string
+			for s.Scan() {
+				got = append(got, s.Text())
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("newlineSplitter split %q into %q; want %q", tt.in, got, tt.want)
+			}
+		}
+	}
+}
+
+func TestSplitLines(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		want []string
+	}{
+		{"a", []string{"a"}},
+		{"a\r\nb\nc\rd", []string{"a", "b", "c", "d"}},
+		{"a\r\r\nb", []string{"a", "", "b"}},
+		{"a\n", []string{"a", ""}},
+		{"", []string{""}},
+	} {
+		if got := splitLines(tt.in); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("splitLines(%q) = %q; want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// BenchmarkScanLatency times from writing a line to one end of a loopback
+// TCP connection to the scanner at the other end returning it, reading as
+// the collector does and a byte at a time.
+func BenchmarkScanLatency(b *testing.B) {
+	for _, bm := range []struct {
+		name string
+		wrap func(io.Reader) io.Reader
+	}{
+		{"scanner", func(r io.Reader) io.Reader { return r }},
+		{"byte at a time", iotest.OneByteReader},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			l, err := net.Listen("tcp", "127.0.0.1:0")
+			if err != nil {
+				b.Skip(err)
+			}
+			defer l.Close()
+			w, err := net.Dial("tcp", l.Addr().String())
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer w.Close()
+			r, err := l.Accept()
+			if err != nil {
+				b.Fatal(err)
+			}
+			defer r.Close()
+			s := newLineScanner(bm.wrap(r))
+			line := []byte("1700000000 temp 28ff0a1b2c3d DS18B20 21.5 C\n")
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if _, err := w.Write(line); err != nil {
+					b.Fatal(err)
+				}
+				if !s.Scan() {
+					b.Fatal(s.Err())
+				}
+			}
+		})
+	}
+}
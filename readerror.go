@@ -0,0 +1,47 @@
+package main
+
+import (
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// defaultReadErrorValues are the values models report in place of a
+// reading when something went wrong, in celsius: the DS18x20s read 85°
+// (their power-on value) after a power glitch, and the OneWire library
+// returns -127° when it can't read one at all.
+var defaultReadErrorValues = map[string][]float64{
+	"ds18b20": {85, -127},
+	"ds18s20": {85, -127},
+	"ds1822":  {85, -127},
+}
+
+var readErrorGauges = newSensorGaugeVec(prometheus.GaugeOpts{
+	Namespace: "sensors",
+	Name:      "read_error",
+	Help:      "1 if a sensor's latest sample was one of its model's error values, else 0",
+}, sensorLabels)
+
+// readError checks a sample against its model's error values, from
+// read_error_values in -config or defaultReadErrorValues, reporting
+// whether it is one and so should not be recorded.  sensors_read_error is
+// only exported for models that have error values.
+func readError(labels prometheus.Labels, v float64) bool {
+	model := strings.ToLower(labels["model"])
+	values, ok := cfg.ReadErrorValues[model]
+	if !ok {
+		values, ok = defaultReadErrorValues[model]
+	}
+	if !ok {
+		return false
+	}
+	for _, e := range values {
+		if v == e {
+			readErrorGauges.With(labels).Set(1)
+			skipSample("read_error", labels["device"])
+			return true
+		}
+	}
+	readErrorGauges.With(labels).Set(0)
+	return false
+}
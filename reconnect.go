@@ -0,0 +1,92 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"time"
+)
+
+var reconnectToken = flag.String("reconnect-token", "", "If set, serve POST /reconnect, authenticated by this bearer token, to drop and redial sources straight away")
+
+// reconnectWait is how long /reconnect waits for sources to reconnect
+// before answering.
+const reconnectWait = 5 * time.Second
+
+// reconnect closes s's connection, if it has one, and cuts short any
+// backoff, so it's redialled straight away.  It returns the number of the
+// connection it ended, or false if s can't be reconnected.
+func (s *source) reconnect() (int, bool) {
+	s.mu.Lock()
+	conn, connected, num := s.conn, s.connected, s.num
+	s.mu.Unlock()
+	if connected && conn == nil {
+		return 0, false
+	}
+	if conn != nil {
+		conn.Close()
+	}
+	select {
+	case s.kick <- struct{}{}:
+	default:
+	}
+	return num, true
+}
+
+// reconnected reports whether s has connected since connection num.
+func (s *source) reconnected(num int) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.connected && s.num > num
+}
+
+// serveReconnect handles POST /reconnect[?endpoint=...], reconnecting the
+// given source or all of them, then answering with their state, as in
+// /healthz, once they're connected again or reconnectWait has passed.
+func serveReconnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	if !hasBearerToken(r, *reconnectToken) {
+		http.Error(w, "unauthorized", http.StatusUnauthorized)
+		return
+	}
+	endpoint := r.URL.Query().Get("endpoint")
+	var targets []*source
+	for _, s := range sources {
+		if endpoint == "" || s.endpoint == endpoint {
+			targets = append(targets, s)
+		}
+	}
+	if len(targets) == 0 {
+		http.Error(w, "no such endpoint", http.StatusNotFound)
+		return
+	}
+	ended := make([]int, len(targets))
+	for i, s := range targets {
+		log.Printf("Reconnecting to %s on request", s.endpoint)
+		num, ok := s.reconnect()
+		if !ok {
+			http.Error(w, s.endpoint+" can't be reconnected", http.StatusConflict)
+			return
+		}
+		ended[i] = num
+	}
+	for deadline := clk.Now().Add(reconnectWait); clk.Now().Before(deadline); clk.Sleep(100 * time.Millisecond) {
+		done := true
+		for i, s := range targets {
+			done = done && s.reconnected(ended[i])
+		}
+		if done {
+			break
+		}
+	}
+	resp := map[string]sourceHealth{}
+	for _, s := range targets {
+		resp[s.endpoint] = s.health()
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
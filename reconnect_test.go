@@ -0,0 +1,247 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"net"
+	"reflect"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// fakeConn is a net.Conn that reads what it was given, then fails with err,
+// or ends if that's nil.  Writes are discarded.
+type fakeConn struct {
+	r   io.Reader
+	err error
+}
+
+func newFakeConn(in string, err error) *fakeConn {
+	return &fakeConn{r: strings.NewReader(in), err: err}
+}
+
+func (c *fakeConn) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	if err == io.EOF && c.err != nil {
+		err = c.err
+	}
+	return n, err
+}
+
+func (c *fakeConn) Write(p []byte) (int, error)        { return len(p), nil }
+func (c *fakeConn) Close() error                       { return nil }
+func (c *fakeConn) LocalAddr() net.Addr                { return &net.TCPAddr{IP: net.IPv4(192, 0, 2, 2), Port: 40000} }
+func (c *fakeConn) RemoteAddr() net.Addr               { return &net.TCPAddr{IP: net.IPv4(192, 0, 2, 1), Port: 9456} }
+func (c *fakeConn) SetDeadline(t time.Time) error      { return nil }
+func (c *fakeConn) SetReadDeadline(t time.Time) error  { return nil }
+func (c *fakeConn) SetWriteDeadline(t time.Time) error { return nil }
+
+// scriptedDialer returns a dialFunc that returns each of conns in turn,
+// dialling failing with the error instead wherever conns holds one.  Once
+// they're used up it signals done and blocks, leaving redial stuck.
+func scriptedDialer(done chan<- struct{}, conns ...interface{}) dialFunc {
+	i := 0
+	return func(endpoint string) (net.Conn, error) {
+		if i == len(conns) {
+			close(done)
+			select {}
+		}
+		i++
+		if err, ok := conns[i-1].(error); ok {
+			return nil, err
+		}
+		return conns[i-1].(net.Conn), nil
+	}
+}
+
+func TestRedialDelays(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	unknown := &net.OpError{Op: "dial", Net: "tcp", Err: &net.DNSError{Err: "no such host", Name: "gateway", IsNotFound: true}}
+	const line = "100 temp 28ff0a1b2c30 DS18B20 70.5\n"
+	for _, tt := range []struct {
+		name   string
+		flags  map[string]string
+		conns  []interface{}
+		afters []time.Duration // backoffs
+		sleeps []time.Duration // paced by -min-connect-interval
+	}{
+		{
+			name:   "refused",
+			conns:  []interface{}{refused, refused, refused},
+			afters: []time.Duration{reconnectDelay, reconnectDelay, reconnectDelay},
+		},
+		{
+			name:   "refused then ended",
+			conns:  []interface{}{refused, refused, newFakeConn(line, nil)},
+			afters: []time.Duration{reconnectDelay, reconnectDelay, 0},
+			sleeps: []time.Duration{time.Second},
+		},
+		{
+			name:   "read failed",
+			conns:  []interface{}{newFakeConn(line, errors.New("reset")), newFakeConn(line, nil)},
+			afters: []time.Duration{reconnectDelay, 0},
+			sleeps: []time.Duration{time.Second},
+		},
+		{
+			name:   "unknown host",
+			conns:  []interface{}{unknown, refused},
+			afters: []time.Duration{unknownHostDelay, reconnectDelay},
+		},
+		{
+			name:   "hung up straight away",
+			flags:  map[string]string{"min-connect-interval": "3s"},
+			conns:  []interface{}{newFakeConn("", nil), newFakeConn("", nil)},
+			afters: []time.Duration{0, 0},
+			sleeps: []time.Duration{3 * time.Second, 3 * time.Second},
+		},
+		{
+			name:   "startup grace",
+			flags:  map[string]string{"startup-grace": "1h"},
+			conns:  []interface{}{refused, unknown},
+			afters: []time.Duration{reconnectDelay, reconnectDelay},
+		},
+		{
+			name:   "startup delay",
+			flags:  map[string]string{"startup-delay": "10s"},
+			conns:  []interface{}{refused},
+			afters: []time.Duration{reconnectDelay},
+			sleeps: []time.Duration{10 * time.Second},
+		},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.flags {
+				setFlag(t, name, value)
+			}
+			c := newFakeClock()
+			setClock(t, c)
+			oldStart := startTime
+			startTime = c.Now()
+			t.Cleanup(func() { startTime = oldStart })
+			done := make(chan struct{})
+			go redial(configuredSource("test:"+t.Name()), scriptedDialer(done, tt.conns...))
+			select {
+			case <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatal("redial didn't use up its dials")
+			}
+			sleeps, afters := c.waits()
+			if !reflect.DeepEqual(afters, tt.afters) {
+				t.Errorf("backed off for %v; want %v", afters, tt.afters)
+			}
+			if !reflect.DeepEqual(sleeps, tt.sleeps) {
+				t.Errorf("slept for %v; want %v", sleeps, tt.sleeps)
+			}
+		})
+	}
+}
+
+func TestSourceConnectionCounters(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	const line = "100 temp 28ff0a1b2c31 DS18B20 70.5\n"
+	for _, tt := range []struct {
+		name             string
+		flags            map[string]string
+		conns            []interface{}
+		attempts, errors float64
+	}{
+		// The dial left blocking is attempted too.
+		{"refused", nil, []interface{}{refused, refused}, 3, 2},
+		{"connected", nil, []interface{}{newFakeConn(line, nil), refused}, 3, 1},
+		{"startup grace", map[string]string{"startup-grace": "1h"}, []interface{}{refused, refused}, 3, 0},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			for name, value := range tt.flags {
+				setFlag(t, name, value)
+			}
+			c := newFakeClock()
+			setClock(t, c)
+			oldStart := startTime
+			startTime = c.Now()
+			t.Cleanup(func() { startTime = oldStart })
+			endpoint := "test:" + t.Name()
+			counts := []struct {
+				name          string
+				total, source prometheus.Collector
+				want          float64
+				was, wasTotal float64
+			}{
+				{name: "attempts", total: connectionAttempts, source: sourceConnectionAttempts.WithLabelValues(endpoint), want: tt.attempts},
+				{name: "errors", total: connectionErrors, source: sourceConnectionErrors.WithLabelValues(endpoint), want: tt.errors},
+			}
+			for i := range counts {
+				counts[i].was, counts[i].wasTotal = counterValue(counts[i].source), counterValue(counts[i].total)
+			}
+			done := make(chan struct{})
+			go redial(configuredSource(endpoint), scriptedDialer(done, tt.conns...))
+			select {
+			case <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatal("redial didn't use up its dials")
+			}
+			for _, ct := range counts {
+				if got := counterValue(ct.source) - ct.was; got != ct.want {
+					t.Errorf("counted %v %s for the endpoint; want %v", got, ct.name, ct.want)
+				}
+				if got := counterValue(ct.total) - ct.wasTotal; got != ct.want {
+					t.Errorf("counted %v %s in all; want %v", got, ct.name, ct.want)
+				}
+			}
+		})
+	}
+}
+
+func TestSourceConnectionCountersStartAtZero(t *testing.T) {
+	old := sources
+	t.Cleanup(func() { sources = old })
+	const endpoint = "test:zero"
+	newSource(endpoint)
+	for name, c := range map[string]*prometheus.CounterVec{"attempts": sourceConnectionAttempts, "errors": sourceConnectionErrors} {
+		found := false
+		for _, m := range collect(c) {
+			if labelValue(m, "endpoint") == endpoint {
+				found = m.GetCounter().GetValue() == 0
+			}
+		}
+		if !found {
+			t.Errorf("a new source has no zero count of %s", name)
+		}
+	}
+}
+
+func TestConsecutiveFailures(t *testing.T) {
+	refused := &net.OpError{Op: "dial", Net: "tcp", Err: syscall.ECONNREFUSED}
+	reset := &net.OpError{Op: "read", Net: "tcp", Err: syscall.ECONNRESET}
+	const line = "100 temp 28ff0a1b2c32 DS18B20 70.5\n"
+	for _, tt := range []struct {
+		name  string
+		conns []interface{}
+		want  int
+	}{
+		{"ended", []interface{}{newFakeConn(line, nil)}, 0},
+		{"ended twice", []interface{}{newFakeConn(line, nil), newFakeConn(line, nil)}, 0},
+		{"read error", []interface{}{newFakeConn(line, reset)}, 1},
+		{"refused", []interface{}{refused, refused}, 2},
+		{"refused, then ended", []interface{}{refused, refused, newFakeConn(line, nil)}, 0},
+		{"ended, then refused", []interface{}{newFakeConn(line, nil), refused, refused}, 2},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			setClock(t, newFakeClock())
+			t.Cleanup(func() { forgetDevice(formatDevice("28ff0a1b2c32", "DS18B20")) })
+			src := configuredSource("test:" + t.Name())
+			done := make(chan struct{})
+			go redial(src, scriptedDialer(done, tt.conns...))
+			select {
+			case <-done:
+			case <-time.After(10 * time.Second):
+				t.Fatal("redial didn't use up its dials")
+			}
+			if got := src.health().ConsecutiveFailures; got != tt.want {
+				t.Errorf("consecutive failures = %d; want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// registry holds every metric the collector exports.  It stands in for
+// prometheus.DefaultRegisterer so that views of it can be served on other
+// paths.
+var registry = prometheus.NewRegistry()
+
+func init() {
+	// What the default registry would have had.
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+}
+
+var registrationErrors = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "registration_errors_total",
+	Help:      "Metrics created at runtime that couldn't be registered, and so aren't exported as intended",
+})
+
+// registerLazily registers a collector created after startup.  Where
+// startup registration panics on any conflict, a runtime conflict (say, a
+// per-model metric whose name collides with an existing one) should only
+// cost that metric, so it is logged and counted instead.
+func registerLazily(c prometheus.Collector, name string) error {
+	err := registry.Register(c)
+	if err != nil {
+		log.Printf("Can't register %s: %v", name, err)
+		registrationErrors.Inc()
+	}
+	return err
+}
+
+// enabledMetrics returns the collectors to export with the current flags,
+// including extra ones such as the route gauges.
+func enabledMetrics(extra []prometheus.Collector) []prometheus.Collector {
+	cs := append([]prometheus.Collector{
+		counterAliases{}, bytesDropped, samplesSkipped,
+		decodeErrors, panicsRecovered, deviceSamples, unknownKindSamples,
+		temperatureGauges, humidityGauges, illuminanceGauges, co2Gauges,
+		batteryGauges, batteryLowGauges, invalidTimestamps, implausibleTimestamps,
+		buildInfo, startTimestamp, activeSeriesCollector{}, backoffSeconds, unmatchedLines,
+		formatDriftReconnects, seriesExpired, registrationErrors,
+		peerConnections, remotePeers, snapshotWriteErrors,
+		reconnectsCollector{}, checksumErrors, sequenceGaps,
+		suppressedLines, headerLines, decimatedSamples, readErrorGauges,
+		pushErrors, interSampleSeconds, contendedWrites,
+		scanGoroutines, dialErrors, configuredEndpoint,
+		sourceUpCollector{}, listenFailures, filteredLines,
+		duplicateLines, acceptedSamples, rejectedSamples,
+		activeEndpoint, eventsDropped, eventErrors, alertGauge,
+		groupSpreadCollector{}, inventoryCollector{}, scrapesLimited, counterMeterResets,
+		startupDialErrors, samplesPerConnection, maintenanceGauge,
+		comboFieldErrors, syslogInvalid, syslogHosts,
+		duplicateIDCount, scrapeReconnects, sourceConnectionAttempts,
+		sourceConnectionErrors, busMembershipChanges, auditErrors,
+		thresholdCrossed, thresholdInfo, dialDuration, clockJumps, lastHeartbeat,
+		frameResyncBytes,
+	}, extra...)
+	cs = append(cs, legacyCounterMetrics()...)
+	if *debugMetrics {
+		cs = append(cs, roundingResidual, rawTemperatureGauges)
+	}
+	if *exportKelvin {
+		cs = append(cs, kelvinGauges)
+	}
+	if *captureUnknown {
+		cs = append(cs, rawValueGauges, rawValueSeries)
+	}
+	if *averageWindow > 0 && *averageWindowStats {
+		cs = append(cs, windowMinGauges, windowMaxGauges, windowSampleGauges)
+	}
+	if *exportExtremes {
+		cs = append(cs, extremeMinGauges, extremeMaxGauges)
+	}
+	if smoothingConfigured() {
+		cs = append(cs, unsmoothedGauges)
+	}
+	if *graphiteAddr != "" || *influxURL != "" {
+		cs = append(cs, exportErrors, exportedPoints)
+	}
+	if *firmwareRegexp != "" {
+		cs = append(cs, firmwareInfo, bannerParseFailures)
+	}
+	return cs
+}
+
+// registerMetrics registers cs with r all at once at startup, returning
+// the first conflict rather than panicking, so that a clash between
+// features shows up as a log message naming the metric.
+func registerMetrics(r prometheus.Registerer, cs []prometheus.Collector) error {
+	for _, c := range cs {
+		if err := r.Register(c); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// filteredGatherer gathers only the metric families of g whose names match
+// one of a set of regexps.
+type filteredGatherer struct {
+	g     prometheus.Gatherer
+	names []*regexp.Regexp
+}
+
+func (f filteredGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := f.g.Gather()
+	var kept []*dto.MetricFamily
+	for _, mf := range mfs {
+		for _, re := range f.names {
+			if re.MatchString(mf.GetName()) {
+				kept = append(kept, mf)
+				break
+			}
+		}
+	}
+	return kept, err
+}
+
+// handleMetricsPaths serves the full registry on /metrics, and filtered
+// views of it on any paths configured in metrics_paths.  All of them take
+// ?units=.
+func handleMetricsPaths(mux *http.ServeMux, paths map[string][]string) error {
+	if _, ok := paths["/metrics"]; !ok {
+		mux.Handle("/metrics", noteScrapes(limitScrapes(promhttp.InstrumentMetricHandler(
+			registry, unitsHandler(registry)))))
+	}
+	if _, ok := paths["/metrics/delta"]; !ok {
+		mux.Handle("/metrics/delta", limitScrapes(deltaHandler(registry)))
+	}
+	for path, exprs := range paths {
+		f := filteredGatherer{g: registry}
+		for _, e := range exprs {
+			re, err := regexp.Compile(`^(?:` + e + `)$`)
+			if err != nil {
+				return fmt.Errorf("metrics_paths[%q]: %v", path, err)
+			}
+			f.names = append(f.names, re)
+		}
+		mux.Handle(path, noteScrapes(limitScrapes(unitsHandler(f))))
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestRegisterLazily(t *testing.T) {
+	first := prometheus.NewGauge(prometheus.GaugeOpts{Name: "sensors_test_lazy", Help: "A test gauge"})
+	for _, tt := range []struct {
+		name string
+		c    prometheus.Collector
+		ok   bool
+	}{
+		{"new", first, true},
+		{"again", first, false},
+		{"clashing help", prometheus.NewGauge(prometheus.GaugeOpts{Name: "sensors_test_lazy", Help: "Another test gauge"}), false},
+		{"clashing labels", prometheus.NewGaugeVec(prometheus.GaugeOpts{Name: "sensors_test_lazy", Help: "A test gauge"}, []string{"device"}), false},
+	} {
+		before := counterValue(registrationErrors)
+		err := registerLazily(tt.c, "sensors_test_lazy")
+		if (err == nil) != tt.ok {
+			t.Errorf("%s: registerLazily = %v; want ok %v", tt.name, err, tt.ok)
+		}
+		want := 1.
+		if tt.ok {
+			want = 0
+		}
+		if got := counterValue(registrationErrors) - before; got != want {
+			t.Errorf("%s: counted %v registration errors; want %v", tt.name, got, want)
+		}
+	}
+	registry.Unregister(first)
+	if err := registerLazily(first, "sensors_test_lazy"); err != nil {
+		t.Errorf("registerLazily after unregistering = %v", err)
+	}
+	registry.Unregister(first)
+}
+
+func TestEnabledMetricsRegister(t *testing.T) {
+	for _, flags := range []map[string]string{
+		{},
+		{"debug-metrics": "true"},
+		{"export-kelvin": "true"},
+		{"capture-unknown": "true"},
+		{"average-window": "1m", "average-window-stats": "true"},
+		{"extremes": "true"},
+		{"smoothing-method": "ewma"},
+		{"graphite-addr": "localhost:2003"},
+		{"firmware-regexp": "v(\\S+)"},
+		{"legacy-counter-names": "false"},
+		{
+			"debug-metrics": "true", "export-kelvin": "true", "capture-unknown": "true",
+			"average-window": "1m", "average-window-stats": "true", "extremes": "true",
+			"smoothing-method": "median", "graphite-addr": "localhost:2003", "firmware-regexp": "v(\\S+)",
+		},
+	} {
+		t.Run("", func(t *testing.T) {
+			for name, value := range flags {
+				setFlag(t, name, value)
+			}
+			routeGauges, err := buildRoutes(nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if err := registerMetrics(prometheus.NewRegistry(), enabledMetrics(routeGauges)); err != nil {
+				t.Errorf("with %v, registerMetrics = %v", flags, err)
+			}
+		})
+	}
+}
+
+func TestRegisterMetricsConflict(t *testing.T) {
+	setFlag(t, "export-kelvin", "true")
+	clash := prometheus.NewGauge(prometheus.GaugeOpts{Name: "sensors_temperature_kelvin", Help: "A clash"})
+	if err := registerMetrics(prometheus.NewRegistry(), enabledMetrics([]prometheus.Collector{clash})); err == nil {
+		t.Error("registerMetrics didn't report a clash with sensors_temperature_kelvin")
+	}
+}
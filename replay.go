@@ -0,0 +1,73 @@
+package main
+
+import (
+	"compress/gzip"
+	"flag"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+var replay = flag.String("replay", "", "Read samples from capture files instead of -connect: a file, a glob, or a directory, read in filename order; .gz files are decompressed")
+
+// replayFiles feeds each capture file matched by pattern through the
+// parsers, once, in filename order.  A corrupt or unreadable file is logged
+// and skipped, so a truncated trailing capture doesn't lose the rest.
+func replayFiles(src *source, pattern string) {
+	files, err := replayFileList(pattern)
+	if err != nil {
+		log.Printf("Can't list replay files %q: %v", pattern, err)
+		return
+	}
+	if len(files) == 0 {
+		log.Printf("No replay files match %q", pattern)
+		return
+	}
+	src.setConnected(1, nil)
+	for i, name := range files {
+		if err := replayFile(name, newConnection(src, i+1)); err != nil {
+			log.Printf("Error replaying %s, skipping the rest of it: %v", name, err)
+		}
+	}
+	log.Printf("Finished replaying %d files from %q", len(files), pattern)
+}
+
+func replayFileList(pattern string) ([]string, error) {
+	if fi, err := os.Stat(pattern); err == nil && fi.IsDir() {
+		entries, err := os.ReadDir(pattern)
+		if err != nil {
+			return nil, err
+		}
+		var files []string
+		for _, e := range entries {
+			if !e.IsDir() {
+				files = append(files, filepath.Join(pattern, e.Name()))
+			}
+		}
+		return files, nil // already sorted
+	}
+	files, err := filepath.Glob(pattern)
+	sort.Strings(files)
+	return files, err
+}
+
+func replayFile(name string, c *connection) error {
+	f, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var r io.Reader = f
+	if strings.HasSuffix(name, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		r = gz
+	}
+	return scan(r, c)
+}
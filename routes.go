@@ -0,0 +1,195 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"math"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// route describes how samples of one kind are exported.
+type route struct {
+	Kind string `json:"kind"`
+	// Metric is the metric name, within the sensors namespace.
+	Metric string `json:"metric"`
+	Help   string `json:"help"`
+	// Unit is the unit the sensor reports in.  "fahrenheit" and "kelvin"
+	// are converted to celsius; anything else is exported as received.  If unset,
+	// _celsius metrics go by the model's unit (see temperatureUnit).
+	Unit string `json:"unit"`
+	// Min and Max, if set, bound plausible values; samples outside them
+	// are dropped and counted.
+	Min *float64 `json:"min"`
+	Max *float64 `json:"max"`
+	// Type is "gauge", the default, for readings, or "counter" for
+	// sensors reporting a running total, such as energy meters; see
+	// sensorCounterVec.  Counter metrics must end in _total.
+	Type string `json:"type"`
+
+	gauges   *sensorGaugeVec
+	counters *sensorCounterVec
+}
+
+var defaultRoutes = []route{
+	{Kind: "temp", Metric: "temperature_degrees_celsius"},
+	{Kind: "humidity", Metric: "relative_humidity_percent"},
+	// BH1750 light sensors
+	{Kind: "lux", Metric: "illuminance_lux"},
+	// MH-Z19 CO2 sensors report 0 while warming up, and nothing indoors
+	// should read below outdoor air.
+	{Kind: "co2", Metric: "co2_ppm", Min: floatPtr(400), Max: floatPtr(5000)},
+	{Kind: "vbat", Metric: "battery_volts"},
+	{Kind: "kwh", Metric: "energy_kwh_total", Type: "counter", Help: "Energy counted by a single meter, in kilowatt-hours"},
+}
+
+func floatPtr(f float64) *float64 { return &f }
+
+// routes is keyed by lower-cased kind.
+var routes = map[string]*route{}
+
+var unknownKindSamples = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "unknown_kind_samples_total",
+	Help:      "Samples dropped because no route exists for their kind",
+}, []string{"kind"})
+
+var maxUnknownKinds = flag.Int("max-unknown-kinds", 32, "Maximum number of distinct kinds to label sensors_unknown_kind_samples_total with; the rest are counted as \"other\"")
+
+var (
+	unknownKindsMu sync.Mutex
+	unknownKinds   = map[string]bool{} // those with their own label
+)
+
+// countUnknownKind counts a sample of a kind with no route.  Kinds come
+// from the wire, garbled ones included, so only the first
+// -max-unknown-kinds seen get their own label.
+func countUnknownKind(kind string) {
+	unknownKindsMu.Lock()
+	if !unknownKinds[kind] {
+		if len(unknownKinds) < *maxUnknownKinds {
+			unknownKinds[kind] = true
+		} else {
+			kind = "other"
+		}
+	}
+	unknownKindsMu.Unlock()
+	unknownKindSamples.WithLabelValues(kind).Inc()
+}
+
+// buildRoutes sets up the routing table from the built-in and configured
+// routes, returning any gauges that need registering.
+func buildRoutes(configured []route) ([]prometheus.Collector, error) {
+	vecs := map[string]*sensorGaugeVec{
+		"temperature_degrees_celsius": temperatureGauges,
+		"relative_humidity_percent":   humidityGauges,
+		"illuminance_lux":             illuminanceGauges,
+		"co2_ppm":                     co2Gauges,
+		"battery_volts":               batteryGauges,
+	}
+	counters := map[string]*sensorCounterVec{}
+	var created []prometheus.Collector
+	for _, r := range append(append([]route{}, defaultRoutes...), configured...) {
+		r := r
+		if r.Kind == "" || r.Metric == "" {
+			return nil, fmt.Errorf("route %+v needs both a kind and a metric", r)
+		}
+		help := r.Help
+		if help == "" {
+			help = fmt.Sprintf("%s sampled from a single sensor", r.Kind)
+		}
+		switch r.Type {
+		case "", "gauge":
+		case "counter":
+			if !strings.HasSuffix(r.Metric, "_total") {
+				return nil, fmt.Errorf("route for %s: counter metric %s must end in _total", r.Kind, r.Metric)
+			}
+			if vecs[r.Metric] != nil {
+				return nil, fmt.Errorf("route for %s: %s is a gauge", r.Kind, r.Metric)
+			}
+			if counters[r.Metric] == nil {
+				counters[r.Metric] = newSensorCounterVec(r.Metric, help)
+				created = append(created, counters[r.Metric])
+			}
+			r.counters = counters[r.Metric]
+			routes[strings.ToLower(r.Kind)] = &r
+			continue
+		default:
+			return nil, fmt.Errorf("route for %s: type must be gauge or counter, not %q", r.Kind, r.Type)
+		}
+		if counters[r.Metric] != nil {
+			return nil, fmt.Errorf("route for %s: %s is a counter", r.Kind, r.Metric)
+		}
+		if vecs[r.Metric] == nil {
+			vecs[r.Metric] = newSensorGaugeVec(prometheus.GaugeOpts{
+				Namespace: "sensors",
+				Name:      r.Metric,
+				Help:      help,
+			}, sensorLabels)
+			created = append(created, vecs[r.Metric])
+		}
+		r.gauges = vecs[r.Metric]
+		routes[strings.ToLower(r.Kind)] = &r
+	}
+	return created, nil
+}
+
+func recordGeneric(kind, model, ID, value string, o origin) {
+	r := routes[strings.ToLower(kind)]
+	if r == nil {
+		countUnknownKind(strings.ToLower(kind))
+		return
+	}
+	device := o.device(ID, model)
+	if !deviceAllowed(ID, device) {
+		return
+	}
+	fv, embedded, err := parseValue(value)
+	if err != nil {
+		throttledLogf("parse error", "Error parsing sample value %q from device %q: %v", value, ID, err)
+		badValue(device, value, err)
+		return
+	}
+	unit := strings.ToLower(r.Unit)
+	if unit == "" && strings.HasSuffix(r.Metric, "_celsius") {
+		unit = temperatureUnit(model, nil)
+	}
+	if !checkEmbeddedUnit(device, unit, embedded) {
+		if !isTemperatureUnit(unit) || !isTemperatureUnit(embedded) {
+			skipSample("unit_mismatch", device)
+			return
+		}
+		unit = embedded
+	}
+	labels := prometheus.Labels{
+		"id":     ID,
+		"device": device,
+		"model":  strings.ToLower(model),
+	}
+	if r.Metric == "temperature_degrees_celsius" {
+		recordRawTemperature(labels, fv, unit)
+	}
+	fv = toCelsius(fv, unit, labels["model"])
+	if readError(labels, fv) {
+		deviceSamples.WithLabelValues(device, strings.ToLower(model)).Inc()
+		return
+	}
+	fv = transformValue(model, kind, fv)
+	if math.IsNaN(fv) || math.IsInf(fv, 0) || (r.Min != nil && fv < *r.Min) || (r.Max != nil && fv > *r.Max) {
+		skipSample("out_of_range", device)
+		return
+	}
+	deviceSamples.WithLabelValues(device, strings.ToLower(model)).Inc()
+	if r.counters != nil {
+		r.counters.add(r.Metric, labels, fv)
+		acceptedSamples.WithLabelValues(device).Inc()
+		auditSample(r.Metric, labels, fv, o.at)
+		return
+	}
+	setGauge(r.Metric, r.gauges, labels, fv, o)
+	if r.gauges == batteryGauges {
+		recordBatteryLow(labels, model, fv)
+	}
+}
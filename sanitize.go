@@ -0,0 +1,97 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// labelSanitization rewrites the id, device and model label values of
+// sensor series as they're exported, to keep inconsistent firmware from
+// making surprise series.  Steps apply in the order of the fields.  With
+// none configured, values are exported as they are (models having been
+// lower-cased when parsed).
+type labelSanitization struct {
+	// Labels lists the labels to sanitize, by default id, device and
+	// model.
+	Labels    []string `json:"labels"`
+	Lowercase bool     `json:"lowercase"`
+	// Trim is a set of characters to strip from both ends.
+	Trim    string         `json:"trim"`
+	Replace []labelReplace `json:"replace"`
+	// MaxLength, if set, truncates values to that many bytes.
+	MaxLength int `json:"max_length"`
+}
+
+// labelReplace replaces each match of Pattern with With, which can refer
+// to submatches as regexp.Expand does.
+type labelReplace struct {
+	Pattern string `json:"pattern"`
+	With    string `json:"with"`
+
+	re *regexp.Regexp
+}
+
+func (s *labelSanitization) check() error {
+	for _, l := range s.Labels {
+		if l != "id" && l != "device" && l != "model" {
+			return fmt.Errorf("labels: can only sanitize id, device and model, not %q", l)
+		}
+	}
+	for i := range s.Replace {
+		re, err := regexp.Compile(s.Replace[i].Pattern)
+		if err != nil {
+			return fmt.Errorf("replace: %v", err)
+		}
+		s.Replace[i].re = re
+	}
+	if s.MaxLength < 0 {
+		return fmt.Errorf("max_length: negative")
+	}
+	return nil
+}
+
+func (s *labelSanitization) configured() bool {
+	return s.Lowercase || s.Trim != "" || len(s.Replace) > 0 || s.MaxLength > 0
+}
+
+func (s *labelSanitization) sanitize(v string) string {
+	if s.Lowercase {
+		v = strings.ToLower(v)
+	}
+	if s.Trim != "" {
+		v = strings.Trim(v, s.Trim)
+	}
+	for _, r := range s.Replace {
+		v = r.re.ReplaceAllString(v, r.With)
+	}
+	if s.MaxLength > 0 && len(v) > s.MaxLength {
+		v = strings.ToValidUTF8(v[:s.MaxLength], "")
+	}
+	return v
+}
+
+// sanitizeLabels returns labels with the label_sanitization config
+// applied, or labels itself if there's none to apply.
+func sanitizeLabels(labels prometheus.Labels) prometheus.Labels {
+	s := &cfg.LabelSanitization
+	if !s.configured() {
+		return labels
+	}
+	names := s.Labels
+	if len(names) == 0 {
+		names = sensorLabels
+	}
+	l := prometheus.Labels{}
+	for k, v := range labels {
+		l[k] = v
+	}
+	for _, name := range names {
+		if v, ok := l[name]; ok {
+			l[name] = s.sanitize(v)
+		}
+	}
+	return l
+}
@@ -0,0 +1,63 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var scrapeReconnect = flag.Int("scrape-reconnect", 0, "If set, reconnect a connected source once this many consecutive scrapes have found no sample from it since the scrape before")
+
+var scrapeReconnects = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "scrape_reconnects_total",
+	Help:      "Reconnects forced because consecutive scrapes found no fresh samples from a source (-scrape-reconnect)",
+}, []string{"endpoint"})
+
+// noteScrapes wraps a metrics handler to check, per -scrape-reconnect,
+// each source for fresh samples as it's scraped.
+func noteScrapes(h http.Handler) http.Handler {
+	if *scrapeReconnect == 0 {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		now := clk.Now()
+		for _, s := range sources {
+			if s.idleScrape(now) {
+				log.Printf("No samples from %s in %d scrapes; reconnecting", s.endpoint, *scrapeReconnect)
+				scrapeReconnects.WithLabelValues(s.endpoint).Inc()
+				s.reconnect()
+			}
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+// noteSampleTime records that s has just sent a sample.
+func (s *source) noteSampleTime(now time.Time) {
+	s.mu.Lock()
+	s.lastSample = now
+	s.mu.Unlock()
+}
+
+// idleScrape notes a scrape at now, and reports whether s is connected
+// but has now gone -scrape-reconnect scrapes without a sample since the
+// one before.  A source that's not connected is already reconnecting.
+func (s *source) idleScrape(now time.Time) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	prev := s.lastScrape
+	s.lastScrape = now
+	if !s.connected || s.conn == nil || s.lastSample.After(prev) || prev.IsZero() {
+		s.idleScrapes = 0
+		return false
+	}
+	if s.idleScrapes++; s.idleScrapes < *scrapeReconnect {
+		return false
+	}
+	s.idleScrapes = 0
+	return true
+}
@@ -0,0 +1,61 @@
+package sensor
+
+import (
+	"bufio"
+	"io"
+	"strings"
+)
+
+// Collector reads sample lines and sends the samples in them to its
+// Samples channel.
+type Collector struct {
+	parsers []Parser
+	samples chan Sample
+}
+
+// NewCollector returns a Collector that tries parsers on each line, in
+// order, or DefaultParsers if there are none.
+func NewCollector(parsers ...Parser) *Collector {
+	if len(parsers) == 0 {
+		parsers = DefaultParsers
+	}
+	return &Collector{parsers: parsers, samples: make(chan Sample)}
+}
+
+// Samples returns the channel Run sends samples to.  It's closed once Run
+// returns.
+func (c *Collector) Samples() <-chan Sample {
+	return c.samples
+}
+
+// Parse returns the samples in a line, split into fields on whitespace,
+// per the first of c's parsers to recognize it, or false if none does.
+// Blank lines hold no samples.
+func (c *Collector) Parse(line string) ([]Sample, bool) {
+	f := strings.Fields(line)
+	if len(f) == 0 {
+		return nil, true
+	}
+	for _, p := range c.parsers {
+		if samples, ok := p.Parse(f); ok {
+			return samples, true
+		}
+	}
+	return nil, false
+}
+
+// Run reads lines from r, LF or CRLF terminated, until it ends or fails,
+// sending the samples in them to Samples and then closing it.  Lines no
+// parser recognizes are skipped.  It returns r's error, or nil if r just
+// ended.
+func (c *Collector) Run(r io.Reader) error {
+	defer close(c.samples)
+	sc := bufio.NewScanner(r)
+	for sc.Scan() {
+		samples, _ := c.Parse(sc.Text())
+		for _, s := range samples {
+			c.samples <- s
+		}
+	}
+	return sc.Err()
+}
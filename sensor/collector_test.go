@@ -0,0 +1,52 @@
+package sensor
+
+import (
+	"errors"
+	"io"
+	"reflect"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+func TestCollectorRun(t *testing.T) {
+	failed := errors.New("reset")
+	for _, tt := range []struct {
+		name string
+		r    io.Reader
+		want []string // kind and value of each sample
+		err  error
+	}{
+		{"lines", strings.NewReader("100 temp 28ff0a1b2c3d DS18B20 70.5\n100 lux bh1750 23 1234\n"), []string{"temp 70.5", "lux 1234"}, nil},
+		{"crlf", strings.NewReader("100 humidity DHT22 45.2 70.5\r\n"), []string{"humidity 45.2", "temp 70.5"}, nil},
+		{"unterminated", strings.NewReader("id=n1 temp=21.5"), []string{"temp 21.5"}, nil},
+		{"skipped", strings.NewReader("hello\n\n100 lux bh1750 23 1234\n"), []string{"lux 1234"}, nil},
+		{"failed", io.MultiReader(strings.NewReader("100 lux bh1750 23 1234\n"), iotest.ErrReader(failed)), []string{"lux 1234"}, failed},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			c := NewCollector()
+			errc := make(chan error, 1)
+			go func() { errc <- c.Run(tt.r) }()
+			var got []string
+			for s := range c.Samples() {
+				got = append(got, s.Kind+" "+s.Value)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("got samples %q; want %q", got, tt.want)
+			}
+			if err := <-errc; !errors.Is(err, tt.err) {
+				t.Errorf("Run = %v; want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestCollectorParsers(t *testing.T) {
+	c := NewCollector(Generic{})
+	if _, ok := c.Parse("100 humidity DHT22 45.2 70.5"); ok {
+		t.Error("a collector of generic lines alone parsed a humidity line")
+	}
+	if samples, ok := c.Parse("100 lux bh1750 23 1234"); !ok || len(samples) != 1 {
+		t.Errorf("Parse of a generic line = %v, %v", samples, ok)
+	}
+}
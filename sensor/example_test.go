@@ -0,0 +1,22 @@
+package sensor_test
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aqua/wrt54gl-sensor-collector/sensor"
+)
+
+func ExampleCollector() {
+	lines := "100 temp 28ff0a1b2c3d DS18B20 70.5\n101 humidity DHT22 45.2 70.5\n"
+	c := sensor.NewCollector()
+	go c.Run(strings.NewReader(lines))
+	for s := range c.Samples() {
+		v, _ := s.Float()
+		fmt.Println(s.Kind, s.ID, s.Model, v)
+	}
+	// Output:
+	// temp 28ff0a1b2c3d DS18B20 70.5
+	// humidity  DHT22 45.2
+	// temp  DHT22 70.5
+}
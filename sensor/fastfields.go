@@ -0,0 +1,76 @@
+package sensor
+
+import "strings"
+
+// fastFieldMatcher returns a hand-written matcher for the field regexp e,
+// as NewFieldPattern would compile it, if it's one of those every sample
+// line is matched against, or nil.  They match exactly what the regexps
+// would, but in a fraction of the time.
+func fastFieldMatcher(e string) func(string) bool {
+	switch e {
+	case ValueField:
+		return isValueField
+	case UnitField:
+		return isUnitField
+	case `\w+`:
+		return isWord
+	case `[0-9a-f]+`:
+		return isHex
+	}
+	for _, c := range e {
+		if c < 'a' || c > 'z' {
+			return nil
+		}
+	}
+	// A literal word, such as temp.
+	return func(f string) bool { return strings.EqualFold(f, e) }
+}
+
+// isWord matches (?i)\w+, which as case folding goes includes the Kelvin
+// sign and the long s.
+func isWord(f string) bool {
+	for _, c := range f {
+		if !(c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == '\u212a' || c == '\u017f') {
+			return false
+		}
+	}
+	return f != ""
+}
+
+// isHex matches (?i)[0-9a-f]+.
+func isHex(f string) bool {
+	for i := 0; i < len(f); i++ {
+		if c := f[i]; !(c >= '0' && c <= '9' || c >= 'a' && c <= 'f' || c >= 'A' && c <= 'F') {
+			return false
+		}
+	}
+	return f != ""
+}
+
+// isValueField matches ValueField: a number, perhaps with a unit glued on.
+func isValueField(f string) bool {
+	f = strings.TrimPrefix(f, "-")
+	n := 0
+	for n < len(f) && (f[n] >= '0' && f[n] <= '9' || f[n] == '.') {
+		n++
+	}
+	if n == 0 {
+		return false
+	}
+	switch unit := f[n:]; {
+	case unit == "", unit == "%", strings.EqualFold(unit, "hpa"):
+		return true
+	default:
+		return isUnitField(unit)
+	}
+}
+
+// isUnitField matches (?i)°?[CFK], which as case folding goes includes the
+// Kelvin sign.
+func isUnitField(f string) bool {
+	switch strings.TrimPrefix(f, "°") {
+	case "C", "c", "F", "f", "K", "k", "\u212a":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,87 @@
+package sensor
+
+import (
+	"math/rand"
+	"regexp"
+	"testing"
+)
+
+func TestFastFieldMatcher(t *testing.T) {
+	for _, tt := range []struct {
+		expr  string
+		field string
+		want  bool
+	}{
+		{ValueField, "21.5", true},
+		{ValueField, "-40", true},
+		{ValueField, "21.5C", true},
+		{ValueField, "21.5°f", true},
+		{ValueField, "296.6K", true},
+		{ValueField, "296.6\u212a", true},
+		{ValueField, "40%", true},
+		{ValueField, "1013HPA", true},
+		{ValueField, "..", true},
+		{ValueField, "-", false},
+		{ValueField, "21.5 C", false},
+		{ValueField, "21.5X", false},
+		{ValueField, "1e3", false},
+		{UnitField, "°C", true},
+		{UnitField, "k", true},
+		{UnitField, "K", true},
+		{UnitField, "\u212a", true},
+		{UnitField, "°", false},
+		{UnitField, "CC", false},
+		{`\w+`, "node_1", true},
+		{`\w+`, "\u212a\u017f", true},
+		{`\w+`, "node-1", false},
+		{`\w+`, "", false},
+		{`\w+`, "é", false},
+		{`[0-9a-f]+`, "28FF0a1b", true},
+		{`[0-9a-f]+`, "28fg", false},
+		{`[0-9a-f]+`, "", false},
+		{`temp`, "TEMP", true},
+		{`temp`, "temps", false},
+		{`humidity`, "Humidity", true},
+	} {
+		fast := fastFieldMatcher(tt.expr)
+		if fast == nil {
+			t.Fatalf("no fast matcher for %q", tt.expr)
+		}
+		re := regexpFieldPattern(tt.expr)[0]
+		if got := fast(tt.field); got != tt.want {
+			t.Errorf("fast %q matching %q = %v; want %v", tt.expr, tt.field, got, tt.want)
+		}
+		if got := re(tt.field); got != tt.want {
+			t.Errorf("regexp %q matching %q = %v; want %v", tt.expr, tt.field, got, tt.want)
+		}
+	}
+}
+
+func TestFastFieldMatcherNone(t *testing.T) {
+	for _, e := range []string{`\d+`, `temp|humidity`, `Temp`, `[0-9]+`} {
+		if fastFieldMatcher(e) != nil {
+			t.Errorf("fastFieldMatcher(%q) isn't nil", e)
+		}
+	}
+}
+
+// TestFastFieldMatcherRandom compares the fast matchers to the regexps over
+// random strings of the runes they're most likely to disagree on.
+func TestFastFieldMatcherRandom(t *testing.T) {
+	runes := []rune("0123456789.-°%CcFfKkhHpPaAxs_ \u212a\u017f")
+	r := rand.New(rand.NewSource(1))
+	for _, e := range []string{ValueField, UnitField, `\w+`, `[0-9a-f]+`, `temp`} {
+		fast := fastFieldMatcher(e)
+		re := regexp.MustCompile(`^(?i)(?:` + e + `)$`)
+		for i := 0; i < 20000; i++ {
+			b := make([]rune, r.Intn(7))
+			for j := range b {
+				b[j] = runes[r.Intn(len(runes))]
+			}
+			f := string(b)
+			if fast(f) != re.MatchString(f) {
+				t.Errorf("%q matching %q: fast %v, regexp %v", e, f, fast(f), re.MatchString(f))
+			}
+		}
+	}
+}
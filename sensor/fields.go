@@ -0,0 +1,69 @@
+package sensor
+
+import (
+	"regexp"
+	"strings"
+)
+
+// FieldPattern matches a line shape, one matcher per field.  A nil matcher
+// stands for the leading timestamp field, matched as Match is told to.
+type FieldPattern []func(string) bool
+
+// TimestampField stands for the leading timestamp field in NewFieldPattern.
+const TimestampField = ""
+
+// ValueField matches a sample value, optionally with its unit glued on, as
+// some firmware writes: "23.5C", "71.6°F", "296.6K", "48.2%", "1013.2hPa".
+const ValueField = `-?[\d.]+(?:°?[CFK]|%|hPa)?`
+
+// UnitField matches a temperature unit given as a field of its own.
+const UnitField = `°?[CFK]`
+
+// NewFieldPattern builds a FieldPattern from one case-insensitive regexp
+// per field, each matching the whole field, or TimestampField.  Those for
+// the common fields, which are most of the work of parsing, are replaced by
+// the hand-written equivalents in fastfields.go.
+func NewFieldPattern(exprs ...string) FieldPattern {
+	p := make(FieldPattern, len(exprs))
+	for i, e := range exprs {
+		if e == TimestampField {
+			continue
+		}
+		if p[i] = fastFieldMatcher(e); p[i] == nil {
+			p[i] = regexp.MustCompile(`^(?i)(?:` + e + `)$`).MatchString
+		}
+	}
+	return p
+}
+
+// Match reports whether fields are of p's shape, matching the timestamp
+// field with timestamp, or IsInteger if it's nil.
+func (p FieldPattern) Match(fields []string, timestamp func(string) bool) bool {
+	if len(fields) != len(p) {
+		return false
+	}
+	if timestamp == nil {
+		timestamp = IsInteger
+	}
+	for i, m := range p {
+		if m == nil {
+			m = timestamp
+		}
+		if !m(fields[i]) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsInteger matches -?\d+: the gateway's leading field is a (signed)
+// counter, not a real time.
+func IsInteger(f string) bool {
+	f = strings.TrimPrefix(f, "-")
+	for _, c := range f {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return f != ""
+}
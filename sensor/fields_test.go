@@ -0,0 +1,78 @@
+package sensor
+
+import (
+	"regexp"
+	"testing"
+)
+
+// regexpFieldPattern is NewFieldPattern without the fast matchers.
+func regexpFieldPattern(exprs ...string) FieldPattern {
+	p := NewFieldPattern(exprs...)
+	for i, e := range exprs {
+		if e != TimestampField {
+			p[i] = regexp.MustCompile(`^(?i)(?:` + e + `)$`).MatchString
+		}
+	}
+	return p
+}
+
+// useRegexpPatterns makes the line patterns match by regexp alone for the
+// rest of t.
+func useRegexpPatterns(t testing.TB) {
+	patterns := []*FieldPattern{&ds18x20Sample, &ds18x20UnitSample, &ds18x20NoModelSample, &humiditySample, &genericSample}
+	old := make([]FieldPattern, len(patterns))
+	for i, p := range patterns {
+		old[i] = *p
+	}
+	ds18x20Sample = regexpFieldPattern(TimestampField, `temp`, `[0-9a-f]+`, `\w+`, ValueField)
+	ds18x20UnitSample = regexpFieldPattern(TimestampField, `temp`, `[0-9a-f]+`, `\w+`, ValueField, UnitField)
+	ds18x20NoModelSample = regexpFieldPattern(TimestampField, `temp`, `[0-9a-f]+`, ValueField)
+	humiditySample = regexpFieldPattern(TimestampField, `humidity`, `\w+`, ValueField, ValueField)
+	genericSample = regexpFieldPattern(TimestampField, `\w+`, `\w+`, `\w+`, ValueField)
+	t.Cleanup(func() {
+		for i, p := range patterns {
+			*p = old[i]
+		}
+	})
+}
+
+func TestFieldPatternMatch(t *testing.T) {
+	p := NewFieldPattern(TimestampField, `temp`, ValueField)
+	word := func(f string) bool { return f == "ts" }
+	for _, tt := range []struct {
+		fields    []string
+		timestamp func(string) bool
+		want      bool
+	}{
+		{[]string{"100", "temp", "21.5"}, nil, true},
+		{[]string{"-100", "TEMP", "21.5"}, nil, true},
+		{[]string{"ts", "temp", "21.5"}, nil, false},
+		{[]string{"ts", "temp", "21.5"}, word, true},
+		{[]string{"100", "temp", "21.5"}, word, false},
+		{[]string{"100", "temp"}, nil, false},
+		{[]string{"100", "temp", "21.5", "C"}, nil, false},
+		{[]string{"100", "lux", "21.5"}, nil, false},
+	} {
+		if got := p.Match(tt.fields, tt.timestamp); got != tt.want {
+			t.Errorf("Match(%q) = %v; want %v", tt.fields, got, tt.want)
+		}
+	}
+}
+
+func TestIsInteger(t *testing.T) {
+	for _, tt := range []struct {
+		f    string
+		want bool
+	}{
+		{"100", true},
+		{"-7", true},
+		{"", false},
+		{"-", false},
+		{"1.5", false},
+		{"1e3", false},
+	} {
+		if got := IsInteger(tt.f); got != tt.want {
+			t.Errorf("IsInteger(%q) = %v; want %v", tt.f, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+package sensor
+
+import "strings"
+
+var (
+	ds18x20Sample = NewFieldPattern(TimestampField, `temp`, `[0-9a-f]+`, `\w+`, ValueField)
+	// Newer firmware that says which unit the value is in.
+	ds18x20UnitSample = NewFieldPattern(TimestampField, `temp`, `[0-9a-f]+`, `\w+`, ValueField, UnitField)
+	// Older firmware that leaves out the model.
+	ds18x20NoModelSample = NewFieldPattern(TimestampField, `temp`, `[0-9a-f]+`, ValueField)
+	// Humidity and temperature from one sensor of a model, e.g. DHT22.
+	humiditySample = NewFieldPattern(TimestampField, `humidity`, `\w+`, ValueField, ValueField)
+	// Sensors using the "<ts> <kind> <model> <id> <value>" line shape.
+	genericSample = NewFieldPattern(TimestampField, `\w+`, `\w+`, `\w+`, ValueField)
+)
+
+// DS18x20 parses a DS18x20's "<ts> temp <id> [<model>] <value> [<unit>]"
+// lines.
+type DS18x20 struct {
+	// Timestamp matches a line's leading field; IsInteger if nil.
+	Timestamp func(string) bool
+}
+
+func (p DS18x20) Parse(f []string) ([]Sample, bool) {
+	switch {
+	case ds18x20Sample.Match(f, p.Timestamp):
+		return []Sample{{Timestamp: f[0], Kind: f[1], ID: f[2], Model: f[3], Value: f[4]}}, true
+	case ds18x20UnitSample.Match(f, p.Timestamp):
+		return []Sample{{Timestamp: f[0], Kind: f[1], ID: f[2], Model: f[3], Value: f[4], Unit: f[5]}}, true
+	case ds18x20NoModelSample.Match(f, p.Timestamp):
+		return []Sample{{Timestamp: f[0], Kind: f[1], ID: f[2], Value: f[3]}}, true
+	}
+	return nil, false
+}
+
+// Humidity parses "<ts> humidity <model> <humidity> <temperature>" lines,
+// as a humidity sample and a temp one.
+type Humidity struct {
+	// Timestamp matches a line's leading field; IsInteger if nil.
+	Timestamp func(string) bool
+}
+
+func (p Humidity) Parse(f []string) ([]Sample, bool) {
+	if !humiditySample.Match(f, p.Timestamp) {
+		return nil, false
+	}
+	return []Sample{
+		{Timestamp: f[0], Kind: f[1], Model: f[2], Value: f[3]},
+		{Timestamp: f[0], Kind: "temp", Model: f[2], Value: f[4]},
+	}, true
+}
+
+// Generic parses "<ts> <kind> <model> <id> <value>" lines.
+type Generic struct {
+	// Timestamp matches a line's leading field; IsInteger if nil.
+	Timestamp func(string) bool
+}
+
+func (p Generic) Parse(f []string) ([]Sample, bool) {
+	if !genericSample.Match(f, p.Timestamp) {
+		return nil, false
+	}
+	return []Sample{{Timestamp: f[0], Kind: f[1], Model: f[2], ID: f[3], Value: f[4]}}, true
+}
+
+// KV parses "[<ts>] id=<id> [model=<model>] <kind>=<value>..." lines, with
+// a sample per kind, in order.  Keys are lower-cased, and the model is
+// generic if the line doesn't give one.
+type KV struct {
+	// Timestamp matches a line's leading field; IsInteger if nil.
+	Timestamp func(string) bool
+}
+
+func (p KV) Parse(fields []string) ([]Sample, bool) {
+	timestamp := p.Timestamp
+	if timestamp == nil {
+		timestamp = IsInteger
+	}
+	var ts string
+	if len(fields) > 0 && !strings.Contains(fields[0], "=") && timestamp(fields[0]) {
+		ts, fields = fields[0], fields[1:]
+	}
+	if len(fields) == 0 {
+		return nil, false
+	}
+	var pairs [][2]string
+	for _, f := range fields {
+		k, v, found := strings.Cut(f, "=")
+		if !found || k == "" {
+			return nil, false
+		}
+		pairs = append(pairs, [2]string{strings.ToLower(k), v})
+	}
+	ID, model := kvValue(pairs, "id", ""), kvValue(pairs, "model", "generic")
+	samples := []Sample{}
+	for _, kv := range pairs {
+		if kv[0] != "id" && kv[0] != "model" {
+			samples = append(samples, Sample{Timestamp: ts, Kind: kv[0], ID: ID, Model: model, Value: kv[1]})
+		}
+	}
+	return samples, true
+}
+
+// kvValue returns the value of the first of pairs with key, or def.
+func kvValue(pairs [][2]string, key, def string) string {
+	for _, kv := range pairs {
+		if kv[0] == key {
+			return kv[1]
+		}
+	}
+	return def
+}
@@ -0,0 +1,92 @@
+package sensor
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParsers(t *testing.T) {
+	for _, tt := range []struct {
+		parser Parser
+		line   string
+		want   []Sample
+		ok     bool
+	}{
+		{DS18x20{}, "100 temp 28ff0a1b2c3d DS18B20 70.5", []Sample{{Timestamp: "100", Kind: "temp", ID: "28ff0a1b2c3d", Model: "DS18B20", Value: "70.5"}}, true},
+		{DS18x20{}, "100 temp 28ff0a1b2c3d DS18B20 21.5 °C", []Sample{{Timestamp: "100", Kind: "temp", ID: "28ff0a1b2c3d", Model: "DS18B20", Value: "21.5", Unit: "°C"}}, true},
+		{DS18x20{}, "100 temp 28ff0a1b2c3d 70.5", []Sample{{Timestamp: "100", Kind: "temp", ID: "28ff0a1b2c3d", Value: "70.5"}}, true},
+		{DS18x20{}, "100 temp 28fg0a1b2c3d DS18B20 70.5", nil, false},
+		{DS18x20{}, "x temp 28ff0a1b2c3d DS18B20 70.5", nil, false},
+		{DS18x20{Timestamp: func(string) bool { return true }}, "x temp 28ff0a1b2c3d DS18B20 70.5", []Sample{{Timestamp: "x", Kind: "temp", ID: "28ff0a1b2c3d", Model: "DS18B20", Value: "70.5"}}, true},
+		{Humidity{}, "100 humidity DHT22 45.2 70.5", []Sample{
+			{Timestamp: "100", Kind: "humidity", Model: "DHT22", Value: "45.2"},
+			{Timestamp: "100", Kind: "temp", Model: "DHT22", Value: "70.5"},
+		}, true},
+		{Humidity{}, "100 humidity DHT22 45.2", nil, false},
+		{Generic{}, "100 lux bh1750 23 1234", []Sample{{Timestamp: "100", Kind: "lux", Model: "bh1750", ID: "23", Value: "1234"}}, true},
+		{Generic{}, "100 lux bh1750 node-1 1234", nil, false},
+		{KV{}, "id=node-1 model=SHT31 temp=21.5 Humidity=40%", []Sample{
+			{Kind: "temp", ID: "node-1", Model: "SHT31", Value: "21.5"},
+			{Kind: "humidity", ID: "node-1", Model: "SHT31", Value: "40%"},
+		}, true},
+		{KV{}, "100 id=node-1 temp=21.5", []Sample{{Timestamp: "100", Kind: "temp", ID: "node-1", Model: "generic", Value: "21.5"}}, true},
+		{KV{}, "temp=21.5", []Sample{{Kind: "temp", Model: "generic", Value: "21.5"}}, true},
+		{KV{}, "id=node-1", []Sample{}, true},
+		{KV{}, "100", nil, false},
+		{KV{}, "id=node-1 temp 21.5", nil, false},
+		{KV{}, "id=node-1 =21.5", nil, false},
+	} {
+		got, ok := tt.parser.Parse(strings.Fields(tt.line))
+		if ok != tt.ok || !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%T.Parse(%q) = %+v, %v; want %+v, %v", tt.parser, tt.line, got, ok, tt.want, tt.ok)
+		}
+	}
+}
+
+func TestSampleFloat(t *testing.T) {
+	for _, tt := range []struct {
+		value string
+		want  float64
+		ok    bool
+	}{
+		{"21.5", 21.5, true},
+		{"-40", -40, true},
+		{"23.5C", 23.5, true},
+		{"71.6°F", 71.6, true},
+		{"296.6K", 296.6, true},
+		{"296.6\u212a", 296.6, true},
+		{"48.2%", 48.2, true},
+		{"1013.2hPa", 1013.2, true},
+		{"wet", 0, false},
+		{"", 0, false},
+	} {
+		got, err := Sample{Value: tt.value}.Float()
+		if (err == nil) != tt.ok || got != tt.want {
+			t.Errorf("Float of %q = %v, %v; want %v, ok %v", tt.value, got, err, tt.want, tt.ok)
+		}
+	}
+}
+
+func BenchmarkParse(b *testing.B) {
+	for _, line := range []struct{ name, line string }{
+		{"ds18x20", "100 temp 28ff0a1b2c3d DS18B20 70.5"},
+		{"humidity", "100 humidity DHT22 45.2 70.5"},
+		{"generic", "100 lux bh1750 23 1234"},
+		{"unmatched", "100 something else entirely"},
+	} {
+		for _, matcher := range []string{"fast", "regexp"} {
+			b.Run(line.name+"/"+matcher, func(b *testing.B) {
+				if matcher == "regexp" {
+					useRegexpPatterns(b)
+				}
+				c := NewCollector()
+				b.ReportAllocs()
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					c.Parse(line.line)
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,63 @@
+// Package sensor parses the sample lines of the WRT54GL sensor gateway
+// firmware, for programs that want its readings without running the
+// collector, and without its Prometheus or networking machinery.
+//
+// A Parser recognizes one family of line formats, returning the Samples in
+// a line; a Collector reads lines from an io.Reader and sends the samples
+// in them to a channel.  Samples are as the line gave them: converting
+// units, rounding, filtering and naming devices is up to the importer.
+package sensor
+
+import (
+	"strconv"
+	"strings"
+)
+
+// Sample is one reading from a sample line.
+type Sample struct {
+	// Timestamp is the line's leading field, a counter or timestamp per
+	// the firmware, as given.
+	Timestamp string
+	// Kind is what was measured, as given: temp for a DS18x20's
+	// temperature, humidity, or a generic or key=value line's kind.  A
+	// humidity line's temperature is of kind temp.
+	Kind string
+	// ID is the sensor's ID, as given.  Humidity lines have none, their
+	// model standing in for it.
+	ID string
+	// Model is the sensor's model, as given, or empty if the line didn't
+	// say (older DS18x20 firmware).
+	Model string
+	// Value is the reading, as given, perhaps with a unit glued on:
+	// "23.5C", "71.6°F", "48.2%".
+	Value string
+	// Unit is a DS18x20 temperature's unit, if the line gave it as a field
+	// of its own.
+	Unit string
+}
+
+// Float returns s's value as a number, without any unit glued on.
+func (s Sample) Float() (float64, error) {
+	num, _ := SplitValue(s.Value)
+	return strconv.ParseFloat(num, 64)
+}
+
+// SplitValue splits a sample value into its number and the unit glued on
+// to it, if any: "23.5C" into "23.5" and "C".
+func SplitValue(v string) (num, unit string) {
+	num = strings.TrimRight(v, "CFKcfk\u212a°%hHpPaA")
+	return num, v[len(num):]
+}
+
+// Parser recognizes one family of sample line formats.
+type Parser interface {
+	// Parse returns the samples in a line's fields, or false if the line
+	// isn't in the parser's format.  A line in the format may hold no
+	// samples.
+	Parse(fields []string) ([]Sample, bool)
+}
+
+// DefaultParsers are the parsers of the firmware's line formats, in the
+// order the collector tries them, taking a line's leading field to be
+// an integer counter.
+var DefaultParsers = []Parser{DS18x20{}, Humidity{}, Generic{}, KV{}}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var leadingField = flag.String("leading-field", "timestamp", "Role of each line's leading field: timestamp (see -timestamp-format) or sequence, a per-device sample counter checked for gaps")
+var sequenceWrap = flag.Int64("sequence-wrap", 0, "If set, -leading-field=sequence numbers wrap to 0 at this value; otherwise a decrease is taken as a counter reset")
+
+var sequenceGaps = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "sequence_gaps_total",
+	Help:      "Samples missing according to gaps in devices' sequence numbers",
+})
+
+// noteSequence checks a device's sequence number f against the previous
+// one in this connection, counting any skipped.  Numbers aren't compared
+// across connections, as the sender may well have restarted.
+func (c *connection) noteSequence(ID, f string) {
+	seq, err := strconv.ParseInt(f, 10, 64)
+	if err != nil {
+		return
+	}
+	prev, ok := c.seq[ID]
+	c.seq[ID] = seq
+	if !ok {
+		return
+	}
+	if seq == prev {
+		return // a duplicate, missing nothing
+	}
+	gap := seq - prev - 1
+	if seq < prev {
+		if *sequenceWrap <= 0 {
+			return // reset
+		}
+		gap += *sequenceWrap
+	}
+	if gap > 0 {
+		sequenceGaps.Add(float64(gap))
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"os"
+	"strings"
+)
+
+var serialPorts = flag.String("serial", "", "Read samples from these comma-separated serial ports (e.g. /dev/ttyUSB0,/dev/ttyUSB1) instead of -connect, each on its own; set their speed beforehand with stty")
+
+// serialSources starts reading each of -serial's ports as a source of its
+// own, serial:<path>.
+func serialSources(ports string) {
+	for _, path := range strings.Split(ports, ",") {
+		if path = strings.TrimSpace(path); path != "" {
+			go readSerial(newSource("serial:"+path), path)
+		}
+	}
+}
+
+// readSerial reads samples from the serial port at path, reopening it
+// after errors, such as the adapter being unplugged, without affecting the
+// other ports.  The port's speed and mode are left as they are; the
+// original firmware wants `stty -F <path> 9600 raw`.
+func readSerial(src *source, path string) {
+	openNum := 0
+	for {
+		f, err := os.Open(path)
+		if err != nil {
+			throttledLogf("connection error", "Error opening %s: %v", path, err)
+			src.fail(reconnectDelay)
+			continue
+		}
+		openNum++
+		if openNum == 1 || !*quietReconnects {
+			log.Printf("Opened %s (open %d)", path, openNum)
+		}
+		src.setConnected(openNum, f)
+		err = scan(f, newConnection(src, openNum))
+		f.Close()
+		if err != nil {
+			throttledLogf("connection error", "Read failed from %s: %v", path, err)
+			src.fail(reconnectDelay)
+		} else {
+			log.Printf("%s closed", path)
+			src.disconnected(reconnectDelay)
+		}
+	}
+}
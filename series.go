@@ -0,0 +1,274 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// series is the collector's state for one exported sensor series.
+type series struct {
+	metric string
+	labels prometheus.Labels // id, device, model
+	// The vec and labels it's exported by, per vecFor.  The gauge itself
+	// isn't kept, as with -label-set=minimal several series can share
+	// one, and it may be deleted and recreated by another's expiry.
+	vec       *sensorGaugeVec
+	vecLabels prometheus.Labels
+	value     float64 // latest sample
+	at        time.Time
+	sampled   time.Time     // when value was taken, per its timestamp
+	ttl       time.Duration // per seriesTTL
+
+	// The current -average-window.
+	sum, min, max float64
+	n             int
+
+	// Decimation state: samples since the last one kept, and when that was.
+	skipped int
+	kept    time.Time
+
+	// The latest samples, for the median filter.
+	recent []float64
+
+	// Smoothing state: the latest samples for mean and median smoothing,
+	// or the EWMA, if averaged yet.
+	window   ring
+	ewma     float64
+	averaged bool
+
+	// The -extremes, and when they were last updated or decayed.
+	lo, hi    float64
+	extremeAt time.Time
+
+	// The latest sample as it arrived, before any stages, and when, for
+	// noteContention.
+	raw   float64
+	rawAt time.Time
+
+	// The last sample let through by model_max_rates, and when.
+	plausibleValue float64
+	plausibleAt    time.Time
+
+	// Whether it's gone its TTL without a sample, with -stale-action=mark.
+	stale bool
+}
+
+var staleTTL = flag.Duration("stale-ttl", 0, "If set, delete sensor series that go this long without a sample; see also device_ttls and model_ttls in -config")
+
+var staleAction = flag.String("stale-action", "delete", "What to do about sensor series that go their TTL without a sample: delete them, or mark them by setting their gauges to -stale-value until the next sample")
+var staleValue = flag.Float64("stale-value", math.NaN(), "The value gauges of stale series are set to with -stale-action=mark")
+
+var seriesExpired = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "series_expired_total",
+	Help:      "Sensor series deleted, or with -stale-action=mark marked stale, for going without samples for their TTL",
+})
+
+var (
+	seriesMu sync.Mutex
+	// allSeries is keyed by seriesKey.
+	allSeries = map[string]*series{}
+	// modelSeries and deviceSeries count allSeries by model and device,
+	// and staleSeries those marked stale by device.
+	modelSeries  = map[string]int{}
+	deviceSeries = map[string]int{}
+	staleSeries  = map[string]int{}
+)
+
+func seriesKey(metric string, labels prometheus.Labels) string {
+	return metric + "\xff" + labels["id"] + "\xff" + labels["device"] + "\xff" + labels["model"]
+}
+
+// setGauge records a sample for a sensor series from o, which says when
+// it was taken (when it was received unless its line's timestamp said
+// otherwise) and by its source which pipeline it goes through.  metric
+// names the vec, which must be labelled by id, device and model.
+func setGauge(metric string, vec *sensorGaugeVec, labels prometheus.Labels, v float64, o origin) {
+	if metric == "temperature_degrees_celsius" && *exportKelvin {
+		setGauge("temperature_kelvin", kelvinGauges, labels, kelvin(v, labels["model"]), o)
+	}
+	at := o.at
+	seriesMu.Lock()
+	defer seriesMu.Unlock()
+	now := clk.Now()
+	key := seriesKey(metric, labels)
+	s := allSeries[key]
+	if s == nil {
+		s = &series{metric: metric, labels: labels, ttl: seriesTTL(labels)}
+		s.vec, s.vecLabels = vecFor(metric, vec, labels)
+		allSeries[key] = s
+		modelSeries[labels["model"]]++
+		if deviceSeries[labels["device"]]++; deviceSeries[labels["device"]] == 1 {
+			events.DeviceSeen(labels["device"], labels["model"])
+		}
+		queueExpiry(key, s, now)
+	}
+	s.noteContention(v, now)
+	// Decimated samples still count as signs of life.
+	prev := s.at
+	s.at = now
+	if s.stale {
+		s.unmarkStale(key, now)
+	}
+	// Kelvin copies aren't samples of their own.
+	copied := vec == kelvinGauges
+	for _, st := range o.stages() {
+		var ok bool
+		if v, ok = st.apply(s, v, prev, now, copied); !ok {
+			return
+		}
+	}
+	s.value, s.sampled = v, at
+	s.noteExtremes(v, now)
+	if !copied {
+		acceptedSamples.WithLabelValues(labels["device"]).Inc()
+		auditSample(metric, labels, v, at)
+	}
+	debugf("accepted %s: %s = %g", labels["device"], metric, v)
+	if *averageWindow > 0 {
+		s.accumulate(v)
+	} else {
+		sink.SetGauge(s.metric, s.labels, v)
+	}
+}
+
+// expireSeries deletes the series not updated within their TTL, every
+// interval, except during maintenance.
+func expireSeries(interval time.Duration) {
+	for range tick(interval) {
+		if inMaintenance(clk.Now()) {
+			continue
+		}
+		seriesMu.Lock()
+		n := expireDue(clk.Now())
+		seriesMu.Unlock()
+		for _, v := range counterVecs {
+			n += v.expire(clk.Now())
+		}
+		n += expireRaw(clk.Now())
+		seriesExpired.Add(float64(n))
+	}
+}
+
+// forgetSeries deletes a series and anything derived from it.  seriesMu
+// must be held.
+func forgetSeries(key string, s *series) {
+	s.vec.Delete(s.vecLabels)
+	if s.metric == "battery_volts" {
+		batteryLowGauges.Delete(s.labels)
+		forgetFlag("battery_low", s.labels)
+	}
+	if s.metric == "temperature_degrees_celsius" {
+		rawTemperatureGauges.DeletePartialMatch(s.labels)
+	}
+	readErrorGauges.Delete(s.labels)
+	s.forgetExtremes()
+	s.forgetWindow()
+	s.forgetUnsmoothed()
+	if s.stale {
+		if staleSeries[s.labels["device"]]--; staleSeries[s.labels["device"]] == 0 {
+			delete(staleSeries, s.labels["device"])
+		}
+	}
+	delete(allSeries, key)
+	if modelSeries[s.labels["model"]]--; modelSeries[s.labels["model"]] == 0 {
+		delete(modelSeries, s.labels["model"])
+	}
+	if deviceSeries[s.labels["device"]]--; deviceSeries[s.labels["device"]] == 0 {
+		delete(deviceSeries, s.labels["device"])
+		delete(deviceParseErrors, s.labels["device"])
+		forgetSyslogHost(s.labels["device"])
+		forgetRawDevice(s.labels["device"])
+		releaseID(s.labels["id"])
+	}
+}
+
+// deviceGone reports whether a device has no series left.  seriesMu must
+// be held.
+func deviceGone(device string) bool {
+	return deviceSeries[device] == 0
+}
+
+// expireDevice handles POST /expire?device=..., immediately deleting every
+// series of a device (by device label or raw id), say after physically
+// removing it.
+func expireDevice(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "POST only", http.StatusMethodNotAllowed)
+		return
+	}
+	device := r.URL.Query().Get("device")
+	if device == "" {
+		http.Error(w, "device parameter required", http.StatusBadRequest)
+		return
+	}
+	seriesMu.Lock()
+	defer seriesMu.Unlock()
+	n := forgetRawDevice(device)
+	for key, s := range allSeries {
+		if s.labels["device"] == device || s.labels["id"] == device {
+			forgetSeries(key, s)
+			n++
+		}
+	}
+	if n == 0 {
+		http.Error(w, "no such device", http.StatusNotFound)
+		return
+	}
+	log.Printf("Expired %d series of %s on request", n, device)
+	fmt.Fprintf(w, "expired %d series\n", n)
+}
+
+// seriesTTL returns how long a series may go without samples before it is
+// deleted; zero means forever.  Per-device TTLs (by device or raw id) take
+// precedence over per-model TTLs, which take precedence over -stale-ttl.
+func seriesTTL(labels prometheus.Labels) time.Duration {
+	if ttl, ok := cfg.DeviceTTLs[labels["device"]]; ok {
+		return time.Duration(ttl)
+	}
+	if ttl, ok := cfg.DeviceTTLs[labels["id"]]; ok {
+		return time.Duration(ttl)
+	}
+	if ttl, ok := cfg.ModelTTLs[labels["model"]]; ok {
+		return time.Duration(ttl)
+	}
+	return *staleTTL
+}
+
+var activeSeriesDesc = prometheus.NewDesc("sensors_active_series",
+	"Sensor series currently exported, by model", []string{"model"}, nil)
+
+// activeSeriesCollector exports the per-model series counts kept up to
+// date by setGauge, to help spot cardinality creep.
+type activeSeriesCollector struct{}
+
+func (activeSeriesCollector) Describe(ch chan<- *prometheus.Desc) { ch <- activeSeriesDesc }
+
+func (activeSeriesCollector) Collect(ch chan<- prometheus.Metric) {
+	seriesMu.Lock()
+	defer seriesMu.Unlock()
+	for model, n := range modelSeries {
+		ch <- prometheus.MustNewConstMetric(activeSeriesDesc, prometheus.GaugeValue, float64(n), model)
+	}
+}
+
+// shortestTTL returns the shortest configured series TTL, or zero if none
+// expire.
+func shortestTTL() time.Duration {
+	shortest := *staleTTL
+	for _, ttls := range []map[string]duration{cfg.DeviceTTLs, cfg.ModelTTLs} {
+		for _, ttl := range ttls {
+			if d := time.Duration(ttl); d > 0 && (shortest == 0 || d < shortest) {
+				shortest = d
+			}
+		}
+	}
+	return shortest
+}
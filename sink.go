@@ -0,0 +1,72 @@
+package main
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// metricSink is where the record path sends sensor measurements, once
+// filtered, converted and smoothed, so that backends other than the
+// Prometheus exposition can be fed without reaching into its vecs.
+// labels are a series' id, device and model (just model for
+// inter_sample_seconds), as recorded rather than as exported, and names
+// are without the sensors_ prefix.  Series state, such as TTLs and
+// counter resets, stays with the series: sinks see only the results.
+// SetGauge is called with seriesMu held, so sinks must not block.
+type metricSink interface {
+	// SetGauge is a gauge series taking the value v.
+	SetGauge(name string, labels prometheus.Labels, v float64)
+	// IncCounter is a counter series going up by delta.
+	IncCounter(name string, labels prometheus.Labels, delta float64)
+	// ObserveHistogram is an observation v of a histogram.
+	ObserveHistogram(name string, labels prometheus.Labels, v float64)
+}
+
+// sink is where measurements go: by default to the Prometheus exposition.
+var sink metricSink = promSink{}
+
+// promSink updates the vecs behind /metrics.
+type promSink struct{}
+
+// SetGauge sets the gauge of the series; seriesMu must be held.
+func (promSink) SetGauge(name string, labels prometheus.Labels, v float64) {
+	if s := allSeries[seriesKey(name, labels)]; s != nil {
+		s.vec.With(s.vecLabels).Set(v)
+	}
+}
+
+func (promSink) IncCounter(name string, labels prometheus.Labels, delta float64) {
+	if v := counterVecs[name]; v != nil {
+		v.inc(name, labels, delta)
+	}
+}
+
+func (promSink) ObserveHistogram(name string, labels prometheus.Labels, v float64) {
+	if h := sampleHistograms[name]; h != nil {
+		h().With(labels).Observe(v)
+	}
+}
+
+// sampleHistograms are the histograms of sensor measurements, by name,
+// returning the current vec, which may be rebuilt per histogram_buckets.
+var sampleHistograms = map[string]func() *prometheus.HistogramVec{
+	"inter_sample_seconds": func() *prometheus.HistogramVec { return interSampleSeconds },
+}
+
+// fanOutSink sends every measurement to each of several sinks in turn.
+type fanOutSink []metricSink
+
+func (f fanOutSink) SetGauge(name string, labels prometheus.Labels, v float64) {
+	for _, s := range f {
+		s.SetGauge(name, labels, v)
+	}
+}
+
+func (f fanOutSink) IncCounter(name string, labels prometheus.Labels, delta float64) {
+	for _, s := range f {
+		s.IncCounter(name, labels, delta)
+	}
+}
+
+func (f fanOutSink) ObserveHistogram(name string, labels prometheus.Labels, v float64) {
+	for _, s := range f {
+		s.ObserveHistogram(name, labels, v)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var smoothingMethod = flag.String("smoothing-method", "none", "How to smooth the samples of models without model_smoothing in -config: none, ewma, mean (of the last -smoothing-window) or median (of them)")
+var smoothingWindow = flag.Int("smoothing-window", 5, "How many samples -smoothing-method smooths over; for ewma, the N of a smoothing factor of 2/(N+1)")
+
+// smoothing is how to smooth a model's samples.
+type smoothing struct {
+	Method string `json:"method"`
+	Window int    `json:"window"`
+}
+
+func (sm smoothing) check() error {
+	switch sm.Method {
+	case "none":
+		return nil
+	case "ewma", "mean", "median":
+	default:
+		return fmt.Errorf("method must be none, ewma, mean or median, not %q", sm.Method)
+	}
+	if sm.Window < 1 {
+		return fmt.Errorf("window must be at least 1")
+	}
+	return nil
+}
+
+var unsmoothedGauges = newSensorGaugeVec(prometheus.GaugeOpts{
+	Namespace: "sensors",
+	Name:      "unsmoothed",
+	Help:      "Latest sample of a smoothed series, before -smoothing-method or model_smoothing",
+}, windowLabels)
+
+// smoothingConfigured reports whether any series may be smoothed.
+func smoothingConfigured() bool {
+	return *smoothingMethod != "none" || len(cfg.ModelSmoothing) > 0
+}
+
+// smoothingFor returns how to smooth a series: per its model's
+// model_smoothing, else -smoothing-method.
+func smoothingFor(labels prometheus.Labels) smoothing {
+	if sm, ok := cfg.ModelSmoothing[strings.ToLower(labels["model"])]; ok {
+		return sm
+	}
+	return smoothing{*smoothingMethod, *smoothingWindow}
+}
+
+// ring is a series' latest samples, up to a fixed number.
+type ring struct {
+	buf  []float64
+	next int
+	full bool
+}
+
+// add adds v, first emptying the ring if it isn't of size.
+func (r *ring) add(v float64, size int) {
+	if len(r.buf) != size {
+		*r = ring{buf: make([]float64, size)}
+	}
+	r.buf[r.next] = v
+	if r.next++; r.next == size {
+		r.next, r.full = 0, true
+	}
+}
+
+// values returns the samples in the ring, in no particular order.
+func (r *ring) values() []float64 {
+	if r.full {
+		return r.buf
+	}
+	return r.buf[:r.next]
+}
+
+func (r *ring) reset() {
+	r.next, r.full = 0, false
+}
+
+// smooth returns the sample v smoothed per smoothingFor, exporting v as
+// is in sensors_unsmoothed too.  An EWMA follows a step change most
+// quickly at first but never quite forgets a spike; a mean of N lags by
+// N/2 samples and shares a spike out among N; a median of N lags as much
+// but drops a spike altogether, up to (N-1)/2 in a row.  As with the
+// median filter, samples from before a gap longer than -max-export-age are
+// forgotten.  seriesMu must be held.
+func (s *series) smooth(v float64, prev, now time.Time) float64 {
+	sm := smoothingFor(s.labels)
+	if sm.Method == "none" {
+		return v
+	}
+	l := prometheus.Labels{"metric": s.metric}
+	for k, val := range s.labels {
+		l[k] = val
+	}
+	unsmoothedGauges.With(l).Set(v)
+	if *maxExportAge > 0 && now.Sub(prev) > *maxExportAge {
+		s.window.reset()
+		s.averaged = false
+	}
+	switch sm.Method {
+	case "ewma":
+		if !s.averaged {
+			s.ewma, s.averaged = v, true
+		} else {
+			s.ewma += 2 / float64(sm.Window+1) * (v - s.ewma)
+		}
+		return s.ewma
+	case "mean":
+		s.window.add(v, sm.Window)
+		sum := 0.
+		for _, x := range s.window.values() {
+			sum += x
+		}
+		return sum / float64(len(s.window.values()))
+	default:
+		s.window.add(v, sm.Window)
+		return medianOf(s.window.values())
+	}
+}
+
+// forgetUnsmoothed deletes s's sensors_unsmoothed gauge along with it.
+func (s *series) forgetUnsmoothed() {
+	l := prometheus.Labels{"metric": s.metric}
+	for k, v := range s.labels {
+		l[k] = v
+	}
+	unsmoothedGauges.Delete(l)
+}
+
+// medianOf returns the median of vs, which mustn't be empty.
+func medianOf(vs []float64) float64 {
+	sorted := append([]float64(nil), vs...)
+	sort.Float64s(sorted)
+	m := len(sorted) / 2
+	if len(sorted)%2 == 0 {
+		return (sorted[m-1] + sorted[m]) / 2
+	}
+	return sorted[m]
+}
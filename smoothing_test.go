@@ -0,0 +1,88 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestSmoothingCheck(t *testing.T) {
+	for _, tt := range []struct {
+		sm smoothing
+		ok bool
+	}{
+		{smoothing{"none", 0}, true},
+		{smoothing{"ewma", 1}, true},
+		{smoothing{"mean", 5}, true},
+		{smoothing{"median", 3}, true},
+		{smoothing{"median", 0}, false},
+		{smoothing{"mode", 3}, false},
+		{smoothing{"", 3}, false},
+	} {
+		if err := tt.sm.check(); (err == nil) != tt.ok {
+			t.Errorf("%+v: check = %v; want ok %v", tt.sm, err, tt.ok)
+		}
+	}
+}
+
+func TestMedianOf(t *testing.T) {
+	for _, tt := range []struct {
+		vs   []float64
+		want float64
+	}{
+		{[]float64{1}, 1},
+		{[]float64{3, 1, 2}, 2},
+		{[]float64{4, 1, 3, 2}, 2.5},
+		{[]float64{20, 30, 20}, 20},
+	} {
+		if got := medianOf(tt.vs); got != tt.want {
+			t.Errorf("medianOf(%v) = %v; want %v", tt.vs, got, tt.want)
+		}
+	}
+}
+
+func TestSmoothLines(t *testing.T) {
+	samples := []float64{20, 20, 20, 30, 20, 20}
+	for i, tt := range []struct {
+		name string
+		flag string
+		cfg  config
+		gap  int // sample after which there's a gap past -max-export-age, if any
+		want []float64
+	}{
+		{"none", "none", config{}, 0, samples},
+		{"ewma", "ewma", config{}, 0, []float64{20, 20, 20, 25, 22.5, 21.25}},
+		{"mean", "mean", config{}, 0, []float64{20, 20, 20, 70. / 3, 70. / 3, 70. / 3}},
+		{"median", "median", config{}, 0, []float64{20, 20, 20, 20, 20, 20}},
+		{"model_smoothing", "none", config{ModelSmoothing: map[string]smoothing{"ds18b20": {"mean", 2}}}, 0, []float64{20, 20, 20, 25, 25, 20}},
+		{"model_smoothing none", "median", config{ModelSmoothing: map[string]smoothing{"ds18b20": {"none", 0}}}, 0, samples},
+		{"gap", "mean", config{}, 4, []float64{20, 20, 20, 70. / 3, 20, 20}},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			setFlag(t, "smoothing-method", tt.flag)
+			setFlag(t, "smoothing-window", "3")
+			setFlag(t, "max-export-age", "1m")
+			setConfig(t, tt.cfg)
+			c := newFakeClock()
+			setClock(t, c)
+			id := fmt.Sprintf("28ff0a1b2c7%d", i)
+			device := formatDevice(id, "DS18B20")
+			t.Cleanup(func() { forgetDevice(device) })
+			conn := testConnection(t)
+			for j, v := range samples {
+				c.Advance(time.Second)
+				if tt.gap != 0 && j == tt.gap {
+					c.Advance(time.Hour)
+				}
+				line := fmt.Sprintf("100 temp %s DS18B20 %v C", id, v)
+				if !processLine(line, conn) {
+					t.Fatalf("processLine(%q) didn't match", line)
+				}
+				if got, ok := gaugeValue(temperatureGauges, device); !ok || math.Abs(got-tt.want[j]) > 1e-9 {
+					t.Errorf("sample %d: gauge = %v, %v; want %v", j, got, ok, tt.want[j])
+				}
+			}
+		})
+	}
+}
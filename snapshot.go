@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var jsonOutputFile = flag.String("json-output-file", "", "If set, periodically write the current readings (as served on /snapshot) to this file")
+var jsonOutputInterval = flag.Duration("json-output-interval", 30*time.Second, "How often to write -json-output-file")
+
+var snapshotWriteErrors = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "json_output_errors_total",
+	Help:      "Failed writes of -json-output-file",
+})
+
+// reading is one series in a snapshot.
+type reading struct {
+	Metric string    `json:"metric"`
+	ID     string    `json:"id"`
+	Device string    `json:"device"`
+	Model  string    `json:"model"`
+	Value  float64   `json:"value"`
+	Time   time.Time `json:"time"`
+}
+
+// snapshot returns the latest sample of every series, ordered by metric
+// and device.
+func snapshot() []reading {
+	seriesMu.Lock()
+	rs := make([]reading, 0, len(allSeries))
+	for _, s := range allSeries {
+		rs = append(rs, reading{
+			Metric: s.metric,
+			ID:     s.labels["id"],
+			Device: s.labels["device"],
+			Model:  s.labels["model"],
+			Value:  s.value,
+			Time:   s.at,
+		})
+	}
+	seriesMu.Unlock()
+	sort.Slice(rs, func(i, j int) bool {
+		if rs[i].Metric != rs[j].Metric {
+			return rs[i].Metric < rs[j].Metric
+		}
+		if rs[i].Device != rs[j].Device {
+			return rs[i].Device < rs[j].Device
+		}
+		return rs[i].ID < rs[j].ID
+	})
+	return rs
+}
+
+// serveSnapshot handles /snapshot, the current readings as JSON.
+func serveSnapshot(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(snapshot())
+}
+
+// writeSnapshots writes the snapshot to path every interval.  Each is
+// written to a temporary file and renamed over path, so readers never see
+// a partial one.
+func writeSnapshots(path string, interval time.Duration) {
+	for range tick(interval) {
+		if err := writeSnapshot(path); err != nil {
+			log.Printf("Error writing %s: %v", path, err)
+			snapshotWriteErrors.Inc()
+		}
+	}
+}
+
+func writeSnapshot(path string) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name()) // fails harmlessly once renamed
+	// CreateTemp's 0600 would keep a web server from serving it.
+	if err := f.Chmod(0644); err != nil {
+		f.Close()
+		return err
+	}
+	if err := json.NewEncoder(f).Encode(snapshot()); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(f.Name(), path)
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"net"
+
+	"golang.org/x/net/proxy"
+)
+
+var (
+	socks5Proxy    = flag.String("socks5-proxy", "", "host:port of a SOCKS5 proxy to make -connect connections through, such as an ssh -D tunnel")
+	socks5User     = flag.String("socks5-user", "", "User name to authenticate to -socks5-proxy with, if it needs one")
+	socks5Password = flag.String("socks5-password", "", "Password for -socks5-user")
+)
+
+// socks5Dialer returns a dialFunc that connects through -socks5-proxy.
+// The endpoint's host name is resolved by the proxy, so it can be one only
+// known on the far side.  Errors from the proxy, including its refusing to
+// connect onwards, are dial errors like any other.
+func socks5Dialer() (dialFunc, error) {
+	var auth *proxy.Auth
+	if *socks5User != "" {
+		auth = &proxy.Auth{User: *socks5User, Password: *socks5Password}
+	}
+	d, err := proxy.SOCKS5("tcp", *socks5Proxy, auth, &net.Dialer{Timeout: *connectTimeout})
+	if err != nil {
+		return nil, err
+	}
+	return func(endpoint string) (net.Conn, error) {
+		// The dialer's timeout only covers reaching the proxy, so bound
+		// the handshake too.
+		ctx, cancel := context.WithTimeout(context.Background(), *connectTimeout)
+		defer cancel()
+		return d.(proxy.ContextDialer).DialContext(ctx, "tcp", endpoint)
+	}, nil
+}
@@ -0,0 +1,321 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// source tracks the connection state of one upstream sensor feed, for
+// /healthz.
+type source struct {
+	endpoint string
+	parsers  []lineParser
+	// The pipeline its samples go through, per source_pipelines.
+	stages []stage
+	// Lines not for this collector are dropped per filter, if set.
+	filter *lineFilter
+	// Humidity sensor models whose temperatures are in fahrenheit, if
+	// configured for this source.
+	fahrenheitModels map[string]bool
+
+	mu            sync.Mutex
+	connected     bool
+	everConnected bool
+	failures      int // consecutive
+	backoff       time.Duration
+	nextAttempt   time.Time
+	// The times of the latest reconnects, oldest first from reconnectIdx.
+	reconnects   [maxReconnectsTracked]time.Time
+	reconnectIdx int
+	// The current connection, to close for /reconnect, and a signal to
+	// cut short a backoff.
+	conn io.Closer
+	num  int // of the latest connection
+	kick chan struct{}
+	// The latest sample, and the latest scrape and how many in a row have
+	// found no sample since the one before, for -scrape-reconnect.
+	lastSample  time.Time
+	lastScrape  time.Time
+	idleScrapes int
+	// The device IDs of the latest complete -bus-window.
+	busMembers map[string]bool
+}
+
+// maxReconnectsTracked bounds the reconnect history kept per source, and
+// so the highest sensors_reconnects_last_hour can go.
+const maxReconnectsTracked = 256
+
+var sources []*source
+
+var backoffSeconds = prometheus.NewCounterVec(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "backoff_seconds_total",
+	Help:      "Time spent waiting to reconnect to a source, in seconds",
+}, []string{"endpoint"})
+
+// The per-source counterparts of connectionAttempts and connectionErrors,
+// which stay unlabelled so as not to break existing queries.
+var (
+	sourceConnectionAttempts = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sensors",
+		Name:      "source_connection_attempts_total",
+		Help:      "Attempts to connect to a source, by endpoint",
+	}, []string{"endpoint"})
+	sourceConnectionErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: "sensors",
+		Name:      "source_connection_errors_total",
+		Help:      "Failures to connect to a source, or of its connection, by endpoint",
+	}, []string{"endpoint"})
+)
+
+// countAttempt counts an attempt to connect to s.
+func (s *source) countAttempt() {
+	connectionAttempts.Inc()
+	sourceConnectionAttempts.WithLabelValues(s.endpoint).Inc()
+}
+
+// countError counts a failure to connect to s, or of its connection.
+func (s *source) countError() {
+	connectionErrors.Inc()
+	sourceConnectionErrors.WithLabelValues(s.endpoint).Inc()
+}
+
+// connection is the state of one connection to a source.
+type connection struct {
+	src     *source
+	num     int                  // connections made to src so far
+	seen    map[string]bool      // device IDs sampled in this connection
+	seq     map[string]int64     // last sequence number by device ID
+	last    map[string]time.Time // last sample time by device ID
+	drift   *driftDetector
+	start   time.Time
+	lines   int // received so far
+	samples int // sample lines received so far
+	// First sample time by device ID, with -warmup-per-connection.
+	warmupStarts map[string]time.Time
+	// Signalled on each line read, with -poll-command.
+	responses chan struct{}
+	// The host the current line came from, with -syslog.
+	syslogHost string
+	// The device IDs of the current -bus-window, and when it started.
+	busIDs   map[string]bool
+	busStart time.Time
+}
+
+func newConnection(src *source, num int) *connection {
+	return &connection{
+		src:   src,
+		num:   num,
+		seen:  map[string]bool{},
+		seq:   map[string]int64{},
+		last:  map[string]time.Time{},
+		drift: newDriftDetector(),
+		start: clk.Now(),
+
+		warmupStarts: map[string]time.Time{},
+	}
+}
+
+func newSource(endpoint string) *source {
+	s := configuredSource(endpoint)
+	sources = append(sources, s)
+	backoffSeconds.WithLabelValues(endpoint)
+	sourceConnectionAttempts.WithLabelValues(endpoint)
+	sourceConnectionErrors.WithLabelValues(endpoint)
+	if *busWindow > 0 {
+		busMembershipChanges.WithLabelValues(endpoint)
+	}
+	if *firmwareRegexp != "" {
+		bannerParseFailures.WithLabelValues(endpoint)
+	}
+	configuredEndpoint.WithLabelValues(endpoint).Set(1)
+	return s
+}
+
+// configuredSource returns a source configured per -config for endpoint,
+// without listing it among the sources to report on.
+func configuredSource(endpoint string) *source {
+	s := &source{endpoint: endpoint, parsers: lineParsers, kick: make(chan struct{}, 1)}
+	if models, ok := cfg.SourceFahrenheitModels[endpoint]; ok {
+		s.fahrenheitModels = map[string]bool{}
+		for _, m := range models {
+			s.fahrenheitModels[strings.ToLower(m)] = true
+		}
+	}
+	if f, ok := cfg.SourceLineFilters[endpoint]; ok {
+		s.filter = &f
+	}
+	if names, ok := cfg.SourceParsers[endpoint]; ok {
+		// Checked by loadConfig.
+		s.parsers, _ = parsersNamed(names)
+	}
+	s.stages = defaultStages()
+	if names, ok := cfg.SourcePipelines[endpoint]; ok {
+		// Checked by loadConfig.
+		s.stages, _ = stagesNamed(names)
+	}
+	return s
+}
+
+// setConnected records a successful connection, the num'th to s, which
+// closing conn ends; conn may be nil for sources that can't be
+// reconnected.
+func (s *source) setConnected(num int, conn io.Closer) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if num > 1 {
+		s.reconnects[s.reconnectIdx] = clk.Now()
+		s.reconnectIdx = (s.reconnectIdx + 1) % len(s.reconnects)
+	}
+	s.connected, s.everConnected = true, true
+	s.conn, s.num = conn, num
+	// A /reconnect that came in while connecting has been done.
+	select {
+	case <-s.kick:
+	default:
+	}
+	s.failures = 0
+	s.backoff = 0
+	s.nextAttempt = time.Time{}
+}
+
+// inStartupGrace reports whether s hasn't connected yet within
+// -startup-grace of startup.
+func (s *source) inStartupGrace() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return !s.everConnected && clk.Now().Sub(startTime) < *startupGrace
+}
+
+// fail records a failed connection attempt, or a connection ended by an
+// error, and waits out the backoff before the next attempt, unless
+// /reconnect cuts it short.
+func (s *source) fail(backoff time.Duration) {
+	s.down(backoff, true)
+}
+
+// disconnected is fail for a connection that ended cleanly, say at EOF,
+// which isn't counted as a failure.
+func (s *source) disconnected(backoff time.Duration) {
+	s.down(backoff, false)
+}
+
+func (s *source) down(backoff time.Duration, failed bool) {
+	s.mu.Lock()
+	s.connected = false
+	s.conn = nil
+	if failed {
+		s.failures++
+	}
+	s.backoff = backoff
+	s.nextAttempt = clk.Now().Add(backoff)
+	s.mu.Unlock()
+	start := clk.Now()
+	select {
+	case <-clk.After(backoff):
+	case <-s.kick:
+	}
+	backoffSeconds.WithLabelValues(s.endpoint).Add(clk.Now().Sub(start).Seconds())
+}
+
+// reconnectsSince counts the reconnects to s since t, as far back as the
+// history goes.
+func (s *source) reconnectsSince(t time.Time) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	n := 0
+	for _, at := range s.reconnects {
+		if at.After(t) {
+			n++
+		}
+	}
+	return n
+}
+
+var reconnectsLastHourDesc = prometheus.NewDesc("sensors_reconnects_last_hour",
+	"Reconnections to a source in the last hour, up to 256", []string{"endpoint"}, nil)
+
+// reconnectsCollector exports each source's recent reconnects, a flapping
+// indicator that needs no rate().
+type reconnectsCollector struct{}
+
+func (reconnectsCollector) Describe(ch chan<- *prometheus.Desc) { ch <- reconnectsLastHourDesc }
+
+func (reconnectsCollector) Collect(ch chan<- prometheus.Metric) {
+	hourAgo := clk.Now().Add(-time.Hour)
+	for _, s := range sources {
+		ch <- prometheus.MustNewConstMetric(reconnectsLastHourDesc, prometheus.GaugeValue,
+			float64(s.reconnectsSince(hourAgo)), s.endpoint)
+	}
+}
+
+var sourceUpDesc = prometheus.NewDesc("sensors_source_up",
+	"1 if a source is connected, else 0", []string{"endpoint"}, nil)
+
+// sourceUpCollector exports whether each source is connected.
+type sourceUpCollector struct{}
+
+func (sourceUpCollector) Describe(ch chan<- *prometheus.Desc) { ch <- sourceUpDesc }
+
+func (sourceUpCollector) Collect(ch chan<- prometheus.Metric) {
+	for _, s := range sources {
+		up := 0.
+		if s.health().Connected {
+			up = 1
+		}
+		ch <- prometheus.MustNewConstMetric(sourceUpDesc, prometheus.GaugeValue, up, s.endpoint)
+	}
+}
+
+type sourceHealth struct {
+	Connected           bool       `json:"connected"`
+	ConsecutiveFailures int        `json:"consecutive_failures"`
+	Backoff             string     `json:"backoff,omitempty"`
+	NextAttempt         *time.Time `json:"next_attempt,omitempty"`
+}
+
+func (s *source) health() sourceHealth {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	h := sourceHealth{Connected: s.connected, ConsecutiveFailures: s.failures}
+	if !s.connected && !s.nextAttempt.IsZero() {
+		h.Backoff = s.backoff.String()
+		next := s.nextAttempt
+		h.NextAttempt = &next
+	}
+	return h
+}
+
+var healthzRequire = flag.String("healthz-require", "any", "Sources that must be connected for /healthz to report ok: any (at least one) or all")
+
+// healthz reports each source's state; it is unhealthy unless some source
+// (or, per -healthz-require, every source) is connected.
+func healthz(w http.ResponseWriter, r *http.Request) {
+	resp := struct {
+		Status  string                  `json:"status"`
+		Sources map[string]sourceHealth `json:"sources"`
+	}{Status: "down", Sources: map[string]sourceHealth{}}
+	up := 0
+	for _, s := range sources {
+		h := s.health()
+		if h.Connected {
+			up++
+		}
+		resp.Sources[s.endpoint] = h
+	}
+	if up > 0 && (*healthzRequire != "all" || up == len(sources)) {
+		resp.Status = "ok"
+	}
+	w.Header().Set("Content-Type", "application/json")
+	if resp.Status != "ok" {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(resp)
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"time"
+
+	"golang.org/x/crypto/ssh"
+	"golang.org/x/crypto/ssh/knownhosts"
+)
+
+var (
+	sshCommand    = flag.String("ssh-command", "", "If set, log in to each -connect endpoint (host:port of its SSH server) over SSH and read the samples this command writes to stdout")
+	sshUser       = flag.String("ssh-user", os.Getenv("USER"), "User to log in as with -ssh-command")
+	sshKey        = flag.String("ssh-key", filepath.Join(os.Getenv("HOME"), ".ssh", "id_ed25519"), "Private key file to authenticate with for -ssh-command; it mustn't have a passphrase")
+	sshKnownHosts = flag.String("ssh-known-hosts", filepath.Join(os.Getenv("HOME"), ".ssh", "known_hosts"), "known_hosts file to check SSH servers' host keys against for -ssh-command")
+)
+
+// sshDialer returns a dialFunc that runs -ssh-command on the endpoint's
+// SSH server, so redial treats each session like a TCP connection, with
+// the same backoff and metrics: a failure to connect, authenticate or
+// start the command is a dial error, and the session ending is the
+// connection ending.
+func sshDialer() (dialFunc, error) {
+	key, err := os.ReadFile(*sshKey)
+	if err != nil {
+		return nil, err
+	}
+	signer, err := ssh.ParsePrivateKey(key)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %v", *sshKey, err)
+	}
+	hostKeys, err := knownhosts.New(*sshKnownHosts)
+	if err != nil {
+		return nil, err
+	}
+	config := &ssh.ClientConfig{
+		User:            *sshUser,
+		Auth:            []ssh.AuthMethod{ssh.PublicKeys(signer)},
+		HostKeyCallback: hostKeys,
+		Timeout:         *connectTimeout,
+	}
+	return func(endpoint string) (net.Conn, error) {
+		return dialSSH(endpoint, config)
+	}, nil
+}
+
+func dialSSH(endpoint string, config *ssh.ClientConfig) (net.Conn, error) {
+	client, err := ssh.Dial("tcp", endpoint, config)
+	if err != nil {
+		return nil, err
+	}
+	s, err := client.NewSession()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	stdin, err := s.StdinPipe()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	stdout, err := s.StdoutPipe()
+	if err != nil {
+		client.Close()
+		return nil, err
+	}
+	if err := s.Start(*sshCommand); err != nil {
+		client.Close()
+		return nil, fmt.Errorf("starting %q: %v", *sshCommand, err)
+	}
+	return sshConn{client.Conn, stdout, stdin, client}, nil
+}
+
+// sshConn is a running -ssh-command as a net.Conn: reads are its stdout,
+// and writes, such as -connect-command and keepalives, go to its stdin.
+// Its addresses are the SSH connection's; deadlines aren't supported.
+type sshConn struct {
+	ssh.Conn
+	stdout io.Reader
+	stdin  io.WriteCloser
+	client *ssh.Client
+}
+
+func (c sshConn) Read(b []byte) (int, error)  { return c.stdout.Read(b) }
+func (c sshConn) Write(b []byte) (int, error) { return c.stdin.Write(b) }
+func (c sshConn) Close() error                { return c.client.Close() }
+
+var errSSHDeadline = errors.New("deadlines aren't supported on SSH sessions")
+
+func (c sshConn) SetDeadline(t time.Time) error      { return errSSHDeadline }
+func (c sshConn) SetReadDeadline(t time.Time) error  { return errSSHDeadline }
+func (c sshConn) SetWriteDeadline(t time.Time) error { return errSSHDeadline }
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"time"
+)
+
+var startupCheck = flag.Duration("startup-check", 0, "If set, log a warning if there are still no sensor series this long after startup")
+var requireSampleWithin = flag.Duration("require-sample-within", 0, "If set, exit with an error if there are still no sensor series this long after startup")
+
+// startTime is when the collector started.
+var startTime = clk.Now()
+
+// checkStartup warns, once grace has passed, if nothing has been exported
+// yet, to catch a collector that's connected but parsing nothing before
+// someone notices an empty dashboard.
+func checkStartup(grace time.Duration) {
+	clk.Sleep(grace)
+	if problem := startupProblem(grace); problem != "" {
+		log.Printf("WARNING: %s", problem)
+	}
+}
+
+// requireSample exits, once deadline has passed, if nothing has been
+// exported yet, for provisioning checks of the whole sensor chain.
+func requireSample(deadline time.Duration) {
+	clk.Sleep(deadline)
+	if problem := startupProblem(deadline); problem != "" {
+		log.Fatalf("-require-sample-within: %s", problem)
+	}
+}
+
+// startupProblem describes what's wrong if there are still no sensor
+// series after waiting for wait since startup.
+func startupProblem(wait time.Duration) string {
+	seriesMu.Lock()
+	n := len(allSeries)
+	seriesMu.Unlock()
+	if n > 0 {
+		return ""
+	}
+	for _, s := range sources {
+		if s.health().Connected {
+			return fmt.Sprintf("connected to %s but no sensor series %v after startup; is the format right?", s.endpoint, wait)
+		}
+	}
+	return fmt.Sprintf("no sensor series %v after startup, and no source connected", wait)
+}
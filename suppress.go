@@ -0,0 +1,50 @@
+package main
+
+import (
+	"flag"
+	"regexp"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var suppressFirstLines = flag.Int("suppress-first-lines", 0, "Ignore this many lines at the start of each connection, which may be stale data buffered by the gateway")
+var suppressFirstDuration = flag.Duration("suppress-first-duration", 0, "Ignore lines received this soon after each connection is made")
+var headerRegexp = flag.String("header-regexp", "", "Ignore lines matching this regexp, such as a gateway's banner or column headings, counting them as header lines rather than unmatched")
+var suppressPartialLine = flag.Bool("suppress-partial-line", true, "Don't count a connection's first line as unmatched if it doesn't parse, as it's likely a fragment")
+
+var suppressedLines = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "suppressed_lines_total",
+	Help:      "Lines ignored as likely stale or partial, for arriving at the start of a connection",
+})
+
+var headerLines = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "header_lines_total",
+	Help:      "Lines ignored for matching -header-regexp",
+})
+
+// headerRE is -header-regexp, compiled; nil if unset.
+var headerRE *regexp.Regexp
+
+// suppressed counts a line received on c, reporting whether it should be
+// ignored per -suppress-first-lines and -suppress-first-duration.
+func (c *connection) suppressed() bool {
+	c.lines++
+	if c.lines <= *suppressFirstLines || clk.Now().Sub(c.start) < *suppressFirstDuration {
+		suppressedLines.Inc()
+		return true
+	}
+	return false
+}
+
+// header reports whether a line read on c is a banner or heading per
+// -header-regexp, counting it, and noting any firmware version, if so.
+func header(line string, c *connection) bool {
+	if headerRE == nil || !headerRE.MatchString(line) {
+		return false
+	}
+	headerLines.Inc()
+	c.noteBanner(line)
+	return true
+}
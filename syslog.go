@@ -0,0 +1,153 @@
+package main
+
+import (
+	"flag"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var syslogInput = flag.Bool("syslog", false, "Read each line as a syslog message (RFC 3164 or RFC 5424), parsing its body as a sample line and noting the sending host")
+
+var (
+	syslogInvalid = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: "sensors",
+		Name:      "syslog_invalid_frames_total",
+		Help:      "Lines dropped with -syslog for not being valid syslog messages",
+	})
+	syslogHosts = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "sensors",
+		Name:      "syslog_host_info",
+		Help:      "1 for the syslog host each device's latest sample came from, with -syslog",
+	}, []string{"device", "host"})
+)
+
+// parseSyslog splits a syslog message into the sending host, if it says,
+// and its body, reporting false if it isn't one.  Messages are either RFC
+// 5424, "<PRI>1 TIMESTAMP HOST APP PROCID MSGID SD MSG", or BSD syslog per
+// RFC 3164, "<PRI>Mmm dd hh:mm:ss HOST TAG: MSG", either of them perhaps
+// octet-counted per RFC 6587.
+func parseSyslog(line string) (host, msg string, ok bool) {
+	if n, rest, found := strings.Cut(line, " "); found && isDigits(n) && strings.HasPrefix(rest, "<") {
+		line = rest
+	}
+	end := strings.IndexByte(line, '>')
+	if !strings.HasPrefix(line, "<") || end < 2 || end > 4 || !isDigits(line[1:end]) {
+		return "", "", false
+	}
+	if pri, _ := strconv.Atoi(line[1:end]); pri > 191 {
+		return "", "", false
+	}
+	rest := line[end+1:]
+	if v, _, found := strings.Cut(rest, " "); found && isDigits(v) {
+		return parseRFC5424(rest)
+	}
+	return parseRFC3164(rest)
+}
+
+// parseRFC5424 parses what follows the PRI of an RFC 5424 message.
+func parseRFC5424(s string) (host, msg string, ok bool) {
+	f := strings.SplitN(s, " ", 7)
+	if len(f) < 7 {
+		return "", "", false
+	}
+	host, sd := f[2], f[6]
+	if host == "-" {
+		host = ""
+	}
+	if strings.HasPrefix(sd, "-") {
+		msg = sd[1:]
+	} else if end := structuredDataEnd(sd); end > 0 {
+		msg = sd[end:]
+	} else {
+		return "", "", false
+	}
+	if msg != "" && !strings.HasPrefix(msg, " ") {
+		return "", "", false
+	}
+	return host, strings.TrimPrefix(strings.TrimPrefix(msg, " "), "\ufeff"), true
+}
+
+// structuredDataEnd returns the length of the RFC 5424 structured data
+// elements sd starts with, whose quoted values may contain spaces and
+// (escaped) brackets, or 0 if there aren't any.
+func structuredDataEnd(sd string) int {
+	if !strings.HasPrefix(sd, "[") {
+		return 0
+	}
+	quoted := false
+	for i := 0; i < len(sd); i++ {
+		switch c := sd[i]; {
+		case quoted && c == '\\':
+			i++
+		case c == '"':
+			quoted = !quoted
+		case !quoted && c == ']' && (i+1 == len(sd) || sd[i+1] != '['):
+			return i + 1
+		}
+	}
+	return 0
+}
+
+// parseRFC3164 parses what follows the PRI of a BSD syslog message.  The
+// tag, up to a colon, is optional, as some senders leave it out.
+func parseRFC3164(s string) (host, msg string, ok bool) {
+	if len(s) < len(time.Stamp)+1 || s[len(time.Stamp)] != ' ' {
+		return "", "", false
+	}
+	if _, err := time.Parse(time.Stamp, s[:len(time.Stamp)]); err != nil {
+		return "", "", false
+	}
+	host, msg, found := strings.Cut(s[len(time.Stamp)+1:], " ")
+	if !found || host == "" {
+		return "", "", false
+	}
+	if tag, body, found := strings.Cut(msg, " "); found && strings.HasSuffix(tag, ":") {
+		msg = body
+	}
+	return host, msg, true
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return s != ""
+}
+
+var (
+	syslogMu sync.Mutex
+	// syslogHostOf is, by device, the host exported in syslogHosts.
+	syslogHostOf = map[string]string{}
+)
+
+// noteSyslogHost records which host a device's sample came from, if its
+// line was a syslog message.
+func (c *connection) noteSyslogHost(ID, model string) {
+	if c.syslogHost == "" {
+		return
+	}
+	device := formatDevice(ID, model)
+	syslogMu.Lock()
+	defer syslogMu.Unlock()
+	if prev, ok := syslogHostOf[device]; ok && prev != c.syslogHost {
+		syslogHosts.DeleteLabelValues(device, prev)
+	}
+	syslogHostOf[device] = c.syslogHost
+	syslogHosts.WithLabelValues(device, c.syslogHost).Set(1)
+}
+
+// forgetSyslogHost deletes a device's syslogHosts gauge once it's gone.
+func forgetSyslogHost(device string) {
+	syslogMu.Lock()
+	defer syslogMu.Unlock()
+	if host, ok := syslogHostOf[device]; ok {
+		syslogHosts.DeleteLabelValues(device, host)
+		delete(syslogHostOf, device)
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"math"
+)
+
+// absoluteZero is 0K in celsius.
+const absoluteZero = -273.15
+
+// apply converts v per the transform's function.  The thermistor
+// functions take a resistance in ohms and give a temperature in celsius,
+// or NaN for resistances that can't be right.
+func (t transform) apply(v float64) float64 {
+	switch t.Function {
+	case "steinhart-hart":
+		if v <= 0 {
+			return math.NaN()
+		}
+		// 1/T = A + B ln R + C (ln R)³, T in kelvin.
+		l := math.Log(v)
+		return 1/(t.A+t.B*l+t.C*l*l*l) + absoluteZero
+	case "ntc":
+		if v <= 0 {
+			return math.NaN()
+		}
+		// The beta equation: 1/T = 1/T0 + ln(R/R0)/β.
+		t0 := 25.
+		if t.T0 != nil {
+			t0 = *t.T0
+		}
+		return 1/(1/(t0-absoluteZero)+math.Log(v/t.R0)/t.Beta) + absoluteZero
+	default:
+		return t.Scale*v + t.Offset
+	}
+}
+
+// check validates a transform's function and its parameters.
+func (t transform) check() error {
+	switch t.Function {
+	case "", "linear":
+		if t.Scale == 0 {
+			return errors.New("no scale")
+		}
+	case "steinhart-hart":
+		if t.A == 0 && t.B == 0 && t.C == 0 {
+			return errors.New("no steinhart-hart coefficients a, b and c")
+		}
+	case "ntc":
+		if t.Beta <= 0 || t.R0 <= 0 {
+			return errors.New("ntc needs a positive beta and r0")
+		}
+	default:
+		return fmt.Errorf("unknown function %q", t.Function)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"math"
+	"testing"
+)
+
+func TestTransformApply(t *testing.T) {
+	t0 := 0.
+	sh := transform{Function: "steinhart-hart", A: 1.009249522e-03, B: 2.378405444e-04, C: 2.019202697e-07}
+	ntc := transform{Function: "ntc", Beta: 3950, R0: 10000}
+	for _, tt := range []struct {
+		name string
+		t    transform
+		in   float64
+		want float64 // or NaN
+	}{
+		{"linear", transform{Scale: 2, Offset: 1}, 3, 7},
+		{"linear named", transform{Function: "linear", Scale: 0.5, Offset: -10}, 30, 5},
+		{"steinhart-hart", sh, 10000, 24.68},
+		{"steinhart-hart hot", sh, 3588.1, 52.92},
+		{"steinhart-hart none", sh, 0, math.NaN()},
+		{"ntc at r0", ntc, 10000, 25},
+		{"ntc", ntc, 3588.18, 50},
+		{"ntc t0", transform{Function: "ntc", Beta: 3950, R0: 32650, T0: &t0}, 32650, 0},
+		{"ntc negative", ntc, -5, math.NaN()},
+	} {
+		got := tt.t.apply(tt.in)
+		if math.IsNaN(tt.want) != math.IsNaN(got) || math.Abs(got-tt.want) > 0.005 {
+			t.Errorf("%s: apply(%v) = %v; want %v", tt.name, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestTransformCheck(t *testing.T) {
+	for _, tt := range []struct {
+		t  transform
+		ok bool
+	}{
+		{transform{Scale: 1}, true},
+		{transform{}, false},
+		{transform{Function: "linear", Offset: 1}, false},
+		{transform{Function: "steinhart-hart", B: 1}, true},
+		{transform{Function: "steinhart-hart"}, false},
+		{transform{Function: "ntc", Beta: 3950, R0: 10000}, true},
+		{transform{Function: "ntc", Beta: 3950}, false},
+		{transform{Function: "ntc", Beta: -1, R0: 10000}, false},
+		{transform{Function: "cubic", Scale: 1}, false},
+	} {
+		if err := tt.t.check(); (err == nil) != tt.ok {
+			t.Errorf("%+v: check = %v; want ok %v", tt.t, err, tt.ok)
+		}
+	}
+}
+
+func TestTransformValue(t *testing.T) {
+	setConfig(t, config{Transforms: []transform{
+		{Model: "sht31", Kind: "humidity", Scale: 1, Offset: -2.5},
+		{Model: "ntc10k", Kind: "temp", Function: "ntc", Beta: 3950, R0: 10000},
+	}})
+	for _, tt := range []struct {
+		model, kind string
+		in, want    float64
+	}{
+		{"SHT31", "Humidity", 50, 47.5},
+		{"sht31", "temp", 21.5, 21.5},
+		{"ntc10k", "temp", 10000, 25},
+		{"dht22", "humidity", 50, 50},
+	} {
+		if got := transformValue(tt.model, tt.kind, tt.in); math.Abs(got-tt.want) > 1e-9 {
+			t.Errorf("transformValue(%q, %q, %v) = %v; want %v", tt.model, tt.kind, tt.in, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// threshold is a limit on the latest samples of a metric, crossed when
+// above it or below it, or outside both, for at least For.
+type threshold struct {
+	Above *float64 `json:"above"`
+	Below *float64 `json:"below"`
+	For   duration `json:"for"`
+}
+
+func (t threshold) check() error {
+	switch {
+	case t.Above == nil && t.Below == nil:
+		return fmt.Errorf("needs above or below")
+	case t.For < 0:
+		return fmt.Errorf("negative for")
+	}
+	return nil
+}
+
+func (t threshold) crossed(v float64) bool {
+	return t.Above != nil && v > *t.Above || t.Below != nil && v < *t.Below
+}
+
+// checkThresholds validates a set of thresholds by metric, of what.
+func checkThresholds(what string, ts map[string]threshold) error {
+	for metric, t := range ts {
+		if err := t.check(); err != nil {
+			return fmt.Errorf("%s[%q]: %v", what, metric, err)
+		}
+	}
+	return nil
+}
+
+var (
+	thresholdCrossed = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "sensors",
+		Name:      "threshold_crossed",
+		Help:      "1 while a device's metric has been past its threshold for the threshold's duration",
+	}, []string{"device", "metric"})
+	thresholdInfo = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: "sensors",
+		Name:      "threshold_info",
+		Help:      "1 for the threshold set in effect for a device's metric: device (from -discovery-file), model or default",
+	}, []string{"device", "metric", "set"})
+)
+
+// deviceThresholds holds the thresholds loaded from -discovery-file, by
+// device label or raw id, then metric.
+var deviceThresholds atomic.Pointer[map[string]map[string]threshold]
+
+// thresholdsConfigured reports whether there may be thresholds to check.
+// Those from -discovery-file can turn up on reload.
+func thresholdsConfigured() bool {
+	return *discoveryFile != "" || len(cfg.ModelThresholds) > 0 || len(cfg.DefaultThresholds) > 0
+}
+
+// thresholdFor returns the threshold on a series, if any, and which set
+// it's from: its device's in -discovery-file, else its model's, else the
+// default.
+func thresholdFor(s *series) (threshold, string, bool) {
+	if d := deviceThresholds.Load(); d != nil {
+		ts, ok := (*d)[s.labels["device"]]
+		if !ok {
+			ts = (*d)[s.labels["id"]]
+		}
+		if t, ok := ts[s.metric]; ok {
+			return t, "device", true
+		}
+	}
+	if t, ok := cfg.ModelThresholds[s.labels["model"]][s.metric]; ok {
+		return t, "model", true
+	}
+	if t, ok := cfg.DefaultThresholds[s.metric]; ok {
+		return t, "default", true
+	}
+	return threshold{}, "", false
+}
+
+// thresholdState is where a device's metric is with its threshold.
+type thresholdState struct {
+	device, metric, set string
+	// When the threshold was first found crossed, if it still is.
+	since time.Time
+}
+
+// thresholdStates are by device and metric.  They're guarded by seriesMu.
+var thresholdStates = map[string]*thresholdState{}
+
+// evaluateThresholds updates the threshold gauges of every series as of
+// now.  During maintenance none is crossed, and thresholds must be
+// crossed for their duration again afterwards.  seriesMu must be held.
+func evaluateThresholds(now time.Time, maintenance bool) {
+	seen := map[string]bool{}
+	for _, s := range allSeries {
+		t, set, ok := thresholdFor(s)
+		if !ok {
+			continue
+		}
+		device := s.labels["device"]
+		key := device + "\xff" + s.metric
+		seen[key] = true
+		st := thresholdStates[key]
+		if st == nil {
+			st = &thresholdState{device: device, metric: s.metric}
+			thresholdStates[key] = st
+		}
+		if st.set != set {
+			if st.set != "" {
+				thresholdInfo.DeleteLabelValues(device, s.metric, st.set)
+			}
+			st.set = set
+			thresholdInfo.WithLabelValues(device, s.metric, set).Set(1)
+		}
+		crossed := 0.
+		switch {
+		case maintenance || !t.crossed(s.value):
+			st.since = time.Time{}
+		case st.since.IsZero():
+			st.since = now
+			fallthrough
+		default:
+			if now.Sub(st.since) >= time.Duration(t.For) {
+				crossed = 1
+			}
+		}
+		thresholdCrossed.WithLabelValues(device, s.metric).Set(crossed)
+	}
+	for key, st := range thresholdStates {
+		if !seen[key] {
+			thresholdCrossed.DeleteLabelValues(st.device, st.metric)
+			thresholdInfo.DeleteLabelValues(st.device, st.metric, st.set)
+			delete(thresholdStates, key)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"flag"
+	"log"
+	"strconv"
+	"time"
+
+	"github.com/aqua/wrt54gl-sensor-collector/sensor"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var timestampFormat = flag.String("timestamp-format", "none", `Format of each line's leading timestamp field: "none" to ignore it, "unix" for epoch seconds, or a Go time layout (which must not contain the field delimiter)`)
+
+var maxTimestampSkew = flag.Duration("max-timestamp-skew", 0, "If set, samples timestamped further than this into the future or past are treated per -skewed-timestamps")
+var skewedTimestamps = flag.String("skewed-timestamps", "receipt", "What to do with samples beyond -max-timestamp-skew: receipt (time them on receipt) or drop")
+
+var exportTimestamps = flag.Bool("export-timestamps", false, "Export sensor series with the time of their latest sample, per its line's -timestamp-format timestamp (or receipt), rather than leave Prometheus to time them at scrape")
+var timestampGrid = flag.Duration("timestamp-grid", 0, "With -export-timestamps, snap exported timestamps down to a multiple of this, so a slow sensor's readings line up rather than look like ramps")
+
+var implausibleTimestamps = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "implausible_timestamps_total",
+	Help:      "Samples whose timestamp was further from the collector's clock than -max-timestamp-skew",
+})
+
+var invalidTimestamps = prometheus.NewCounter(prometheus.CounterOpts{
+	Namespace: "sensors",
+	Name:      "invalid_timestamps_total",
+	Help:      "Samples whose leading timestamp didn't parse per -timestamp-format, and were timed on receipt instead",
+})
+
+// exportedTime returns the timestamp to export a sample taken at at with,
+// per -timestamp-grid.  It's rounded down so as never to be in the future.
+func exportedTime(at time.Time) time.Time {
+	if *timestampGrid <= 0 {
+		return at
+	}
+	return at.Truncate(*timestampGrid)
+}
+
+// isTimestampField reports whether a field could be a line's leading
+// timestamp.  Integer formats must look like an integer to match at all;
+// anything goes for layouts, whose validity is checked by sampleTime.
+func isTimestampField(f string) bool {
+	if *leadingField == "sequence" {
+		return sensor.IsInteger(f)
+	}
+	switch *timestampFormat {
+	case "none", "unix":
+		return sensor.IsInteger(f)
+	}
+	return f != ""
+}
+
+// sampleTime returns the time a sample was taken, from its leading
+// timestamp field if -timestamp-format says how to read it, or else the
+// time it was received.
+func sampleTime(f string) time.Time {
+	if *leadingField == "sequence" {
+		return clk.Now()
+	}
+	switch *timestampFormat {
+	case "none":
+		return clk.Now()
+	case "unix":
+		if s, err := strconv.ParseInt(f, 10, 64); err == nil {
+			return time.Unix(s, 0)
+		}
+	default:
+		if t, err := time.Parse(*timestampFormat, f); err == nil {
+			return t
+		}
+	}
+	invalidTimestamps.Inc()
+	return clk.Now()
+}
+
+// plausibleTime checks a sample's time against -max-timestamp-skew, so one
+// node with a wildly wrong clock can't poison its series.  It returns the
+// time to use for the sample, or false if the sample should be dropped.
+func plausibleTime(at time.Time, device string) (time.Time, bool) {
+	if *maxTimestampSkew <= 0 {
+		return at, true
+	}
+	now := clk.Now()
+	skew := at.Sub(now)
+	if skew <= *maxTimestampSkew && skew >= -*maxTimestampSkew {
+		return at, true
+	}
+	implausibleTimestamps.Inc()
+	if *skewedTimestamps == "drop" {
+		log.Printf("Dropping sample from %s timestamped %v (%v from now)", device, at, skew)
+		return now, false
+	}
+	log.Printf("Timing sample from %s on receipt, as its timestamp %v is %v from now", device, at, skew)
+	return now, true
+}
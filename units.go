@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+// fahrenheitGatherer converts the temperature gauges gathered from g to
+// fahrenheit.  Metric names are left alone, so they still say celsius.
+type fahrenheitGatherer struct {
+	g prometheus.Gatherer
+}
+
+func (f fahrenheitGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := f.g.Gather()
+	for _, mf := range mfs {
+		if mf.GetType() != dto.MetricType_GAUGE {
+			continue
+		}
+		byName := strings.HasSuffix(mf.GetName(), "_celsius")
+		if !byName && mf.GetName() == "sensors_window_samples" {
+			continue
+		}
+		// Differences between temperatures don't take the offset.
+		offset := 32.
+		if strings.HasSuffix(mf.GetName(), "_spread_degrees_celsius") {
+			offset = 0
+		}
+		for _, m := range mf.Metric {
+			if !byName && !celsiusMetricLabel(m) {
+				continue
+			}
+			if g := m.GetGauge(); g != nil && g.Value != nil {
+				v := g.GetValue()*9/5 + offset
+				g.Value = &v
+			}
+		}
+	}
+	return mfs, err
+}
+
+// celsiusMetricLabel reports whether m describes another metric in celsius
+// through its metric label, as the window stats do.
+func celsiusMetricLabel(m *dto.Metric) bool {
+	for _, l := range m.Label {
+		if l.GetName() == "metric" {
+			return strings.HasSuffix(l.GetValue(), "_celsius")
+		}
+	}
+	return false
+}
+
+// unitsHandler serves g, converting temperatures to the units asked for
+// with ?units=, or if not given, converting per -unit-system.
+func unitsHandler(g prometheus.Gatherer) http.Handler {
+	system := metricsHandler(unitSystemGatherer{g})
+	celsius := metricsHandler(g)
+	fahrenheit := metricsHandler(fahrenheitGatherer{g})
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch units := r.URL.Query().Get("units"); units {
+		case "":
+			system.ServeHTTP(w, r)
+		case "celsius":
+			celsius.ServeHTTP(w, r)
+		case "fahrenheit":
+			fahrenheit.ServeHTTP(w, r)
+		default:
+			http.Error(w, fmt.Sprintf("unknown units %q", units), http.StatusBadRequest)
+		}
+	})
+}
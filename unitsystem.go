@@ -0,0 +1,94 @@
+package main
+
+import (
+	"flag"
+	"strings"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var unitSystem = flag.String("unit-system", "metric", "Units to export: metric, or imperial, which converts and renames celsius metrics to fahrenheit and hPa or pascal ones to inches of mercury; per-metric overrides go in -config")
+
+// imperialUnit converts metrics whose names end in one metric unit suffix
+// to an imperial one.
+// word and imperialWord name the units in help text.
+type imperialUnit struct {
+	suffix, imperial   string
+	word, imperialWord string
+	convert            func(float64) float64
+}
+
+var imperialUnits = []imperialUnit{
+	// Differences between temperatures don't take the offset.
+	{"_spread_degrees_celsius", "_spread_degrees_fahrenheit", "celsius", "fahrenheit", func(c float64) float64 { return c * 9 / 5 }},
+	{"_celsius", "_fahrenheit", "celsius", "fahrenheit", func(c float64) float64 { return c*9/5 + 32 }},
+	{"_hpa", "_inches_of_mercury", "hPa", "inches of mercury", func(p float64) float64 { return p * 0.0295299830714 }},
+	{"_pascals", "_inches_of_mercury", "pascals", "inches of mercury", func(p float64) float64 { return p * 0.000295299830714 }},
+}
+
+// imperialUnitFor returns the conversion for a metric name, if it is in a
+// metric unit and exported in imperial units per -unit-system and
+// metric_unit_systems.
+func imperialUnitFor(name string) *imperialUnit {
+	system := *unitSystem
+	if s, ok := cfg.MetricUnitSystems[strings.TrimPrefix(name, "sensors_")]; ok {
+		system = s
+	}
+	if system != "imperial" {
+		return nil
+	}
+	for i, u := range imperialUnits {
+		if strings.HasSuffix(name, u.suffix) {
+			return &imperialUnits[i]
+		}
+	}
+	return nil
+}
+
+// unitSystemGatherer converts and renames what g gathers per -unit-system.
+// The window stats, whose metric label names the metric they describe,
+// have their values converted and the label renamed to match.
+type unitSystemGatherer struct {
+	g prometheus.Gatherer
+}
+
+func (u unitSystemGatherer) Gather() ([]*dto.MetricFamily, error) {
+	mfs, err := u.g.Gather()
+	for _, mf := range mfs {
+		if mf.GetType() != dto.MetricType_GAUGE {
+			continue
+		}
+		if iu := imperialUnitFor(mf.GetName()); iu != nil {
+			name := strings.TrimSuffix(mf.GetName(), iu.suffix) + iu.imperial
+			help := strings.ReplaceAll(mf.GetHelp(), iu.word, iu.imperialWord)
+			mf.Name, mf.Help = &name, &help
+			for _, m := range mf.Metric {
+				convertGauge(m, iu)
+			}
+			continue
+		}
+		for _, m := range mf.Metric {
+			for _, l := range m.Label {
+				if l.GetName() != "metric" {
+					continue
+				}
+				if iu := imperialUnitFor(l.GetValue()); iu != nil {
+					v := strings.TrimSuffix(l.GetValue(), iu.suffix) + iu.imperial
+					l.Value = &v
+					if mf.GetName() != "sensors_window_samples" {
+						convertGauge(m, iu)
+					}
+				}
+			}
+		}
+	}
+	return mfs, err
+}
+
+func convertGauge(m *dto.Metric, iu *imperialUnit) {
+	if g := m.GetGauge(); g != nil && g.Value != nil {
+		v := iu.convert(g.GetValue())
+		g.Value = &v
+	}
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/aqua/wrt54gl-sensor-collector/sensor"
+)
+
+// valueUnits maps unit suffixes and fields, lower-cased, to unit names.
+var valueUnits = map[string]string{
+	"c": "celsius", "°c": "celsius",
+	"f": "fahrenheit", "°f": "fahrenheit",
+	"k": "kelvin", "°k": "kelvin",
+	"%":   "percent",
+	"hpa": "hpa",
+}
+
+// parseValue parses a sample value, returning the unit embedded in it, if
+// any.
+func parseValue(s string) (float64, string, error) {
+	num, suffix := sensor.SplitValue(s)
+	unit := valueUnits[strings.ToLower(suffix)]
+	v, err := strconv.ParseFloat(num, 64)
+	return v, unit, err
+}
+
+func isTemperatureUnit(unit string) bool {
+	return unit == "celsius" || unit == "fahrenheit" || unit == "kelvin"
+}
+
+var (
+	unitMismatchesMu sync.Mutex
+	unitMismatches   = map[[3]string]bool{}
+)
+
+// checkEmbeddedUnit reports whether a value's embedded unit, if any, agrees
+// with the expected one, given by name or suffix (a route's "%", say).
+// Disagreements are logged, once per device and pair of units.
+func checkEmbeddedUnit(device, expected, embedded string) bool {
+	if u, ok := valueUnits[strings.ToLower(expected)]; ok {
+		expected = u
+	}
+	if embedded == "" || expected == "" || embedded == expected {
+		return true
+	}
+	unitMismatchesMu.Lock()
+	defer unitMismatchesMu.Unlock()
+	k := [3]string{device, expected, embedded}
+	if !unitMismatches[k] {
+		unitMismatches[k] = true
+		throttledLogf("parse error", "Device %q sent a value in %s where %s was expected", device, embedded, expected)
+	}
+	return false
+}
@@ -0,0 +1,75 @@
+package main
+
+import "testing"
+
+func TestParseValue(t *testing.T) {
+	for _, tt := range []struct {
+		in   string
+		v    float64
+		unit string
+		ok   bool
+	}{
+		{"23.5", 23.5, "", true},
+		{"-4", -4, "", true},
+		{"23.5C", 23.5, "celsius", true},
+		{"23.5c", 23.5, "celsius", true},
+		{"71.6°F", 71.6, "fahrenheit", true},
+		{"296.6K", 296.6, "kelvin", true},
+		{"296.6\u212a", 296.6, "kelvin", true},
+		{"296.6°K", 296.6, "kelvin", true},
+		{"48.2%", 48.2, "percent", true},
+		{"1013.2hPa", 1013.2, "hpa", true},
+		{"1013.2HPA", 1013.2, "hpa", true},
+		{"1..2C", 0, "celsius", false},
+		{"C", 0, "celsius", false},
+	} {
+		v, unit, err := parseValue(tt.in)
+		if (err == nil) != tt.ok || unit != tt.unit || tt.ok && v != tt.v {
+			t.Errorf("parseValue(%q) = %v, %q, %v; want %v, %q, ok %v", tt.in, v, unit, err, tt.v, tt.unit, tt.ok)
+		}
+	}
+}
+
+func TestCheckEmbeddedUnit(t *testing.T) {
+	for _, tt := range []struct {
+		device, expected, embedded string
+		want                       bool
+	}{
+		{"d1", "celsius", "", true},
+		{"d1", "celsius", "celsius", true},
+		{"d1", "fahrenheit", "celsius", false},
+		{"d1", "%", "percent", true},
+		{"d1", "hPa", "hpa", true},
+		{"d1", "", "kelvin", true},
+		{"d1", "percent", "celsius", false},
+	} {
+		if got := checkEmbeddedUnit(tt.device, tt.expected, tt.embedded); got != tt.want {
+			t.Errorf("checkEmbeddedUnit(%q, %q, %q) = %v; want %v", tt.device, tt.expected, tt.embedded, got, tt.want)
+		}
+	}
+}
+
+func TestEmbeddedUnitLines(t *testing.T) {
+	for _, tt := range []struct {
+		line   string
+		device string
+		want   float64 // or 0 for none
+	}{
+		{"100 temp 28ff0a1b2c50 DS18B20 70.5F", "ds18b20-00ff0a1b2c50", 21.4},
+		// The glued-on unit is believed over the firmware's fahrenheit.
+		{"100 temp 28ff0a1b2c51 DS18B20 21.5C", "ds18b20-00ff0a1b2c51", 21.5},
+		{"100 temp 28ff0a1b2c52 DS18B20 294.65K", "ds18b20-00ff0a1b2c52", 21.5},
+		{"100 temp 28ff0a1b2c54 DS18B20 294.65\u212a", "ds18b20-00ff0a1b2c54", 21.5},
+		{"100 temp 28ff0a1b2c53 DS18B20 21.5%", "ds18b20-00ff0a1b2c53", 0},
+	} {
+		temperatureGauges.get().Reset()
+		if !processLine(tt.line, testConnection(t)) {
+			t.Errorf("processLine(%q) didn't match", tt.line)
+			continue
+		}
+		v, ok := gaugeValue(temperatureGauges, tt.device)
+		if tt.want == 0 && ok || tt.want != 0 && (!ok || v != tt.want) {
+			t.Errorf("%q gave %v, %v; want %v", tt.line, v, ok, tt.want)
+		}
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"flag"
+	"strings"
+	"sync"
+	"time"
+)
+
+var warmupPerConnection = flag.Bool("warmup-per-connection", false, "Restart model_warmups for each device on every connection, not just the first sample since startup, for gateways whose sensors are powered up with the link")
+
+var (
+	warmupMu sync.Mutex
+	// warmupStarts holds when each device (by raw ID) was first heard
+	// from, for model_warmups.
+	warmupStarts = map[string]time.Time{}
+)
+
+// warmingUp reports whether a sample received now from a device of model
+// falls within its model's warm-up in model_warmups, since the device's
+// first sample (in this connection, with -warmup-per-connection).
+func (c *connection) warmingUp(ID, model string, now time.Time) bool {
+	warmup := time.Duration(cfg.ModelWarmups[strings.ToLower(model)])
+	if warmup <= 0 {
+		return false
+	}
+	starts := warmupStarts
+	if *warmupPerConnection {
+		starts = c.warmupStarts
+	} else {
+		warmupMu.Lock()
+		defer warmupMu.Unlock()
+	}
+	start, ok := starts[ID]
+	if !ok {
+		start = now
+		starts[ID] = now
+	}
+	return now.Sub(start) < warmup
+}
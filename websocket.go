@@ -0,0 +1,81 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+
+	"golang.org/x/net/websocket"
+)
+
+var wsURL = flag.String("ws-url", "", "Read samples from the text messages of this ws:// or wss:// WebSocket instead of -connect")
+
+// messageReader reads a WebSocket's text messages as a stream of lines,
+// ending each message with a newline so the last line of one doesn't run
+// into the first of the next.
+type messageReader struct {
+	ws  *websocket.Conn
+	buf *strings.Reader
+}
+
+func (m *messageReader) Read(p []byte) (int, error) {
+	for m.buf == nil || m.buf.Len() == 0 {
+		var msg string
+		if err := websocket.Message.Receive(m.ws, &msg); err != nil {
+			return 0, err
+		}
+		m.buf = strings.NewReader(msg + "\n")
+	}
+	return m.buf.Read(p)
+}
+
+// checkWSURL makes sure rawURL is a WebSocket URL.
+func checkWSURL(rawURL string) error {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return err
+	}
+	if u.Scheme != "ws" && u.Scheme != "wss" {
+		return fmt.Errorf("%s: scheme must be ws or wss", rawURL)
+	}
+	return nil
+}
+
+// wsConn is a client WebSocket as a net.Conn, read a message at a time by
+// a messageReader.  Writes go out as text messages of their own.
+type wsConn struct {
+	*websocket.Conn
+	r *messageReader
+}
+
+func (c *wsConn) Read(p []byte) (int, error) { return c.r.Read(p) }
+
+// RemoteAddr gives the server's host and port rather than the whole URL,
+// so the connection counts by peer like a TCP one.
+func (c *wsConn) RemoteAddr() net.Addr {
+	return wsAddr(c.Config().Location.Host)
+}
+
+type wsAddr string
+
+func (a wsAddr) Network() string { return "ws" }
+func (a wsAddr) String() string  { return string(a) }
+
+// dialWS is the dialFunc of -ws-url, whose source's endpoint is the URL.
+func dialWS(rawURL string) (net.Conn, error) {
+	// The server may check the origin, and there's no page, so claim to be
+	// from the server itself.
+	origin := strings.Replace(rawURL, "ws", "http", 1)
+	config, err := websocket.NewConfig(rawURL, origin)
+	if err != nil {
+		return nil, err
+	}
+	config.Dialer = &net.Dialer{Timeout: *connectTimeout}
+	ws, err := websocket.DialConfig(config)
+	if err != nil {
+		return nil, err
+	}
+	return &wsConn{Conn: ws, r: &messageReader{ws: ws}}, nil
+}